@@ -0,0 +1,153 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// Client is the vineyard client, over either the ipc socket or the rpc
+// endpoint. The blobs of an ipc client are shared memory, and the ones of an
+// rpc client are copied over the connection.
+type Client interface {
+	ds.IIPCClient
+
+	Disconnect(ctx context.Context) error
+
+	// metadata
+	GetMetaData(ctx context.Context, id common.ObjectID, meta *ds.ObjectMeta, syncRemote bool) error
+	GetObject(ctx context.Context, id common.ObjectID, options ...GetObjectOption) (interface{}, error)
+	MigrateObject(ctx context.Context, id common.ObjectID) (common.ObjectID, error)
+	ListData(ctx context.Context, pattern string, regex bool, limit int) ([]*ds.ObjectMeta, error)
+	Label(ctx context.Context, id common.ObjectID, labels map[string]string) error
+	ListByLabels(ctx context.Context, pattern string, regex bool, selector string, limit int) ([]*ds.ObjectMeta, error)
+	Exists(ctx context.Context, id common.ObjectID) (bool, error)
+	DelData(ctx context.Context, ids []common.ObjectID, force, deep bool) error
+	Persist(ctx context.Context, id common.ObjectID) error
+	IfPersist(ctx context.Context, id common.ObjectID) (bool, error)
+	ShallowCopy(ctx context.Context, id common.ObjectID) (common.ObjectID, error)
+	SyncMetaData(ctx context.Context) error
+	Clear(ctx context.Context) error
+
+	// name
+	PutName(ctx context.Context, id common.ObjectID, name string) error
+	GetName(ctx context.Context, name string, wait bool, id *common.ObjectID) error
+	DropName(ctx context.Context, name string) error
+	ListNames(ctx context.Context, pattern string, regex bool, limit int) (map[string]common.ObjectID, error)
+
+	// blob
+	GetBlobs(ctx context.Context, ids []common.ObjectID) (map[common.ObjectID]*ds.Blob, error)
+
+	// spill
+	Evict(ctx context.Context, ids []common.ObjectID) error
+	Load(ctx context.Context, ids []common.ObjectID, pin bool) error
+	Unpin(ctx context.Context, ids []common.ObjectID) error
+	IsSpilled(ctx context.Context, id common.ObjectID) (bool, error)
+	IsInUse(ctx context.Context, id common.ObjectID) (bool, error)
+
+	// cluster
+	InstanceStatus(ctx context.Context) (*common.InstanceStatus, error)
+	ClusterInfo(ctx context.Context) (map[common.InstanceID]*InstanceInfo, error)
+
+	// stream
+	CreateStream(ctx context.Context, id common.ObjectID) error
+	OpenStream(ctx context.Context, id common.ObjectID, mode StreamOpenMode) error
+	PushNextStreamChunk(ctx context.Context, id common.ObjectID, chunk common.ObjectID) error
+	PullNextStreamChunk(ctx context.Context, id common.ObjectID) (common.ObjectID, error)
+	StopStream(ctx context.Context, id common.ObjectID, failed bool) error
+	DropStream(ctx context.Context, id common.ObjectID) error
+}
+
+var (
+	_ Client        = (*IPCClient)(nil)
+	_ Client        = (*RPCClient)(nil)
+	_ ds.IRPCClient = (*RPCClient)(nil)
+)
+
+const (
+	kIPCSocketEnv   = "VINEYARD_IPC_SOCKET"
+	kRPCEndpointEnv = "VINEYARD_RPC_ENDPOINT"
+)
+
+// Connect connects to vineyard at the endpoint, which is either an ipc socket,
+// i.e., "unix:///var/run/vineyard.sock" or a path, or an rpc endpoint, i.e.,
+// "host:port" or "tcp://host:port". When the endpoint is empty, it is read
+// from the environment variable VINEYARD_IPC_SOCKET, then
+// VINEYARD_RPC_ENDPOINT, as the python client does. The options of sessions
+// are only supported by the ipc client.
+func Connect(ctx context.Context, endpoint string, options ...ConnectOption) (Client, error) {
+	if endpoint == "" {
+		if ipcSocket := os.Getenv(kIPCSocketEnv); ipcSocket != "" {
+			return connectIPC(ctx, ipcSocket, options)
+		}
+		if rpcEndpoint := os.Getenv(kRPCEndpointEnv); rpcEndpoint != "" {
+			return connectRPC(ctx, rpcEndpoint, options)
+		}
+		return nil, errors.New("failed to resolve the ipc socket or rpc endpoint of vineyard " +
+			"from the environment variables " + kIPCSocketEnv + " or " + kRPCEndpointEnv)
+	}
+	if ipcSocket := strings.TrimPrefix(endpoint, "unix://"); ipcSocket != endpoint {
+		return connectIPC(ctx, ipcSocket, options)
+	}
+	if rpcEndpoint := strings.TrimPrefix(endpoint, "tcp://"); rpcEndpoint != endpoint {
+		return connectRPC(ctx, rpcEndpoint, options)
+	}
+	if isRPCEndpoint(endpoint) {
+		return connectRPC(ctx, endpoint, options)
+	}
+	return connectIPC(ctx, endpoint, options)
+}
+
+// isRPCEndpoint tells whether the endpoint is a "host:port" rather than the
+// path of a socket.
+func isRPCEndpoint(endpoint string) bool {
+	if strings.Contains(endpoint, "/") {
+		return false
+	}
+	_, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return false
+	}
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+func connectIPC(ctx context.Context, ipcSocket string, options []ConnectOption) (Client, error) {
+	client := &IPCClient{}
+	if err := client.Connect(ctx, ipcSocket, options...); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func connectRPC(ctx context.Context, rpcEndpoint string, options []ConnectOption) (Client, error) {
+	if len(options) > 0 {
+		return nil, errors.New("sessions are not supported by the rpc client: " + rpcEndpoint)
+	}
+	client := &RPCClient{}
+	if err := client.Connect(ctx, rpcEndpoint); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
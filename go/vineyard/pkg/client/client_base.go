@@ -16,9 +16,15 @@ limitations under the License.
 package vineyard
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
 
 	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
 	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
@@ -27,39 +33,215 @@ import (
 type Signature = uint64
 
 type ClientBase struct {
-	// TODO: fix unify connection conn
 	conn       net.Conn
+	codec      *common.Codec
 	connected  bool
 	instanceID common.InstanceID
+
+	// sem serializes the round trips on the connection, a request, its reply
+	// and the fds sent along with the reply are never interleaved with the
+	// ones of other goroutines. Unlike a mutex, waiting for it can be
+	// canceled by the context.
+	sem     chan struct{}
+	semOnce sync.Once
+	// broken marks that the connection failed in the middle of a round trip,
+	// the stream can't be trusted anymore and the connection is re-established
+	// by redial before the next request.
+	broken bool
+	redial func(ctx context.Context) error
+
+	// ctx is the context of the ongoing round trip, see also watch.
+	ctx     context.Context
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// maxMessageSize limits the size of messages on the connection, see also
+	// SetMaxMessageSize.
+	maxMessageSize int
+}
+
+func (c *ClientBase) InstanceID() common.InstanceID {
+	return c.instanceID
+}
+
+// SetMaxMessageSize sets the limit of the size of messages that are sent to
+// and received from vineyard, which is common.DEFAULT_MAX_MESSAGE_SIZE by
+// default. It takes effect on the next connection.
+func (c *ClientBase) SetMaxMessageSize(size int) {
+	c.maxMessageSize = size
+}
+
+// setConn uses the connection for the following round trips.
+func (c *ClientBase) setConn(conn net.Conn) {
+	c.conn = conn
+	c.codec = common.NewCodec(conn, c.maxMessageSize)
+}
+
+// acquire waits for the ongoing round trip of other goroutines.
+func (c *ClientBase) acquire(ctx context.Context) error {
+	c.semOnce.Do(func() {
+		c.sem = make(chan struct{}, 1)
+	})
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *ClientBase) release() {
+	<-c.sem
+}
+
+// lock acquires the connection for a round trip under the context, the broken
+// connection is re-established first. The connected state is checked after
+// acquiring, as Disconnect changes it with the connection acquired.
+func (c *ClientBase) lock(ctx context.Context) error {
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	if !c.connected {
+		c.release()
+		return errNotConnected
+	}
+	if c.broken {
+		if c.redial == nil {
+			c.release()
+			return errors.New("the connection to vineyard is broken")
+		}
+		if err := c.redial(ctx); err != nil {
+			c.release()
+			return fmt.Errorf("failed to reconnect to vineyard: %w", err)
+		}
+		c.broken = false
+	}
+	c.watch(ctx)
+	return nil
+}
+
+func (c *ClientBase) unlock() {
+	c.unwatch()
+	c.release()
+}
+
+var errNotConnected = errors.New("client is not connected")
+
+// aLongTimeAgo is a deadline in the past that unblocks the pending io.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// watch applies the deadline of the context to the connection, and unblocks
+// the pending io on the connection once the context is canceled.
+func (c *ClientBase) watch(ctx context.Context) {
+	c.ctx = ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	}
+	if ctx.Done() == nil {
+		return
+	}
+	c.stop, c.stopped = make(chan struct{}), make(chan struct{})
+	go func(conn net.Conn, stop, stopped chan struct{}) {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}(c.conn, c.stop, c.stopped)
+}
+
+// unwatch stops watching the context and clears the deadline of the
+// connection.
+func (c *ClientBase) unwatch() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.stopped
+		c.stop, c.stopped = nil, nil
+	}
+	if c.ctx != nil && !c.broken {
+		_ = c.conn.SetDeadline(time.Time{})
+	}
+	c.ctx = nil
 }
 
+// markBroken closes the connection after a failed round trip, the remaining
+// bytes of the reply may still be in flight. The error of the context is
+// returned if the round trip is interrupted by the context.
+func (c *ClientBase) markBroken(err error) error {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.broken = true
+	if c.ctx != nil {
+		if ctxErr := c.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if _, ok := c.ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// DoWrite sends the message to vineyard, the caller should hold the lock of
+// the client until the reply is read.
 func (c *ClientBase) DoWrite(msgOut string) error {
-	err := SendMessage(c.conn, msgOut)
-	if err != nil {
-		c.connected = false
+	if err := c.codec.WriteMessage([]byte(msgOut)); err != nil {
+		// nothing has been sent if the message is too large
+		if errors.Is(err, common.ErrMessageTooLarge) {
+			return err
+		}
+		return c.markBroken(err)
 	}
 	return nil
 }
 
+// DoRead receives a message from vineyard, see also DoWrite.
 func (c *ClientBase) DoRead(msg *string) error {
-	return RecvMessage(c.conn, msg)
+	message, err := c.codec.ReadMessage()
+	if err != nil {
+		return c.markBroken(err)
+	}
+	*msg = string(message)
+	return nil
 }
 
-func (c *ClientBase) Disconnect() error {
+func (c *ClientBase) Disconnect(ctx context.Context) error {
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.release()
 	if !c.connected {
 		return nil
 	}
+	return c.disconnect(ctx)
+}
+
+// disconnect tells vineyard that the client exits and closes the connection,
+// the caller should have acquired the connected client.
+func (c *ClientBase) disconnect(ctx context.Context) error {
+	c.connected = false
+	if c.broken {
+		c.broken = false
+		return nil
+	}
+	c.watch(ctx)
+	defer c.unwatch()
 	var messageOut string
 	common.WriteExitRequest(&messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
+		c.broken = false
 		return err
 	}
-	c.conn.Close()
-	c.connected = false
-	return nil
+	return c.conn.Close()
 }
 
-func (c *ClientBase) Persist(id common.ObjectID) error {
+func (c *ClientBase) Persist(ctx context.Context, id common.ObjectID) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
 	var messageOut string
 	common.WritePersistRequest(id, &messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
@@ -76,13 +258,17 @@ func (c *ClientBase) Persist(id common.ObjectID) error {
 		return err
 	}
 
-	if persistReply.Code != 0 || persistReply.Type != common.PERSIST_REQUEST {
-		return errors.New("get persist response from vineyard failed")
+	if persistReply.Code != 0 || persistReply.Type != common.PERSIST_REPLY {
+		return common.NewReplyError(persistReply.Code, persistReply.Type, persistReply.Message)
 	}
 	return nil
 }
 
-func (c *ClientBase) PutName(id common.ObjectID, name string) error {
+func (c *ClientBase) PutName(ctx context.Context, id common.ObjectID, name string) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
 	var messageOut string
 	common.WritePutNameRequest(id, name, &messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
@@ -100,12 +286,18 @@ func (c *ClientBase) PutName(id common.ObjectID, name string) error {
 	}
 
 	if putNameReply.Code != 0 || putNameReply.Type != common.PUT_NAME_REPLY {
-		return &common.ReplyError{Code: putNameReply.Code, Type: putNameReply.Type, Err: err}
+		return common.NewReplyError(putNameReply.Code, putNameReply.Type, putNameReply.Message)
 	}
 	return nil
 }
 
-func (c *ClientBase) GetName(name string, wait bool, id *common.ObjectID) error {
+// GetName resolves the object id of the name. When wait is set it blocks until
+// the name is put by others, or the context is done.
+func (c *ClientBase) GetName(ctx context.Context, name string, wait bool, id *common.ObjectID) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
 	var messageOut string
 	common.WriteGetNameRequest(name, wait, &messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
@@ -123,13 +315,17 @@ func (c *ClientBase) GetName(name string, wait bool, id *common.ObjectID) error
 	}
 
 	if getNameReply.Code != 0 || getNameReply.Type != common.GET_NAME_REPLY {
-		return &common.ReplyError{Code: getNameReply.Code, Type: getNameReply.Type, Err: err}
+		return common.NewReplyError(getNameReply.Code, getNameReply.Type, getNameReply.Message)
 	}
 	*id = getNameReply.RepObjectID
 	return nil
 }
 
-func (c *ClientBase) DropName(name string) error {
+func (c *ClientBase) DropName(ctx context.Context, name string) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
 	var messageOut string
 	common.WriteDropNameRequest(name, &messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
@@ -147,15 +343,20 @@ func (c *ClientBase) DropName(name string) error {
 	}
 
 	if dropNameReply.Code != 0 || dropNameReply.Type != common.DROP_NAME_REPLY {
-		return &common.ReplyError{Code: dropNameReply.Code, Type: dropNameReply.Type, Err: err}
+		return common.NewReplyError(dropNameReply.Code, dropNameReply.Type, dropNameReply.Message)
 	}
 	return nil
 }
 
-func (c *ClientBase) GetData(id common.ObjectID, getDataReply *common.GetDataReply, syncRemote, wait bool) error {
-	if !c.connected {
-		return nil
+func (c *ClientBase) GetData(ctx context.Context, id common.ObjectID, getDataReply *common.GetDataReply, syncRemote, wait bool) error {
+	if err := c.lock(ctx); err != nil {
+		return err
 	}
+	defer c.unlock()
+	return c.getData(id, getDataReply, syncRemote, wait)
+}
+
+func (c *ClientBase) getData(id common.ObjectID, getDataReply *common.GetDataReply, syncRemote, wait bool) error {
 	var messageOut string
 	common.WriteGetDataRequest(id, syncRemote, wait, &messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
@@ -169,20 +370,37 @@ func (c *ClientBase) GetData(id common.ObjectID, getDataReply *common.GetDataRep
 	if err != nil {
 		return err
 	}
+
+	if getDataReply.Code != 0 || getDataReply.Type != common.GET_DATA_REPLY {
+		return common.NewReplyError(getDataReply.Code, getDataReply.Type, getDataReply.Message)
+	}
 	return nil
 }
 
-func (c *ClientBase) SyncMetaData() error {
+func (c *ClientBase) SyncMetaData(ctx context.Context) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	return c.syncMetaData()
+}
+
+func (c *ClientBase) syncMetaData() error {
 	var getDataReply common.GetDataReply
-	return c.GetData(common.InvalidObjectID(), &getDataReply, true, false)
+	return c.getData(common.InvalidObjectID(), &getDataReply, true, false)
 }
 
-func (c *ClientBase) CreateData(tree interface{}, id *common.ObjectID, signature *Signature, instanceID *common.InstanceID) error {
-	if !c.connected {
-		return nil
+func (c *ClientBase) CreateData(ctx context.Context, tree interface{}, id *common.ObjectID, signature *Signature, instanceID *common.InstanceID) error {
+	if err := c.lock(ctx); err != nil {
+		return err
 	}
+	defer c.unlock()
+	return c.createData(tree, id, signature, instanceID)
+}
+
+func (c *ClientBase) createData(tree interface{}, id *common.ObjectID, signature *Signature, instanceID *common.InstanceID) error {
 	var messageOut string
-	common.WriteCreateDataRequest(id, &messageOut)
+	common.WriteCreateDataRequest(tree, &messageOut)
 	if err := c.DoWrite(messageOut); err != nil {
 		return err
 	}
@@ -195,49 +413,293 @@ func (c *ClientBase) CreateData(tree interface{}, id *common.ObjectID, signature
 	if err != nil {
 		return err
 	}
-	id = &createDataReply.ID
-	signature = &createDataReply.Signature
-	instanceID = &createDataReply.InstanceID
+	if createDataReply.Code != 0 || createDataReply.Type != common.CREAT_DATA_REPLY {
+		return common.NewReplyError(createDataReply.Code, createDataReply.Type, createDataReply.Message)
+	}
+	*id = createDataReply.ID
+	*signature = createDataReply.Signature
+	*instanceID = createDataReply.InstanceID
 	return nil
 }
 
-func (c *ClientBase) GetMetaData(id common.ObjectID, meta *vineyard.ObjectMeta, syncRemote bool) {
-	if !c.connected {
-		return
+// GetMetaData fetches the metadata tree of the given object from vineyard, the
+// blobs referenced by the tree are recorded in the meta's buffer set but their
+// payloads are not fetched.
+func (c *ClientBase) GetMetaData(ctx context.Context, id common.ObjectID, meta *vineyard.ObjectMeta, syncRemote bool) error {
+	if err := c.lock(ctx); err != nil {
+		return err
 	}
+	defer c.unlock()
+	return c.getMetaData(id, meta, syncRemote)
+}
+
+func (c *ClientBase) getMetaData(id common.ObjectID, meta *vineyard.ObjectMeta, syncRemote bool) error {
 	var getDataReply common.GetDataReply
-	err := c.GetData(id, &getDataReply, syncRemote, false)
+	if err := c.getData(id, &getDataReply, syncRemote, false); err != nil {
+		return err
+	}
+	content, ok := getDataReply.Content[common.ObjectIDToString(id)]
+	if !ok {
+		return common.NewReplyError(common.KObjectNotExists, getDataReply.Type,
+			fmt.Sprintf("failed to read get_data reply for %s", common.ObjectIDToString(id)))
+	}
+	tree, err := vineyard.ParseMetaData(content)
 	if err != nil {
-		return
+		return err
 	}
 	meta.Reset()
-	//meta.SetMetaData(*i, getDataReply) // TODO: how to set
-	// TODO
-	return
+	meta.SetMetaData(c, tree)
+	return nil
 }
 
-func (c *ClientBase) CreateMetaData(metaData *vineyard.ObjectMeta, id common.ObjectID) {
+// CreateMetaData creates the object described by the metadata in vineyard,
+// the id, signature and instance id assigned by the server are filled back to
+// the metadata. If the metadata refers to members by id only, it is replaced
+// with the complete metadata tree fetched from the server.
+func (c *ClientBase) CreateMetaData(ctx context.Context, metaData *vineyard.ObjectMeta) (common.ObjectID, error) {
+	if err := c.lock(ctx); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	defer c.unlock()
 	var instanceID common.InstanceID = c.instanceID
-	metaData.Init()
+	if metaData.MetaData() == nil {
+		metaData.Init()
+	}
 	metaData.SetInstanceId(instanceID)
+	metaData.AddKeyValue("transient", true)
+	// add the key from env to the metadata for k8s environment.
+	for _, label := range []string{"JOB_NAME", "POD_NAME", "POD_NAMESPACE"} {
+		if value := os.Getenv(label); value != "" {
+			metaData.AddKeyValue(label, value)
+		}
+	}
+	// nbytes is optional
 	if !metaData.HasKey("nbytes") {
 		metaData.SetNBytes(0)
 	}
+	// if the metadata has incomplete components, trigger an remote meta sync.
 	if metaData.InComplete() {
-		c.SyncMetaData() // TODO: check correctness
+		if err := c.syncMetaData(); err != nil {
+			return common.InvalidObjectID(), err
+		}
 	}
+	var id common.ObjectID
 	var signature Signature
-	err := c.CreateData(metaData.MetaData(), &id, &signature, &instanceID)
-	if err != nil {
-		metaData.SetId(id)
-		metaData.SetSignature(signature)
-		// metaData.SetClient(c) // TODO: fix type not match
-		metaData.SetInstanceId(instanceID)
-		if metaData.InComplete() {
-			var resultMeta vineyard.ObjectMeta
-			c.GetMetaData(id, &resultMeta, false)
-			metaData = &resultMeta
+	if err := c.createData(metaData.MetaData(), &id, &signature, &instanceID); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	metaData.SetId(id)
+	metaData.SetSignature(signature)
+	metaData.SetClient(c)
+	metaData.SetInstanceId(instanceID)
+	if metaData.InComplete() {
+		var resultMeta vineyard.ObjectMeta
+		if err := c.getMetaData(id, &resultMeta, false); err != nil {
+			return id, err
+		}
+		*metaData = resultMeta
+	}
+	return id, nil
+}
+
+// ListData lists the metadata of the objects whose typename matches the
+// pattern, which is a glob pattern or a regular expression if regex is set.
+// At most limit objects are returned.
+func (c *ClientBase) ListData(ctx context.Context, pattern string, regex bool, limit int) ([]*vineyard.ObjectMeta, error) {
+	if err := c.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteListDataRequest(pattern, regex, limit, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return nil, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return nil, err
+	}
+	var getDataReply common.GetDataReply
+	if err := json.Unmarshal([]byte(messageIn), &getDataReply); err != nil {
+		return nil, err
+	}
+	if getDataReply.Code != 0 || getDataReply.Type != common.GET_DATA_REPLY {
+		return nil, common.NewReplyError(getDataReply.Code, getDataReply.Type, getDataReply.Message)
+	}
+
+	keys := make([]string, 0, len(getDataReply.Content))
+	for key := range getDataReply.Content {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	metas := make([]*vineyard.ObjectMeta, 0, len(keys))
+	for _, key := range keys {
+		tree, err := vineyard.ParseMetaData(getDataReply.Content[key])
+		if err != nil {
+			return nil, err
 		}
+		meta := &vineyard.ObjectMeta{}
+		meta.SetMetaData(c, tree)
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+// Exists checks whether the object exists in vineyard.
+func (c *ClientBase) Exists(ctx context.Context, id common.ObjectID) (bool, error) {
+	if err := c.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteExistsRequest(id, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return false, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return false, err
+	}
+	var existsReply common.ExistsReply
+	if err := json.Unmarshal([]byte(messageIn), &existsReply); err != nil {
+		return false, err
+	}
+	if existsReply.Code != 0 || existsReply.Type != common.EXISTS_REPLY {
+		return false, common.NewReplyError(existsReply.Code, existsReply.Type, existsReply.Message)
+	}
+	return existsReply.Exists, nil
+}
+
+// DelData deletes the objects from vineyard. The objects that are still
+// referenced by others are kept unless force is set, and the members of the
+// objects are deleted as well if deep is set.
+func (c *ClientBase) DelData(ctx context.Context, ids []common.ObjectID, force, deep bool) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteDelDataRequest(ids, force, deep, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var delDataReply common.DelDataReply
+	if err := json.Unmarshal([]byte(messageIn), &delDataReply); err != nil {
+		return err
+	}
+	if delDataReply.Code != 0 || delDataReply.Type != common.DEL_DATA_REPLY {
+		return common.NewReplyError(delDataReply.Code, delDataReply.Type, delDataReply.Message)
+	}
+	return nil
+}
+
+// IfPersist checks whether the object has been persisted.
+func (c *ClientBase) IfPersist(ctx context.Context, id common.ObjectID) (bool, error) {
+	if err := c.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteIfPersistRequest(id, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return false, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return false, err
+	}
+	var ifPersistReply common.IfPersistReply
+	if err := json.Unmarshal([]byte(messageIn), &ifPersistReply); err != nil {
+		return false, err
+	}
+	if ifPersistReply.Code != 0 || ifPersistReply.Type != common.IF_PERSIST_REPLY {
+		return false, common.NewReplyError(ifPersistReply.Code, ifPersistReply.Type, ifPersistReply.Message)
+	}
+	return ifPersistReply.Persist, nil
+}
+
+// ShallowCopy creates a new object that shares the members with the given
+// object, and returns the id of the new object.
+func (c *ClientBase) ShallowCopy(ctx context.Context, id common.ObjectID) (common.ObjectID, error) {
+	if err := c.lock(ctx); err != nil {
+		return common.InvalidObjectID(), err
 	}
-	return
+	defer c.unlock()
+	var messageOut string
+	common.WriteShallowCopyRequest(id, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var shallowCopyReply common.ShallowCopyReply
+	if err := json.Unmarshal([]byte(messageIn), &shallowCopyReply); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if shallowCopyReply.Code != 0 || shallowCopyReply.Type != common.SHALLOW_COPY_REPLY {
+		return common.InvalidObjectID(), common.NewReplyError(
+			shallowCopyReply.Code, shallowCopyReply.Type, shallowCopyReply.Message)
+	}
+	return shallowCopyReply.TargetID, nil
+}
+
+// ListNames lists the names that match the pattern, which is a glob pattern
+// or a regular expression if regex is set, with the ids of the named objects.
+// At most limit names are returned.
+func (c *ClientBase) ListNames(ctx context.Context, pattern string, regex bool, limit int) (map[string]common.ObjectID, error) {
+	if err := c.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteListNameRequest(pattern, regex, limit, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return nil, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return nil, err
+	}
+	var listNameReply common.ListNameReply
+	if err := json.Unmarshal([]byte(messageIn), &listNameReply); err != nil {
+		return nil, err
+	}
+	if listNameReply.Code != 0 || listNameReply.Type != common.LIST_NAME_REPLY {
+		return nil, common.NewReplyError(listNameReply.Code, listNameReply.Type, listNameReply.Message)
+	}
+	if listNameReply.Names == nil {
+		listNameReply.Names = make(map[string]common.ObjectID)
+	}
+	return listNameReply.Names, nil
+}
+
+// Clear deletes all objects in vineyard.
+func (c *ClientBase) Clear(ctx context.Context) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteClearRequest(&messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var clearReply common.ClearReply
+	if err := json.Unmarshal([]byte(messageIn), &clearReply); err != nil {
+		return err
+	}
+	if clearReply.Code != 0 || clearReply.Type != common.CLEAR_REPLY {
+		return common.NewReplyError(clearReply.Code, clearReply.Type, clearReply.Message)
+	}
+	return nil
 }
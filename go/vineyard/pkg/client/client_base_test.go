@@ -0,0 +1,306 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// serveGetName replies the get_name requests on the connection with the
+// number in the name as the object id, it closes the connection without
+// replying after serving the given number of requests.
+func serveGetName(conn net.Conn, requests int) {
+	defer conn.Close()
+	for served := 0; requests < 0 || served < requests; served++ {
+		var messageIn string
+		if err := RecvMessage(conn, &messageIn); err != nil {
+			return
+		}
+		var request common.GetNameRequest
+		if err := json.Unmarshal([]byte(messageIn), &request); err != nil {
+			return
+		}
+		var reply []byte
+		if id, err := strconv.ParseUint(request.Name, 10, 64); err == nil {
+			reply, _ = json.Marshal(common.GetNameReply{Type: common.GET_NAME_REPLY, RepObjectID: id})
+		} else {
+			reply, _ = json.Marshal(common.GetNameReply{
+				Type:    common.GET_NAME_REPLY,
+				Code:    common.KObjectNotExists,
+				Message: "failed to find name: " + request.Name,
+			})
+		}
+		if err := SendMessage(conn, string(reply)); err != nil {
+			return
+		}
+	}
+	var messageIn string
+	_ = RecvMessage(conn, &messageIn)
+}
+
+// serveNothing reads the requests on the connection but never replies.
+func serveNothing(conn net.Conn) {
+	defer conn.Close()
+	var messageIn string
+	for RecvMessage(conn, &messageIn) == nil {
+	}
+}
+
+func newPipeClient(serve func(conn net.Conn)) *ClientBase {
+	client := &ClientBase{}
+	connectPipe(client, serve)
+	return client
+}
+
+// connectPipe connects the client to the server over a pipe, the server is
+// started again when the client reconnects.
+func connectPipe(client *ClientBase, serve func(conn net.Conn)) {
+	client.connected = true
+	client.redial = func(ctx context.Context) error {
+		local, remote := net.Pipe()
+		go serve(remote)
+		client.setConn(local)
+		return nil
+	}
+	_ = client.redial(context.Background())
+}
+
+func TestClientBase_ConcurrentRequests(t *testing.T) {
+	client := newPipeClient(func(conn net.Conn) {
+		serveGetName(conn, -1)
+	})
+	defer client.conn.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for k := 0; k < 50; k++ {
+				expected := common.ObjectID(g*1000 + k)
+				var id common.ObjectID
+				if err := client.GetName(context.Background(), fmt.Sprint(expected), false, &id); err != nil {
+					errs <- err
+					return
+				}
+				if id != expected {
+					errs <- fmt.Errorf("unexpected reply: %d != %d", id, expected)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestClientBase_ReplyError(t *testing.T) {
+	client := newPipeClient(func(conn net.Conn) {
+		serveGetName(conn, -1)
+	})
+	defer client.conn.Close()
+
+	var id common.ObjectID
+	err := client.GetName(context.Background(), "undefined_name", false, &id)
+	if !errors.Is(err, common.ErrObjectNotExists) {
+		t.Fatal("expect the object not exists error", err)
+	}
+	var status *common.Status
+	if !errors.As(err, &status) || status.Message != "failed to find name: undefined_name" {
+		t.Error("unexpected status", status)
+	}
+	// the connection is still usable after an error reply
+	if err := client.GetName(context.Background(), "1", false, &id); err != nil || id != 1 {
+		t.Error("get name failed", id, err)
+	}
+}
+
+func TestClientBase_Reconnect(t *testing.T) {
+	ctx := context.Background()
+	client := newPipeClient(func(conn net.Conn) {
+		serveGetName(conn, 1)
+	})
+	defer func() {
+		client.conn.Close()
+	}()
+
+	var id common.ObjectID
+	if err := client.GetName(ctx, "1", false, &id); err != nil || id != 1 {
+		t.Fatal("get name failed", id, err)
+	}
+	// the server drops the connection in the middle of the round trip
+	if err := client.GetName(ctx, "2", false, &id); err == nil {
+		t.Fatal("expect an error when the connection is broken")
+	}
+	if !client.broken {
+		t.Fatal("the connection should be marked as broken")
+	}
+	// the next request goes through a new connection
+	if err := client.GetName(ctx, "3", false, &id); err != nil || id != 3 {
+		t.Fatal("get name after reconnecting failed", id, err)
+	}
+	if client.broken {
+		t.Fatal("the connection should have been re-established")
+	}
+}
+
+func TestClientBase_Cancel(t *testing.T) {
+	// the server never replies, as a get_name request with wait
+	client := newPipeClient(serveNothing)
+	defer func() {
+		client.conn.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	var id common.ObjectID
+	if err := client.GetName(ctx, "1", true, &id); !errors.Is(err, context.Canceled) {
+		t.Fatal("expect the waiting call to be canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.GetName(ctx, "2", true, &id); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expect the waiting call to exceed the deadline", err)
+	}
+
+	// the waiters for the connection are canceled as well
+	if err := client.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.GetName(ctx, "3", false, &id); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expect the pending call to exceed the deadline", err)
+	}
+	client.release()
+}
+
+// serveRequests replies the requests on the connection with the handler.
+func serveRequests(conn net.Conn, handler func(request map[string]interface{}) interface{}) {
+	defer conn.Close()
+	for {
+		var messageIn string
+		if err := RecvMessage(conn, &messageIn); err != nil {
+			return
+		}
+		request := make(map[string]interface{})
+		decoder := json.NewDecoder(strings.NewReader(messageIn))
+		decoder.UseNumber()
+		if err := decoder.Decode(&request); err != nil {
+			return
+		}
+		reply, _ := json.Marshal(handler(request))
+		if err := SendMessage(conn, string(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func TestClientBase_ObjectRequests(t *testing.T) {
+	ctx := context.Background()
+	var requests []map[string]interface{}
+	client := newPipeClient(func(conn net.Conn) {
+		serveRequests(conn, func(request map[string]interface{}) interface{} {
+			requests = append(requests, request)
+			switch request["type"] {
+			case common.LIST_DATA_REQUEST:
+				return map[string]interface{}{
+					"type": common.GET_DATA_REPLY,
+					"content": map[string]interface{}{
+						"o0000000000000002": map[string]interface{}{
+							"id": "o0000000000000002", "typename": "vineyard::Tensor<double>", "instance_id": 0,
+						},
+						"o0000000000000001": map[string]interface{}{
+							"id": "o0000000000000001", "typename": "vineyard::Tensor<int>", "instance_id": 0,
+						},
+					},
+				}
+			case common.EXISTS_REQUEST:
+				return common.ExistsReply{Type: common.EXISTS_REPLY, Exists: true}
+			case common.IF_PERSIST_REQUEST:
+				return common.IfPersistReply{Type: common.IF_PERSIST_REPLY}
+			case common.SHALLOW_COPY_REQUEST:
+				return common.ShallowCopyReply{Type: common.SHALLOW_COPY_REPLY, TargetID: 42}
+			case common.LIST_NAME_REQUEST:
+				return common.ListNameReply{Type: common.LIST_NAME_REPLY, Size: 1, Names: map[string]common.ObjectID{"a": 1}}
+			case common.DEL_DATA_REQUEST:
+				return common.DelDataReply{
+					Type:    common.DEL_DATA_REPLY,
+					Code:    common.KObjectNotExists,
+					Message: "the object doesn't exist",
+				}
+			case common.CLEAR_REQUEST:
+				return common.ClearReply{Type: common.CLEAR_REPLY}
+			}
+			return common.ClearReply{Type: "unknown_reply", Code: common.KNotImplemented}
+		})
+	})
+	defer client.conn.Close()
+
+	metas, err := client.ListData(ctx, "vineyard::Tensor<*>", false, 5)
+	if err != nil {
+		t.Fatal("list data failed", err)
+	}
+	if len(metas) != 2 || metas[0].Typename() != "vineyard::Tensor<int>" {
+		t.Fatal("unexpected metadata", metas)
+	}
+	if pattern := requests[0]["pattern"]; pattern != "vineyard::Tensor<*>" {
+		t.Error("unexpected pattern", pattern)
+	}
+
+	if exists, err := client.Exists(ctx, 1); err != nil || !exists {
+		t.Error("the object should exist", err)
+	}
+	if persist, err := client.IfPersist(ctx, 1); err != nil || persist {
+		t.Error("the object shouldn't be persisted", err)
+	}
+	if id, err := client.ShallowCopy(ctx, 1); err != nil || id != 42 {
+		t.Error("shallow copy failed", id, err)
+	}
+	if names, err := client.ListNames(ctx, "*", false, 5); err != nil || names["a"] != 1 {
+		t.Error("list names failed", names, err)
+	}
+	err = client.DelData(ctx, []common.ObjectID{1, 2}, true, false)
+	if !errors.Is(err, common.ErrObjectNotExists) {
+		t.Error("expect the object not exists error", err)
+	}
+	request := requests[len(requests)-1]
+	if request["force"] != true || request["deep"] != false || len(request["id"].([]interface{})) != 2 {
+		t.Error("unexpected del data request", request)
+	}
+	if err := client.Clear(ctx); err != nil {
+		t.Error("clear failed", err)
+	}
+}
@@ -0,0 +1,152 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// newIPCClient connects an ipc client to the server, the client is disconnected
+// when the test completes.
+func newIPCClient(t *testing.T, server *vineyardtest.Server, options ...ConnectOption) *IPCClient {
+	t.Helper()
+	var client IPCClient
+	if err := client.Connect(vineyardtest.Context(t), server.IPCSocket(), options...); err != nil {
+		t.Fatal("connect to ipc server failed", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Disconnect(context.Background())
+	})
+	return &client
+}
+
+// newRPCClient connects an rpc client to the server, the client is disconnected
+// when the test completes.
+func newRPCClient(t *testing.T, server *vineyardtest.Server) *RPCClient {
+	t.Helper()
+	var client RPCClient
+	if err := client.Connect(vineyardtest.Context(t), server.RPCEndpoint()); err != nil {
+		t.Fatal("connect to rpc server failed", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Disconnect(context.Background())
+	})
+	return &client
+}
+
+func TestClient_IsRPCEndpoint(t *testing.T) {
+	cases := map[string]bool{
+		"localhost:9600":          true,
+		"127.0.0.1:9600":          true,
+		"[::1]:9600":              true,
+		"/var/run/vineyard.sock":  false,
+		"vineyard.sock":           false,
+		"localhost:port":          false,
+		"./vineyard:9600":         false,
+		"/tmp/vineyard.sock:9600": false,
+	}
+	for endpoint, expected := range cases {
+		if isRPCEndpoint(endpoint) != expected {
+			t.Errorf("unexpected endpoint kind of %s, expect rpc: %v", endpoint, expected)
+		}
+	}
+}
+
+func TestClient_ConnectFromEnv(t *testing.T) {
+	t.Setenv(kIPCSocketEnv, "")
+	t.Setenv(kRPCEndpointEnv, "")
+	if _, err := Connect(context.Background(), ""); err == nil {
+		t.Error("expect an error when the environment variables are not set")
+	}
+}
+
+func TestClient_Connect(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	endpoints := map[string]bool{
+		server.IPCSocket():              false,
+		"unix://" + server.IPCSocket():  false,
+		server.RPCEndpoint():            true,
+		"tcp://" + server.RPCEndpoint(): true,
+	}
+	for endpoint, rpc := range endpoints {
+		client, err := Connect(ctx, endpoint)
+		if err != nil {
+			t.Fatal("connect to vineyard failed", endpoint, err)
+		}
+		if _, ok := client.(*RPCClient); ok != rpc {
+			t.Errorf("unexpected client %T for %s", client, endpoint)
+		}
+		if client.InstanceID() != server.InstanceID() {
+			t.Error("the instance id is not match", client.InstanceID())
+		}
+		if err := client.Disconnect(ctx); err != nil {
+			t.Error("disconnect failed", err)
+		}
+	}
+
+	t.Setenv(kIPCSocketEnv, "")
+	t.Setenv(kRPCEndpointEnv, server.RPCEndpoint())
+	client, err := Connect(ctx, "")
+	if err != nil {
+		t.Fatal("connect to vineyard from the environment failed", err)
+	}
+	if _, ok := client.(*RPCClient); !ok {
+		t.Errorf("unexpected client %T", client)
+	}
+	_ = client.Disconnect(ctx)
+}
+
+func TestClient_IncompatibleServer(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, &vineyardtest.Options{Version: "0.1.0"})
+	for _, endpoint := range []string{server.IPCSocket(), server.RPCEndpoint()} {
+		client, err := Connect(ctx, endpoint)
+		if !errors.Is(err, common.ErrIncompatibleServer) {
+			t.Error("expect the server to be incompatible", endpoint, err)
+		}
+		if client != nil {
+			t.Error("no client should be returned", endpoint)
+		}
+	}
+}
+
+func TestClient_MaxMessageSize(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	var client RPCClient
+	client.SetMaxMessageSize(4096)
+	if err := client.Connect(ctx, server.RPCEndpoint()); err != nil {
+		t.Fatal("connect to rpc server failed", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	name := strings.Repeat("x", 8192)
+	if err := client.PutName(ctx, common.EmptyBlobID(), name); !errors.Is(err, common.ErrMessageTooLarge) {
+		t.Error("expect the request to be too large", err)
+	}
+	// the connection stays usable as nothing has been sent
+	var id common.ObjectID
+	if err := client.GetName(ctx, "test_max_message_size", false, &id); !errors.Is(err, common.ErrObjectNotExists) {
+		t.Error("expect the name to not exist", err)
+	}
+}
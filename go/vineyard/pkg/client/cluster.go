@@ -0,0 +1,100 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// InstanceInfo describes an instance of the vineyard cluster, as registered in
+// the "instances" subtree of the metadata.
+type InstanceInfo struct {
+	InstanceID  common.InstanceID `json:"-"`
+	Hostname    string            `json:"hostname"`
+	Nodename    string            `json:"nodename"`
+	IPCSocket   string            `json:"ipc_socket"`
+	RPCEndpoint string            `json:"rpc_endpoint"`
+}
+
+// InstanceStatus returns the status of the vineyard instance that the client
+// is connected to.
+func (c *ClientBase) InstanceStatus(ctx context.Context) (*common.InstanceStatus, error) {
+	if err := c.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteInstanceStatusRequest(&messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return nil, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return nil, err
+	}
+	var instanceStatusReply common.InstanceStatusReply
+	if err := json.Unmarshal([]byte(messageIn), &instanceStatusReply); err != nil {
+		return nil, err
+	}
+	if instanceStatusReply.Code != 0 || instanceStatusReply.Type != common.INSTANCE_STATUS_REPLY {
+		return nil, common.NewReplyError(instanceStatusReply.Code, instanceStatusReply.Type, instanceStatusReply.Message)
+	}
+	return &instanceStatusReply.Meta, nil
+}
+
+// ClusterInfo returns the instances of the vineyard cluster, keyed by the
+// instance ids. The metadata is synchronized with other instances first.
+func (c *ClientBase) ClusterInfo(ctx context.Context) (map[common.InstanceID]*InstanceInfo, error) {
+	if err := c.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	// the whole metadata tree is replied for the invalid object id
+	var getDataReply common.GetDataReply
+	if err := c.getData(common.InvalidObjectID(), &getDataReply, true, false); err != nil {
+		return nil, err
+	}
+	content, ok := getDataReply.Content[common.ObjectIDToString(common.InvalidObjectID())]
+	if !ok {
+		return nil, errors.New("the metadata of the cluster is not replied")
+	}
+	var tree struct {
+		Instances map[string]*InstanceInfo `json:"instances"`
+	}
+	if err := json.Unmarshal(content, &tree); err != nil {
+		return nil, err
+	}
+	instances := make(map[common.InstanceID]*InstanceInfo, len(tree.Instances))
+	for key, instance := range tree.Instances {
+		if !strings.HasPrefix(key, "i") || instance == nil {
+			continue
+		}
+		id, err := strconv.ParseUint(key[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance %q in the metadata: %w", key, err)
+		}
+		instance.InstanceID = common.InstanceID(id)
+		instances[instance.InstanceID] = instance
+	}
+	return instances, nil
+}
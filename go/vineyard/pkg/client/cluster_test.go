@@ -0,0 +1,93 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+func TestClientBase_InstanceStatus(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	ipcClient := newIPCClient(t, server)
+	rpcClient := newRPCClient(t, server)
+
+	status, err := ipcClient.InstanceStatus(ctx)
+	if err != nil {
+		t.Fatal("get instance status failed", err)
+	}
+	if status.InstanceID != server.InstanceID() || status.MemoryLimit == 0 || status.MemoryUsage != 0 {
+		t.Error("unexpected instance status", status)
+	}
+	if status.IPCConnections != 1 || status.RPCConnections != 1 {
+		t.Error("unexpected connections", status.IPCConnections, status.RPCConnections)
+	}
+
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 1024, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	if status, err = rpcClient.InstanceStatus(ctx); err != nil {
+		t.Fatal("get instance status failed", err)
+	}
+	if status.MemoryUsage < 1024 {
+		t.Error("the memory of the blob is not counted", status.MemoryUsage)
+	}
+
+	// the request waiting for the name is deferred
+	waitCtx, waitCancel := context.WithCancel(ctx)
+	defer waitCancel()
+	go func() {
+		var id common.ObjectID
+		_ = rpcClient.GetName(waitCtx, "test_instance_status", true, &id)
+	}()
+	for status.DeferredRequests == 0 {
+		time.Sleep(10 * time.Millisecond)
+		if status, err = ipcClient.InstanceStatus(ctx); err != nil {
+			t.Fatal("get instance status failed", err)
+		}
+	}
+}
+
+func TestClientBase_ClusterInfo(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	for _, endpoint := range []string{server.IPCSocket(), server.RPCEndpoint()} {
+		client, err := Connect(ctx, endpoint)
+		if err != nil {
+			t.Fatal("connect to vineyard failed", err)
+		}
+		instances, err := client.ClusterInfo(ctx)
+		client.Disconnect(context.Background())
+		if err != nil {
+			t.Fatal("get cluster info failed", err)
+		}
+		instance, ok := instances[server.InstanceID()]
+		if len(instances) != 1 || !ok {
+			t.Fatal("unexpected instances", instances)
+		}
+		if instance.InstanceID != server.InstanceID() || instance.IPCSocket != server.IPCSocket() ||
+			instance.RPCEndpoint != server.RPCEndpoint() || instance.Hostname == "" {
+			t.Error("unexpected instance", instance)
+		}
+	}
+}
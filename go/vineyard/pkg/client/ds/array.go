@@ -1,9 +1,15 @@
 package ds
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
 
+	"github.com/apache/arrow/go/arrow"
 	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
 	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
 )
 
@@ -19,50 +25,418 @@ func (o *ObjectBuilder) SetSeal(seal bool) {
 	o.sealed = seal
 }
 
+// the value types of `vineyard::NumericArray<T>`, named as the C++ client
+var numericTypeNames = map[arrow.Type]string{
+	arrow.INT8:    "signed char",
+	arrow.UINT8:   "unsigned char",
+	arrow.INT16:   "short",
+	arrow.UINT16:  "unsigned short",
+	arrow.INT32:   "int",
+	arrow.UINT32:  "uint",
+	arrow.INT64:   "int64",
+	arrow.UINT64:  "uint64",
+	arrow.FLOAT32: "float",
+	arrow.FLOAT64: "double",
+}
+
+// the value types of `vineyard::NumericArray<T>`, including the spellings
+// used by the Python client
+var numericTypes = map[string]arrow.DataType{
+	"signed char":    arrow.PrimitiveTypes.Int8,
+	"int8":           arrow.PrimitiveTypes.Int8,
+	"int8_t":         arrow.PrimitiveTypes.Int8,
+	"unsigned char":  arrow.PrimitiveTypes.Uint8,
+	"uint8":          arrow.PrimitiveTypes.Uint8,
+	"uint8_t":        arrow.PrimitiveTypes.Uint8,
+	"short":          arrow.PrimitiveTypes.Int16,
+	"int16":          arrow.PrimitiveTypes.Int16,
+	"int16_t":        arrow.PrimitiveTypes.Int16,
+	"unsigned short": arrow.PrimitiveTypes.Uint16,
+	"uint16":         arrow.PrimitiveTypes.Uint16,
+	"uint16_t":       arrow.PrimitiveTypes.Uint16,
+	"int":            arrow.PrimitiveTypes.Int32,
+	"int32":          arrow.PrimitiveTypes.Int32,
+	"int32_t":        arrow.PrimitiveTypes.Int32,
+	"uint":           arrow.PrimitiveTypes.Uint32,
+	"uint32":         arrow.PrimitiveTypes.Uint32,
+	"uint32_t":       arrow.PrimitiveTypes.Uint32,
+	"int64":          arrow.PrimitiveTypes.Int64,
+	"int64_t":        arrow.PrimitiveTypes.Int64,
+	"uint64":         arrow.PrimitiveTypes.Uint64,
+	"uint64_t":       arrow.PrimitiveTypes.Uint64,
+	"float":          arrow.PrimitiveTypes.Float32,
+	"float32":        arrow.PrimitiveTypes.Float32,
+	"double":         arrow.PrimitiveTypes.Float64,
+	"float64":        arrow.PrimitiveTypes.Float64,
+}
+
+const (
+	numericArrayTypename         = "vineyard::NumericArray<%s>"
+	booleanArrayTypename         = "vineyard::BooleanArray"
+	stringArrayTypename          = "vineyard::BaseBinaryArray<arrow::LargeStringArray>"
+	binaryArrayTypename          = "vineyard::BaseBinaryArray<arrow::LargeBinaryArray>"
+	fixedSizeBinaryArrayTypename = "vineyard::FixedSizeBinaryArray"
+	nullArrayTypename            = "vineyard::NullArray"
+	listArrayTypename            = "vineyard::BaseListArray<arrow::LargeListArray>"
+	fixedSizeListArrayTypename   = "vineyard::FixedSizeListArray"
+)
+
+var numericArrayPattern = regexp.MustCompile(`^vineyard::NumericArray<(.+)>$`)
+
+// ArrayBuilder writes an arrow array to vineyard in the same layout as the
+// C++ builders, so that the array can be read by the C++ and Python clients.
+//
+// Strings, binaries and lists are written as their large variants, i.e.,
+// with 64-bit offsets.
 type ArrayBuilder struct {
 	ArrayBaseBuilder
 
-	Array      *array.FixedSizeList
-	Client     IIPCClient
-	blobWriter BlobWriter
+	Array  array.Interface
+	Client IIPCClient
 
-	length    int
-	nullCount int
-	offset    int
-	buffer    []byte
-	//nullBitmap []byte
+	meta ObjectMeta
+	id   common.ObjectID
 }
 
-func (a *ArrayBuilder) Init(client IIPCClient, array *array.FixedSizeList) {
+func (a *ArrayBuilder) Init(client IIPCClient, arr array.Interface) {
 	a.Client = client
-	a.Array = array
+	a.Array = arr
+	a.id = common.InvalidObjectID()
 }
 
-func (a *ArrayBuilder) Seal() {
+// Seal builds the array and creates it in vineyard.
+func (a *ArrayBuilder) Seal(ctx context.Context) error {
 	if a.sealed {
-		fmt.Println("The builder has been already been sealed")
-		return
+		return errors.New("the builder has been already sealed")
 	}
-	if err := a.Build(); err != nil {
-		fmt.Println("ArrayBuilder Build Failed: ", err)
+	if err := a.Build(ctx); err != nil {
+		return err
 	}
-
+	id, err := a.Client.CreateMetaData(ctx, &a.meta)
+	if err != nil {
+		return err
+	}
+	a.id = id
 	a.SetSeal(true)
+	return nil
 }
 
-func (a *ArrayBuilder) Build() error {
+// Build copies the buffers of the array to blobs and fills the metadata,
+// the member arrays (e.g., values of lists) are sealed during building.
+func (a *ArrayBuilder) Build(ctx context.Context) error {
+	a.meta.Init()
+	a.meta.AddKeyValue("length_", a.Array.Len())
 
-	//blobWriter
-	a.Client.CreateBlob(a.Array.Data().Len(), &a.blobWriter)
+	data := a.Array.Data()
+	dtype := a.Array.DataType()
+	switch dtype.ID() {
+	case arrow.NULL:
+		a.meta.SetTypename(nullArrayTypename)
+		a.meta.SetNBytes(0)
+		return nil
+	case arrow.FIXED_SIZE_LIST:
+		// the fixed size list array in vineyard has neither nulls nor offset
+		listSize := int64(dtype.(*arrow.FixedSizeListType).Len())
+		offset, length := int64(a.Array.Data().Offset()), int64(a.Array.Len())
+		listValues := a.Array.(*array.FixedSizeList).ListValues()
+		if int64(listValues.Len()) < (offset+length)*listSize {
+			return fmt.Errorf("the fixed size list array has %d values, expect %d",
+				listValues.Len(), (offset+length)*listSize)
+		}
+		values := array.NewSlice(listValues, offset*listSize, (offset+length)*listSize)
+		defer values.Release()
 
-	a.length = a.Array.Len()
-	a.nullCount = a.Array.NullN()
-	a.offset = a.Array.Offset()
-	a.buffer = a.blobWriter.Buf()
-	// TODO: build null bit map
-	return nil
+		a.meta.SetTypename(fixedSizeListArrayTypename)
+		a.meta.AddKeyValue("list_size_", listSize)
+		a.meta.SetNBytes(0)
+		return a.addArray(ctx, "values_", values)
+	}
+
+	a.meta.AddKeyValue("null_count_", a.Array.NullN())
+	a.meta.AddKeyValue("offset_", a.Array.Data().Offset())
+	a.meta.SetNBytes(0)
+	switch dtype.ID() {
+	case arrow.INT8, arrow.UINT8, arrow.INT16, arrow.UINT16, arrow.INT32,
+		arrow.UINT32, arrow.INT64, arrow.UINT64, arrow.FLOAT32, arrow.FLOAT64:
+		a.meta.SetTypename(fmt.Sprintf(numericArrayTypename, numericTypeNames[dtype.ID()]))
+		if err := a.addBuffer(ctx, "buffer_", bufferBytes(data, 1)); err != nil {
+			return err
+		}
+	case arrow.BOOL:
+		a.meta.SetTypename(booleanArrayTypename)
+		if err := a.addBuffer(ctx, "buffer_", bufferBytes(data, 1)); err != nil {
+			return err
+		}
+	case arrow.STRING, arrow.BINARY:
+		if dtype.ID() == arrow.STRING {
+			a.meta.SetTypename(stringArrayTypename)
+		} else {
+			a.meta.SetTypename(binaryArrayTypename)
+		}
+		if err := a.addBuffer(ctx, "buffer_offsets_", largeOffsets(data)); err != nil {
+			return err
+		}
+		if err := a.addBuffer(ctx, "buffer_data_", bufferBytes(data, 2)); err != nil {
+			return err
+		}
+	case arrow.FIXED_SIZE_BINARY:
+		a.meta.SetTypename(fixedSizeBinaryArrayTypename)
+		a.meta.AddKeyValue("byte_width_", dtype.(*arrow.FixedSizeBinaryType).ByteWidth)
+		if err := a.addBuffer(ctx, "buffer_", bufferBytes(data, 1)); err != nil {
+			return err
+		}
+	case arrow.LIST:
+		a.meta.SetTypename(listArrayTypename)
+		if err := a.addBuffer(ctx, "buffer_offsets_", largeOffsets(data)); err != nil {
+			return err
+		}
+		if err := a.addArray(ctx, "values_", a.Array.(*array.List).ListValues()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported arrow type: %s", dtype)
+	}
+
+	var nullBitmap []byte
+	if a.Array.NullN() > 0 {
+		nullBitmap = bufferBytes(data, 0)
+	}
+	return a.addBuffer(ctx, "null_bitmap_", nullBitmap)
+}
+
+func (a *ArrayBuilder) Meta() *ObjectMeta {
+	return &a.meta
 }
 
 func (a *ArrayBuilder) Id() common.ObjectID {
-	return a.blobWriter.ID
+	return a.id
+}
+
+func (a *ArrayBuilder) addBuffer(ctx context.Context, name string, data []byte) error {
+	blob, err := buildBlob(ctx, a.Client, data)
+	if err != nil {
+		return err
+	}
+	a.meta.SetNBytes(a.meta.GetNBytes() + blob.GetNBytes())
+	return a.meta.AddMember(name, blob)
+}
+
+func (a *ArrayBuilder) addArray(ctx context.Context, name string, arr array.Interface) error {
+	var builder ArrayBuilder
+	builder.Init(a.Client, arr)
+	if err := builder.Seal(ctx); err != nil {
+		return err
+	}
+	a.meta.SetNBytes(a.meta.GetNBytes() + builder.meta.GetNBytes())
+	return a.meta.AddMember(name, &builder.meta)
+}
+
+// buildBlob copies the data to a new blob, an empty blob is used when there
+// is no data.
+func buildBlob(ctx context.Context, client IIPCClient, data []byte) (*ObjectMeta, error) {
+	if len(data) == 0 {
+		return newEmptyBlobMeta(client), nil
+	}
+	var writer BlobWriter
+	if err := client.CreateBlob(ctx, len(data), &writer); err != nil {
+		return nil, err
+	}
+	copy(writer.Bytes(), data)
+	blob, err := writer.Seal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newBlobMeta(client, blob), nil
+}
+
+func bufferBytes(data *array.Data, index int) []byte {
+	if buffers := data.Buffers(); len(buffers) > index && buffers[index] != nil {
+		return buffers[index].Bytes()
+	}
+	return nil
+}
+
+// largeOffsets widens the 32-bit offsets of strings, binaries and lists in
+// go to the 64-bit offsets used by vineyard.
+func largeOffsets(data *array.Data) []byte {
+	offsets := make([]int64, data.Offset()+data.Len()+1)
+	if buffer := bufferBytes(data, 1); len(buffer) > 0 {
+		for i, offset := range arrow.Int32Traits.CastFromBytes(buffer)[:len(offsets)] {
+			offsets[i] = int64(offset)
+		}
+	}
+	return arrow.Int64Traits.CastToBytes(offsets)
+}
+
+// ReadArray rebuilds the arrow array from the metadata of a vineyard array,
+// the payloads of the blobs must have been fetched into the metadata, e.g.,
+// by IPCClient.GetMetaData.
+//
+// The buffers of the array refer to the blobs directly and must not be
+// modified, except the offsets of strings, binaries and lists, which are
+// narrowed to 32-bit offsets.
+func ReadArray(meta *ObjectMeta) (array.Interface, error) {
+	data, err := readArrayData(meta)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Release()
+	return array.MakeFromData(data), nil
+}
+
+func readArrayData(meta *ObjectMeta) (*array.Data, error) {
+	typename := meta.Typename()
+	var length int
+	if err := meta.GetKeyValue("length_", &length); err != nil {
+		return nil, err
+	}
+
+	switch typename {
+	case nullArrayTypename:
+		return array.NewData(arrow.Null, length, []*memory.Buffer{nil}, nil, length, 0), nil
+	case fixedSizeListArrayTypename:
+		var listSize int32
+		if err := meta.GetKeyValue("list_size_", &listSize); err != nil {
+			return nil, err
+		}
+		values, err := readMemberArrayData(meta, "values_")
+		if err != nil {
+			return nil, err
+		}
+		defer values.Release()
+		dtype := arrow.FixedSizeListOf(listSize, values.DataType())
+		return array.NewData(dtype, length, []*memory.Buffer{nil}, []*array.Data{values}, 0, 0), nil
+	}
+
+	var nullCount, offset int
+	if err := meta.GetKeyValue("null_count_", &nullCount); err != nil {
+		return nil, err
+	}
+	if err := meta.GetKeyValue("offset_", &offset); err != nil {
+		return nil, err
+	}
+	nullBitmap, err := readMemberBuffer(meta, "null_bitmap_")
+	if err != nil {
+		return nil, err
+	}
+
+	switch typename {
+	case booleanArrayTypename:
+		buffer, err := readMemberBuffer(meta, "buffer_")
+		if err != nil {
+			return nil, err
+		}
+		return array.NewData(arrow.FixedWidthTypes.Boolean, length,
+			[]*memory.Buffer{nullBitmap, buffer}, nil, nullCount, offset), nil
+	case stringArrayTypename, binaryArrayTypename, "vineyard::LargeStringArray", "vineyard::LargeBinaryArray":
+		var dtype arrow.DataType = arrow.BinaryTypes.Binary
+		if typename == stringArrayTypename || typename == "vineyard::LargeStringArray" {
+			dtype = arrow.BinaryTypes.String
+		}
+		offsets, err := readMemberOffsets(meta, offset+length+1)
+		if err != nil {
+			return nil, err
+		}
+		buffer, err := readMemberBuffer(meta, "buffer_data_")
+		if err != nil {
+			return nil, err
+		}
+		return array.NewData(dtype, length,
+			[]*memory.Buffer{nullBitmap, offsets, buffer}, nil, nullCount, offset), nil
+	case fixedSizeBinaryArrayTypename:
+		var byteWidth int
+		if err := meta.GetKeyValue("byte_width_", &byteWidth); err != nil {
+			return nil, err
+		}
+		buffer, err := readMemberBuffer(meta, "buffer_")
+		if err != nil {
+			return nil, err
+		}
+		return array.NewData(&arrow.FixedSizeBinaryType{ByteWidth: byteWidth}, length,
+			[]*memory.Buffer{nullBitmap, buffer}, nil, nullCount, offset), nil
+	case listArrayTypename, "vineyard::LargeListArray":
+		offsets, err := readMemberOffsets(meta, offset+length+1)
+		if err != nil {
+			return nil, err
+		}
+		values, err := readMemberArrayData(meta, "values_")
+		if err != nil {
+			return nil, err
+		}
+		defer values.Release()
+		return array.NewData(arrow.ListOf(values.DataType()), length,
+			[]*memory.Buffer{nullBitmap, offsets}, []*array.Data{values}, nullCount, offset), nil
+	}
+
+	if matches := numericArrayPattern.FindStringSubmatch(typename); matches != nil {
+		dtype, ok := numericTypes[matches[1]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported value type of numeric array: %s", matches[1])
+		}
+		buffer, err := readMemberBuffer(meta, "buffer_")
+		if err != nil {
+			return nil, err
+		}
+		return array.NewData(dtype, length, []*memory.Buffer{nullBitmap, buffer}, nil, nullCount, offset), nil
+	}
+	return nil, fmt.Errorf("'%s' is not an arrow array", typename)
+}
+
+func readMemberArrayData(meta *ObjectMeta, name string) (*array.Data, error) {
+	member, err := meta.GetMember(name)
+	if err != nil {
+		return nil, err
+	}
+	return readArrayData(member)
+}
+
+// readMemberBuffer wraps the blob member as an arrow buffer without copying,
+// nil is returned for the empty blob.
+func readMemberBuffer(meta *ObjectMeta, name string) (*memory.Buffer, error) {
+	member, err := meta.GetMember(name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := member.GetId()
+	if err != nil {
+		return nil, err
+	}
+	if id == common.EmptyBlobID() {
+		return nil, nil
+	}
+	blob, err := member.GetBuffer(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := blob.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return memory.NewBufferBytes(data), nil
+}
+
+// readMemberOffsets narrows the 64-bit offsets in vineyard to the 32-bit
+// offsets in go.
+func readMemberOffsets(meta *ObjectMeta, count int) (*memory.Buffer, error) {
+	buffer, err := readMemberBuffer(meta, "buffer_offsets_")
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]int32, count)
+	if buffer != nil {
+		large := arrow.Int64Traits.CastFromBytes(buffer.Bytes())
+		if len(large) < count {
+			return nil, fmt.Errorf("the offsets buffer is too short: %d < %d", len(large), count)
+		}
+		for i := range offsets {
+			if large[i] > math.MaxInt32 {
+				return nil, fmt.Errorf("the offset %d exceeds the range of 32-bit offsets", large[i])
+			}
+			offsets[i] = int32(large[i])
+		}
+	}
+	return memory.NewBufferBytes(arrow.Int32Traits.CastToBytes(offsets)), nil
 }
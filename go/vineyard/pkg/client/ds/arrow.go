@@ -0,0 +1,365 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+const (
+	schemaProxyTypename = "vineyard::SchemaProxy"
+	recordBatchTypename = "vineyard::RecordBatch"
+	tableTypename       = "vineyard::Table"
+)
+
+// schemaBinary is the json representation of the serialized schema, as the
+// `json::binary` of the C++ client and the `schema_binary_` of the Python
+// client.
+type schemaBinary struct {
+	Bytes []byte `json:"-"`
+}
+
+func (s schemaBinary) MarshalJSON() ([]byte, error) {
+	content := make([]int, len(s.Bytes))
+	for i, b := range s.Bytes {
+		content[i] = int(b)
+	}
+	return json.Marshal(map[string]interface{}{"bytes": content})
+}
+
+func (s *schemaBinary) UnmarshalJSON(data []byte) error {
+	var content struct {
+		Bytes []int `json:"bytes"`
+	}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return err
+	}
+	if content.Bytes == nil {
+		return errors.New("the schema binary doesn't have bytes")
+	}
+	s.Bytes = make([]byte, len(content.Bytes))
+	for i, b := range content.Bytes {
+		s.Bytes[i] = byte(b)
+	}
+	return nil
+}
+
+// buildSchema creates the `vineyard::SchemaProxy` object of the schema.
+func buildSchema(ctx context.Context, client IIPCClient, schema *arrow.Schema) (*ObjectMeta, error) {
+	content, err := SerializeSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := json.Marshal(schemaBinary{Bytes: content})
+	if err != nil {
+		return nil, err
+	}
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetTypename(schemaProxyTypename)
+	meta.AddKeyValue("schema_binary_", string(binary))
+	meta.SetNBytes(len(content))
+	if _, err := client.CreateMetaData(ctx, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// ReadSchema rebuilds the arrow schema from the metadata of a
+// `vineyard::SchemaProxy` object.
+func ReadSchema(meta *ObjectMeta) (*arrow.Schema, error) {
+	if meta.Typename() != schemaProxyTypename {
+		return nil, fmt.Errorf("'%s' is not a schema", meta.Typename())
+	}
+	// for backward compatibility, the schema may be kept in a blob
+	if meta.HasMember("buffer_") {
+		buffer, err := readMemberBuffer(meta, "buffer_")
+		if err != nil {
+			return nil, err
+		}
+		if buffer == nil {
+			return nil, errors.New("the schema buffer is empty")
+		}
+		return DeserializeSchema(buffer.Bytes())
+	}
+	var binary schemaBinary
+	if err := meta.GetKeyValue("schema_binary_", &binary); err != nil {
+		return nil, err
+	}
+	return DeserializeSchema(binary.Bytes)
+}
+
+// RecordBatchBuilder writes an arrow record to vineyard as a
+// `vineyard::RecordBatch`.
+type RecordBatchBuilder struct {
+	ObjectBuilder
+
+	Record array.Record
+	Client IIPCClient
+
+	meta ObjectMeta
+	id   common.ObjectID
+}
+
+func (r *RecordBatchBuilder) Init(client IIPCClient, record array.Record) {
+	r.Client = client
+	r.Record = record
+	r.id = common.InvalidObjectID()
+}
+
+// Seal builds the record batch and creates it in vineyard.
+func (r *RecordBatchBuilder) Seal(ctx context.Context) error {
+	if r.sealed {
+		return errors.New("the builder has been already sealed")
+	}
+	if err := r.Build(ctx); err != nil {
+		return err
+	}
+	id, err := r.Client.CreateMetaData(ctx, &r.meta)
+	if err != nil {
+		return err
+	}
+	r.id = id
+	r.SetSeal(true)
+	return nil
+}
+
+// Build seals the schema and the columns, and fills the metadata.
+func (r *RecordBatchBuilder) Build(ctx context.Context) error {
+	r.meta.Init()
+	r.meta.SetTypename(recordBatchTypename)
+	r.meta.AddKeyValue("row_num_", r.Record.NumRows())
+	r.meta.AddKeyValue("column_num_", r.Record.NumCols())
+	r.meta.AddKeyValue("__columns_-size", r.Record.NumCols())
+	r.meta.SetNBytes(0)
+
+	schema, err := buildSchema(ctx, r.Client, r.Record.Schema())
+	if err != nil {
+		return err
+	}
+	if err := r.meta.AddMember("schema_", schema); err != nil {
+		return err
+	}
+	for i, column := range r.Record.Columns() {
+		var builder ArrayBuilder
+		builder.Init(r.Client, column)
+		if err := builder.Seal(ctx); err != nil {
+			return err
+		}
+		r.meta.SetNBytes(r.meta.GetNBytes() + builder.Meta().GetNBytes())
+		if err := r.meta.AddMember(fmt.Sprintf("__columns_-%d", i), builder.Meta()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RecordBatchBuilder) Meta() *ObjectMeta {
+	return &r.meta
+}
+
+func (r *RecordBatchBuilder) Id() common.ObjectID {
+	return r.id
+}
+
+// ReadRecordBatch rebuilds the arrow record from the metadata of a
+// `vineyard::RecordBatch` object, the columns refer to the blobs directly,
+// see also ReadArray.
+func ReadRecordBatch(meta *ObjectMeta) (array.Record, error) {
+	if meta.Typename() != recordBatchTypename {
+		return nil, fmt.Errorf("'%s' is not a record batch", meta.Typename())
+	}
+	schemaMeta, err := meta.GetMember("schema_")
+	if err != nil {
+		return nil, err
+	}
+	schema, err := ReadSchema(schemaMeta)
+	if err != nil {
+		return nil, err
+	}
+	var rowNum int64
+	if err := meta.GetKeyValue("row_num_", &rowNum); err != nil {
+		return nil, err
+	}
+	var columnNum int
+	if err := meta.GetKeyValue("__columns_-size", &columnNum); err != nil {
+		return nil, err
+	}
+	columns := make([]array.Interface, 0, columnNum)
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	for i := 0; i < columnNum; i++ {
+		member, err := meta.GetMember(fmt.Sprintf("__columns_-%d", i))
+		if err != nil {
+			return nil, err
+		}
+		column, err := ReadArray(member)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return newRecord(schema, columns, rowNum)
+}
+
+// newRecord is array.NewRecord, but returns an error rather than panicking
+// when the columns don't match the schema.
+func newRecord(schema *arrow.Schema, columns []array.Interface, rows int64) (record array.Record, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			record, err = nil, fmt.Errorf("invalid record batch: %v", r)
+		}
+	}()
+	return array.NewRecord(schema, columns, rows), nil
+}
+
+// TableBuilder writes an arrow table to vineyard as a `vineyard::Table`, each
+// chunk of the table becomes a `vineyard::RecordBatch`.
+type TableBuilder struct {
+	ObjectBuilder
+
+	Table  array.Table
+	Client IIPCClient
+
+	meta ObjectMeta
+	id   common.ObjectID
+}
+
+func (t *TableBuilder) Init(client IIPCClient, table array.Table) {
+	t.Client = client
+	t.Table = table
+	t.id = common.InvalidObjectID()
+}
+
+// Seal builds the table and creates it in vineyard.
+func (t *TableBuilder) Seal(ctx context.Context) error {
+	if t.sealed {
+		return errors.New("the builder has been already sealed")
+	}
+	if err := t.Build(ctx); err != nil {
+		return err
+	}
+	id, err := t.Client.CreateMetaData(ctx, &t.meta)
+	if err != nil {
+		return err
+	}
+	t.id = id
+	t.SetSeal(true)
+	return nil
+}
+
+// Build seals the schema and the record batches, and fills the metadata.
+func (t *TableBuilder) Build(ctx context.Context) error {
+	t.meta.Init()
+	t.meta.SetTypename(tableTypename)
+	t.meta.AddKeyValue("num_rows_", t.Table.NumRows())
+	t.meta.AddKeyValue("num_columns_", t.Table.NumCols())
+	t.meta.SetNBytes(0)
+
+	schema, err := buildSchema(ctx, t.Client, t.Table.Schema())
+	if err != nil {
+		return err
+	}
+	if err := t.meta.AddMember("schema_", schema); err != nil {
+		return err
+	}
+
+	reader := array.NewTableReader(t.Table, 0)
+	defer reader.Release()
+	batchNum := 0
+	for reader.Next() {
+		var builder RecordBatchBuilder
+		builder.Init(t.Client, reader.Record())
+		if err := builder.Seal(ctx); err != nil {
+			return err
+		}
+		t.meta.SetNBytes(t.meta.GetNBytes() + builder.Meta().GetNBytes())
+		if err := t.meta.AddMember(fmt.Sprintf("partitions_-%d", batchNum), builder.Meta()); err != nil {
+			return err
+		}
+		batchNum++
+	}
+	t.meta.AddKeyValue("batch_num_", batchNum)
+	t.meta.AddKeyValue("partitions_-size", batchNum)
+	return nil
+}
+
+func (t *TableBuilder) Meta() *ObjectMeta {
+	return &t.meta
+}
+
+func (t *TableBuilder) Id() common.ObjectID {
+	return t.id
+}
+
+// ReadTable rebuilds the arrow table from the metadata of a `vineyard::Table`
+// object, the columns refer to the blobs directly, see also ReadArray.
+func ReadTable(meta *ObjectMeta) (array.Table, error) {
+	if meta.Typename() != tableTypename {
+		return nil, fmt.Errorf("'%s' is not a table", meta.Typename())
+	}
+	schemaMeta, err := meta.GetMember("schema_")
+	if err != nil {
+		return nil, err
+	}
+	schema, err := ReadSchema(schemaMeta)
+	if err != nil {
+		return nil, err
+	}
+	var batchNum int
+	if err := meta.GetKeyValue("batch_num_", &batchNum); err != nil {
+		return nil, err
+	}
+	records := make([]array.Record, 0, batchNum)
+	defer func() {
+		for _, record := range records {
+			record.Release()
+		}
+	}()
+	for i := 0; i < batchNum; i++ {
+		member, err := meta.GetMember(fmt.Sprintf("partitions_-%d", i))
+		if err != nil {
+			return nil, err
+		}
+		record, err := ReadRecordBatch(member)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return newTable(schema, records)
+}
+
+// newTable is array.NewTableFromRecords, but returns an error rather than
+// panicking when the records don't match the schema.
+func newTable(schema *arrow.Schema, records []array.Record) (table array.Table, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			table, err = nil, fmt.Errorf("invalid table: %v", r)
+		}
+	}()
+	return array.NewTableFromRecords(schema, records), nil
+}
@@ -0,0 +1,244 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+	"gotest.tools/v3/assert"
+)
+
+// fakeIPCClient keeps the blobs in memory and assigns ids locally.
+type fakeIPCClient struct {
+	fakeClient
+	nextID common.ObjectID
+}
+
+func (f *fakeIPCClient) CreateBlob(ctx context.Context, size int, blob *BlobWriter) error {
+	f.nextID++
+	id := f.nextID | common.EmptyBlobID()
+	blob.Reset(f, id, Payload{ID: id, DataSize: size}, *memory.NewBufferBytes(make([]byte, size)))
+	return nil
+}
+
+func (f *fakeIPCClient) Seal(ctx context.Context, id common.ObjectID) error {
+	return nil
+}
+
+func (f *fakeIPCClient) DropBuffer(ctx context.Context, id common.ObjectID, fd int) error {
+	return nil
+}
+
+func (f *fakeIPCClient) Release(ctx context.Context, id common.ObjectID) error {
+	return nil
+}
+
+func (f *fakeIPCClient) CreateMetaData(ctx context.Context, meta *ObjectMeta) (common.ObjectID, error) {
+	f.nextID++
+	meta.SetId(f.nextID)
+	meta.SetInstanceId(f.instanceID)
+	meta.AddKeyValue("transient", true)
+	meta.SetClient(f)
+	return f.nextID, nil
+}
+
+func TestSchema_Serialize(t *testing.T) {
+	metadata := arrow.NewMetadata([]string{"key"}, []string{"value"})
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "i8", Type: arrow.PrimitiveTypes.Int8},
+		{Name: "u64", Type: arrow.PrimitiveTypes.Uint64, Nullable: true},
+		{Name: "f64", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "b", Type: arrow.FixedWidthTypes.Boolean},
+		{Name: "s", Type: arrow.BinaryTypes.String, Nullable: true, Metadata: metadata},
+		{Name: "fsb", Type: &arrow.FixedSizeBinaryType{ByteWidth: 4}},
+		{Name: "l", Type: arrow.ListOf(arrow.BinaryTypes.String)},
+		{Name: "fsl", Type: arrow.FixedSizeListOf(3, arrow.PrimitiveTypes.Int32)},
+	}, &metadata)
+
+	content, err := SerializeSchema(schema)
+	assert.NilError(t, err)
+	assert.Equal(t, len(content)%8, 0)
+
+	result, err := DeserializeSchema(content)
+	assert.NilError(t, err)
+	assert.Assert(t, result.Equal(schema), "%s != %s", result, schema)
+	assert.Assert(t, result.Metadata().Equal(metadata))
+	assert.Assert(t, result.Field(4).Metadata.Equal(metadata))
+
+	_, err = DeserializeSchema(content[:16])
+	assert.ErrorContains(t, err, "invalid schema message")
+	_, err = SerializeSchema(arrow.NewSchema([]arrow.Field{{Name: "t", Type: arrow.FixedWidthTypes.Date32}}, nil))
+	assert.ErrorContains(t, err, "unsupported arrow type")
+}
+
+func TestArrayBuilder_Numeric(t *testing.T) {
+	pool := memory.NewGoAllocator()
+	builder := array.NewInt64Builder(pool)
+	defer builder.Release()
+	builder.AppendValues([]int64{1, 2, 3, 4}, []bool{true, false, true, true})
+	arr := builder.NewArray()
+	defer arr.Release()
+
+	client := &fakeIPCClient{}
+	var arrayBuilder ArrayBuilder
+	arrayBuilder.Init(client, arr)
+	assert.NilError(t, arrayBuilder.Seal(context.Background()))
+	assert.ErrorContains(t, arrayBuilder.Seal(context.Background()), "already sealed")
+
+	meta := arrayBuilder.Meta()
+	assert.Equal(t, meta.Typename(), "vineyard::NumericArray<int64>")
+	assert.DeepEqual(t, meta.ListMembers(), []string{"buffer_", "null_bitmap_"})
+	// the values and the (padded) null bitmap
+	assert.Assert(t, meta.GetNBytes() > 32)
+	id, err := meta.GetId()
+	assert.NilError(t, err)
+	assert.Equal(t, id, arrayBuilder.Id())
+
+	result, err := ReadArray(meta)
+	assert.NilError(t, err)
+	defer result.Release()
+	assert.Assert(t, array.ArrayEqual(result, arr), "%v != %v", result, arr)
+
+	// the values refer to the blob directly
+	buffer, err := meta.GetMember("buffer_")
+	assert.NilError(t, err)
+	blobID, err := buffer.GetId()
+	assert.NilError(t, err)
+	blob, err := buffer.GetBuffer(blobID)
+	assert.NilError(t, err)
+	data, err := blob.Data()
+	assert.NilError(t, err)
+	assert.Equal(t, &result.Data().Buffers()[1].Bytes()[0], &data[0])
+}
+
+func TestArrayBuilder_Nested(t *testing.T) {
+	pool := memory.NewGoAllocator()
+
+	sb := array.NewStringBuilder(pool)
+	defer sb.Release()
+	sb.AppendValues([]string{"a", "bc", "", "def"}, []bool{true, true, false, true})
+	strings := sb.NewArray()
+	defer strings.Release()
+
+	lb := array.NewListBuilder(pool, arrow.PrimitiveTypes.Float64)
+	defer lb.Release()
+	vb := lb.ValueBuilder().(*array.Float64Builder)
+	lb.Append(true)
+	vb.AppendValues([]float64{1, 2}, nil)
+	lb.AppendNull()
+	lb.Append(true)
+	vb.AppendValues([]float64{3}, nil)
+	lists := lb.NewArray()
+	defer lists.Release()
+
+	fb := array.NewFixedSizeListBuilder(pool, 2, arrow.PrimitiveTypes.Int32)
+	defer fb.Release()
+	fvb := fb.ValueBuilder().(*array.Int32Builder)
+	for i := int32(0); i < 3; i++ {
+		fb.Append(true)
+		fvb.AppendValues([]int32{i, i * 10}, nil)
+	}
+	fixedSizeLists := fb.NewArray()
+	defer fixedSizeLists.Release()
+	slicedLists := array.NewSlice(fixedSizeLists, 1, 3)
+	defer slicedLists.Release()
+
+	bb := array.NewBooleanBuilder(pool)
+	defer bb.Release()
+	bb.AppendValues([]bool{true, false, true}, nil)
+	booleans := bb.NewArray()
+	defer booleans.Release()
+
+	nulls := array.NewNull(3)
+	defer nulls.Release()
+
+	client := &fakeIPCClient{}
+	for _, c := range []struct {
+		arr      array.Interface
+		typename string
+	}{
+		{strings, "vineyard::BaseBinaryArray<arrow::LargeStringArray>"},
+		{lists, "vineyard::BaseListArray<arrow::LargeListArray>"},
+		{slicedLists, "vineyard::FixedSizeListArray"},
+		{booleans, "vineyard::BooleanArray"},
+		{nulls, "vineyard::NullArray"},
+	} {
+		var builder ArrayBuilder
+		builder.Init(client, c.arr)
+		assert.NilError(t, builder.Seal(context.Background()))
+		assert.Equal(t, builder.Meta().Typename(), c.typename)
+
+		result, err := ReadArray(builder.Meta())
+		assert.NilError(t, err)
+		assert.Assert(t, array.ArrayEqual(result, c.arr), "%v != %v", result, c.arr)
+		result.Release()
+	}
+}
+
+func TestTableBuilder(t *testing.T) {
+	pool := memory.NewGoAllocator()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	recordBuilder := array.NewRecordBuilder(pool, schema)
+	defer recordBuilder.Release()
+	var records []array.Record
+	for i := 0; i < 2; i++ {
+		recordBuilder.Field(0).(*array.Int32Builder).AppendValues([]int32{1, 2, 3}, nil)
+		recordBuilder.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b", "c"}, nil)
+		record := recordBuilder.NewRecord()
+		defer record.Release()
+		records = append(records, record)
+	}
+	table := array.NewTableFromRecords(schema, records)
+	defer table.Release()
+
+	client := &fakeIPCClient{}
+	var batchBuilder RecordBatchBuilder
+	batchBuilder.Init(client, records[0])
+	assert.NilError(t, batchBuilder.Seal(context.Background()))
+	assert.Equal(t, batchBuilder.Meta().Typename(), "vineyard::RecordBatch")
+	record, err := ReadRecordBatch(batchBuilder.Meta())
+	assert.NilError(t, err)
+	defer record.Release()
+	assert.Assert(t, array.RecordEqual(record, records[0]))
+
+	var tableBuilder TableBuilder
+	tableBuilder.Init(client, table)
+	assert.NilError(t, tableBuilder.Seal(context.Background()))
+	meta := tableBuilder.Meta()
+	assert.Equal(t, meta.Typename(), "vineyard::Table")
+	var batchNum int
+	assert.NilError(t, meta.GetKeyValue("batch_num_", &batchNum))
+	assert.Equal(t, batchNum, 2)
+	assert.DeepEqual(t, meta.ListMembers(), []string{"partitions_-0", "partitions_-1", "schema_"})
+
+	result, err := ReadTable(meta)
+	assert.NilError(t, err)
+	defer result.Release()
+	assert.Equal(t, result.NumRows(), int64(6))
+	assert.Assert(t, result.Schema().Equal(schema))
+
+	_, err = ReadTable(batchBuilder.Meta())
+	assert.ErrorContains(t, err, "is not a table")
+}
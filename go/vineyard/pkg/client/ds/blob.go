@@ -16,16 +16,71 @@ limitations under the License.
 package ds
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync/atomic"
 
 	"github.com/apache/arrow/go/arrow/memory"
 	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
 )
 
 type Blob struct {
-	id     int
+	id     common.ObjectID
 	size   int
 	buffer []byte
+
+	tracker  BlobTracker
+	released int32
+}
+
+func (b *Blob) Reset(id common.ObjectID, size int, buffer []byte) {
+	b.id = id
+	b.size = size
+	b.buffer = buffer
+	b.tracker = nil
+	b.released = 0
+}
+
+// Track binds the blob to the tracker of the client that fetched it. The blob
+// that is garbage collected without being released is released without
+// unmapping the shared memory, as the slices returned by Data may outlive the
+// blob.
+func (b *Blob) Track(tracker BlobTracker) {
+	b.tracker = tracker
+	runtime.SetFinalizer(b, func(b *Blob) {
+		if !atomic.CompareAndSwapInt32(&b.released, 0, 1) {
+			return
+		}
+		// releasing talks to vineyard, which mustn't block other finalizers
+		go func() {
+			if err := b.tracker.ReleaseBlob(context.Background(), b.id, false); err != nil {
+				common.GetLogger().Warnf("failed to release blob %s: %v", common.ObjectIDToString(b.id), err)
+			}
+		}()
+	})
+}
+
+// Release releases the blob in the client that fetched it, the shared memory
+// may be unmapped after that, thus the data of the blob mustn't be used
+// anymore. The blob that isn't released is released in vineyard on garbage
+// collection, while its shared memory stays mapped until the client is
+// disconnected. Releasing a blob more than once, or after the client has
+// reconnected or disconnected, is a no-op.
+func (b *Blob) Release(ctx context.Context) error {
+	if b.tracker == nil || !atomic.CompareAndSwapInt32(&b.released, 0, 1) {
+		return nil
+	}
+	runtime.SetFinalizer(b, nil)
+	b.buffer = nil
+	return b.tracker.ReleaseBlob(ctx, b.id, true)
+}
+
+func (b *Blob) ID() common.ObjectID {
+	return b.id
 }
 
 func (b *Blob) Size() int {
@@ -33,33 +88,334 @@ func (b *Blob) Size() int {
 }
 
 func (b *Blob) Data() ([]byte, error) {
+	if atomic.LoadInt32(&b.released) != 0 {
+		return nil, fmt.Errorf("the blob %s has been released", common.ObjectIDToString(b.id))
+	}
+	if b.tracker != nil && !b.tracker.Valid() {
+		return nil, fmt.Errorf("the blob %s is invalid as the client has reconnected or disconnected",
+			common.ObjectIDToString(b.id))
+	}
 	if b.size > 0 && len(b.buffer) == 0 {
 		return nil, fmt.Errorf("The object might be a (partially) remote object "+
-			"and the payload data is not locally available: %d", b.id)
+			"and the payload data is not locally available: %s", common.ObjectIDToString(b.id))
 	}
 	return b.buffer, nil
 }
 
+// NewReader returns a reader of the data of the blob, which keeps the blob
+// reachable while in use and fails once the blob is released.
+func (b *Blob) NewReader() *BlobReader {
+	return &BlobReader{blob: b}
+}
+
+// BlobReader reads the data of a blob, it implements io.Reader, io.ReaderAt,
+// io.Seeker and io.WriterTo.
+type BlobReader struct {
+	blob   *Blob
+	offset int64
+}
+
+// Size returns the size of the blob.
+func (r *BlobReader) Size() int64 {
+	return int64(r.blob.Size())
+}
+
+func (r *BlobReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *BlobReader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset to read the blob: %d", offset)
+	}
+	data, err := r.blob.Data()
+	if err != nil {
+		return 0, err
+	}
+	if offset >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[offset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.Size()
+	default:
+		return 0, fmt.Errorf("invalid whence to seek the blob: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset to seek the blob: %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// WriteTo writes the rest of the data to the writer without copying it to an
+// intermediate buffer.
+func (r *BlobReader) WriteTo(w io.Writer) (int64, error) {
+	data, err := r.blob.Data()
+	if err != nil {
+		return 0, err
+	}
+	if r.offset >= int64(len(data)) {
+		return 0, nil
+	}
+	n, err := w.Write(data[r.offset:])
+	r.offset += int64(n)
+	return int64(n), err
+}
+
+// newBlobMeta returns the metadata of a sealed blob, in the same layout as
+// the C++ client, the blob itself is kept in the meta's buffer set.
+func newBlobMeta(client IClient, blob *Blob) *ObjectMeta {
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetId(blob.ID())
+	meta.SetTypename("vineyard::Blob")
+	meta.AddKeyValue("length", blob.Size())
+	meta.SetNBytes(blob.Size())
+	meta.SetInstanceId(client.InstanceID())
+	meta.AddKeyValue("transient", true)
+	meta.SetMetaData(client, meta.meta)
+	meta.bufferSet.EmplaceBlob(blob)
+	return &meta
+}
+
+// newEmptyBlobMeta returns the metadata of the empty blob, which is used for
+// absent buffers, e.g., the null bitmap of an array without nulls.
+func newEmptyBlobMeta(client IClient) *ObjectMeta {
+	blob := &Blob{}
+	blob.Reset(common.EmptyBlobID(), 0, nil)
+	return newBlobMeta(client, blob)
+}
+
+// BufferSet records the blobs that an object's metadata refers to, and the
+// blobs that have been fetched from vineyard for them.
 type BufferSet struct {
-	//buffer arrow.
+	buffers map[common.ObjectID]*Blob
 }
 
+// EmplaceBuffer records a blob id whose payload hasn't been fetched yet.
 func (b *BufferSet) EmplaceBuffer(id common.ObjectID) {
+	if b.buffers == nil {
+		b.buffers = make(map[common.ObjectID]*Blob)
+	}
+	if _, ok := b.buffers[id]; !ok {
+		b.buffers[id] = nil
+	}
+}
+
+// Extend adds the blobs in other to this set, fetched payloads are kept.
+func (b *BufferSet) Extend(other *BufferSet) {
+	for id, blob := range other.buffers {
+		if existing, ok := b.buffers[id]; ok && existing != nil {
+			continue
+		}
+		if b.buffers == nil {
+			b.buffers = make(map[common.ObjectID]*Blob)
+		}
+		b.buffers[id] = blob
+	}
+}
+
+// EmplaceBlob records a blob whose payload is available.
+func (b *BufferSet) EmplaceBlob(blob *Blob) {
+	if b.buffers == nil {
+		b.buffers = make(map[common.ObjectID]*Blob)
+	}
+	b.buffers[blob.ID()] = blob
+}
 
+// Get returns the fetched blob, the blob is nil if its payload hasn't been
+// fetched yet.
+func (b *BufferSet) Get(id common.ObjectID) (*Blob, bool) {
+	blob, ok := b.buffers[id]
+	return blob, ok
 }
 
-func (b *BufferSet) Reset() {
+func (b *BufferSet) Contains(id common.ObjectID) bool {
+	_, ok := b.buffers[id]
+	return ok
+}
+
+// AllBufferIds returns the ids of all blobs in the set, in ascending order.
+func (b *BufferSet) AllBufferIds() []common.ObjectID {
+	ids := make([]common.ObjectID, 0, len(b.buffers))
+	for id := range b.buffers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (b *BufferSet) Len() int {
+	return len(b.buffers)
+}
 
+func (b *BufferSet) Reset() {
+	b.buffers = make(map[common.ObjectID]*Blob)
 }
 
+// BlobWriter is a writable blob created in vineyard, the blob becomes visible
+// to other clients after being sealed.
+//
+// BlobWriter implements io.Writer and io.WriterAt. The writes beyond the size
+// of the blob fail with io.ErrShortWrite, unless the writer is growable, see
+// also ResetGrowable.
 type BlobWriter struct {
 	ID common.ObjectID
 	Payload
 	memory.Buffer
+
+	client IIPCClient
+	sealed bool
+	// offset is the offset of the next Write
+	offset   int
+	growable bool
 }
 
-func (b *BlobWriter) Reset(id common.ObjectID, payload Payload, buffer memory.Buffer) {
+func (b *BlobWriter) Reset(client IIPCClient, id common.ObjectID, payload Payload, buffer memory.Buffer) {
 	b.ID = id
 	b.Payload = payload
 	b.Buffer = buffer
+	b.client = client
+	b.sealed = false
+	b.offset = 0
+	b.growable = false
+}
+
+// ResetGrowable resets the blob writer as a growable one, whose content is
+// kept in a local buffer that grows as written. The blob is created in
+// vineyard by the client with the final size when the writer is sealed.
+func (b *BlobWriter) ResetGrowable(client IIPCClient) {
+	id := common.PlaceholderBlobID()
+	payload := Payload{ID: id, StoreFd: -1, ArenaFd: -1}
+	b.Reset(client, id, payload, *memory.NewResizableBuffer(memory.NewGoAllocator()))
+	b.growable = true
+}
+
+// Growable tells whether the blob writer grows as written.
+func (b *BlobWriter) Growable() bool {
+	return b.growable
+}
+
+// Write writes the data at the end of the last Write, the first Write starts
+// at the beginning of the blob.
+func (b *BlobWriter) Write(data []byte) (int, error) {
+	n, err := b.WriteAt(data, int64(b.offset))
+	b.offset += n
+	return n, err
+}
+
+// WriteAt writes the data at the offset, the gap before the offset in a
+// growable writer is filled by zeros.
+func (b *BlobWriter) WriteAt(data []byte, offset int64) (int, error) {
+	if b.sealed {
+		return 0, errors.New("the blob writer has been already sealed")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset to write the blob: %d", offset)
+	}
+	end := offset + int64(len(data))
+	if b.growable && end > int64(b.Len()) {
+		b.grow(int(end))
+	}
+	if offset >= int64(b.Len()) {
+		if len(data) == 0 {
+			return 0, nil
+		}
+		return 0, io.ErrShortWrite
+	}
+	n := copy(b.Bytes()[offset:], data)
+	if n < len(data) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// grow enlarges the local buffer to the size, the capacity is at least doubled
+// to amortize the copies of small writes. The memory of the go allocator is
+// zeroed, and the buffer never shrinks.
+func (b *BlobWriter) grow(size int) {
+	if size > b.Cap() {
+		capacity := 2 * b.Cap()
+		if capacity < size {
+			capacity = size
+		}
+		b.Reserve(capacity)
+	}
+	b.ResizeNoShrink(size)
+}
+
+func (b *BlobWriter) Sealed() bool {
+	return b.sealed
+}
+
+// Seal marks the blob as sealed in vineyard and returns the sealed blob, the
+// buffer shouldn't be modified anymore after that. The blob writers of an rpc
+// client get their ids here, as the blob is created on sealing.
+func (b *BlobWriter) Seal(ctx context.Context) (*Blob, error) {
+	if b.sealed {
+		return nil, errors.New("the blob writer has been already sealed")
+	}
+	if b.client == nil {
+		return nil, errors.New("the blob writer hasn't been created by a client")
+	}
+	if b.growable {
+		var created BlobWriter
+		if err := b.client.CreateBlob(ctx, b.Len(), &created); err != nil {
+			return nil, err
+		}
+		copy(created.Bytes(), b.Bytes())
+		offset := b.offset
+		b.Buffer.Release()
+		*b = created
+		b.offset = offset
+		return b.Seal(ctx)
+	}
+	if remote, ok := b.client.(IRPCClient); ok {
+		id, err := remote.CreateRemoteBlob(ctx, b.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		b.ID, b.Payload.ID = id, id
+	} else if err := b.client.Seal(ctx, b.ID); err != nil {
+		return nil, err
+	}
+	b.sealed = true
+	blob := &Blob{}
+	blob.Reset(b.ID, b.Len(), b.Bytes())
+	return blob, nil
+}
+
+// Abort releases the blob in vineyard without sealing it.
+func (b *BlobWriter) Abort(ctx context.Context) error {
+	if b.sealed {
+		return common.NewReplyError(common.KObjectSealed, common.DROP_BUFFER_REQUEST,
+			"the blob writer has been already sealed")
+	}
+	if b.client == nil {
+		return errors.New("the blob writer hasn't been created by a client")
+	}
+	// the growable blob writers haven't created blobs yet
+	if b.growable {
+		b.Buffer.Release()
+		b.Reset(b.client, b.ID, b.Payload, *memory.NewBufferBytes(nil))
+		return nil
+	}
+	return b.client.DropBuffer(ctx, b.ID, b.StoreFd)
 }
@@ -0,0 +1,122 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+	"gotest.tools/v3/assert"
+)
+
+func TestBlobWriter_Write(t *testing.T) {
+	client := &fakeIPCClient{}
+	var writer BlobWriter
+	assert.NilError(t, client.CreateBlob(context.Background(), 8, &writer))
+	assert.Assert(t, !writer.Growable())
+
+	n, err := writer.Write([]byte("vine"))
+	assert.NilError(t, err)
+	assert.Equal(t, n, 4)
+	n, err = writer.Write([]byte("yard!"))
+	assert.Equal(t, err, io.ErrShortWrite)
+	assert.Equal(t, n, 4)
+	_, err = writer.Write([]byte("!"))
+	assert.Equal(t, err, io.ErrShortWrite)
+	assert.Equal(t, string(writer.Bytes()), "vineyard")
+
+	n, err = writer.WriteAt([]byte("Y"), 4)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+	_, err = writer.WriteAt([]byte("Y"), -1)
+	assert.ErrorContains(t, err, "invalid offset")
+	blob, err := writer.Seal(context.Background())
+	assert.NilError(t, err)
+	data, err := blob.Data()
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "vineYard")
+	_, err = writer.Write([]byte("!"))
+	assert.ErrorContains(t, err, "sealed")
+}
+
+func TestBlobWriter_Growable(t *testing.T) {
+	client := &fakeIPCClient{}
+	var writer BlobWriter
+	writer.ResetGrowable(client)
+	assert.Assert(t, writer.Growable())
+	assert.Equal(t, writer.ID, common.PlaceholderBlobID())
+
+	content := strings.Repeat("vineyard", 1000)
+	n, err := io.Copy(&writer, strings.NewReader(content))
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(len(content)))
+	_, err = writer.WriteAt([]byte("!"), int64(len(content)+3))
+	assert.NilError(t, err)
+	assert.Equal(t, writer.Len(), len(content)+4)
+
+	blob, err := writer.Seal(context.Background())
+	assert.NilError(t, err)
+	assert.Assert(t, writer.ID != common.PlaceholderBlobID())
+	assert.Equal(t, blob.ID(), writer.ID)
+	data, err := blob.Data()
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), content+"\x00\x00\x00!")
+
+	var aborted BlobWriter
+	aborted.ResetGrowable(client)
+	_, err = aborted.Write([]byte("vineyard"))
+	assert.NilError(t, err)
+	assert.NilError(t, aborted.Abort(context.Background()))
+	assert.Equal(t, aborted.Len(), 0)
+}
+
+func TestBlob_NewReader(t *testing.T) {
+	var blob Blob
+	blob.Reset(common.EmptyBlobID()|1, 8, []byte("vineyard"))
+	reader := blob.NewReader()
+	assert.Equal(t, reader.Size(), int64(8))
+
+	buffer := make([]byte, 3)
+	n, err := reader.Read(buffer)
+	assert.NilError(t, err)
+	assert.Equal(t, string(buffer[:n]), "vin")
+	n, err = reader.ReadAt(buffer, 6)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, string(buffer[:n]), "rd")
+	_, err = reader.ReadAt(buffer, 8)
+	assert.Equal(t, err, io.EOF)
+
+	offset, err := reader.Seek(-4, io.SeekEnd)
+	assert.NilError(t, err)
+	assert.Equal(t, offset, int64(4))
+	rest, err := io.ReadAll(reader)
+	assert.NilError(t, err)
+	assert.Equal(t, string(rest), "yard")
+	_, err = reader.Seek(-1, io.SeekStart)
+	assert.ErrorContains(t, err, "invalid offset")
+
+	_, err = reader.Seek(2, io.SeekStart)
+	assert.NilError(t, err)
+	var output bytes.Buffer
+	written, err := io.Copy(&output, reader)
+	assert.NilError(t, err)
+	assert.Equal(t, written, int64(6))
+	assert.Equal(t, output.String(), "neyard")
+}
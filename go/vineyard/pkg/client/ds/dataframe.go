@@ -0,0 +1,287 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/apache/arrow/go/arrow/tensor"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+const (
+	dataFrameTypename = "vineyard::DataFrame"
+	// dataFrameIndexKey is the key of the index in the values of the C++
+	// dataframes, the Python client keeps the index as the member "index_".
+	dataFrameIndexKey = "index_"
+)
+
+// DataFrame is a `vineyard::DataFrame`, whose columns are 1-D tensors of the
+// same length. The names of the columns are JSON values in vineyard, the
+// names that are not strings are kept in their JSON encoding, e.g., "0".
+type DataFrame struct {
+	columns []string
+	values  map[string]*Tensor
+	index   *Tensor
+}
+
+// Columns returns the names of the columns, in order.
+func (d *DataFrame) Columns() []string {
+	return d.columns
+}
+
+// Column returns the column of the name.
+func (d *DataFrame) Column(name string) (*Tensor, bool) {
+	column, ok := d.values[name]
+	return column, ok
+}
+
+// Index returns the index of the dataframe, which may be nil.
+func (d *DataFrame) Index() *Tensor {
+	return d.index
+}
+
+// NumRows returns the number of rows, i.e., the length of the columns.
+func (d *DataFrame) NumRows() int {
+	if len(d.columns) == 0 {
+		if d.index != nil {
+			return d.index.size()
+		}
+		return 0
+	}
+	return d.values[d.columns[0]].size()
+}
+
+// ReadDataFrame rebuilds the dataframe from the metadata of a
+// `vineyard::DataFrame` written by the C++ or Python client, the columns
+// refer to the blobs directly, see also ReadTensor.
+func ReadDataFrame(meta *ObjectMeta) (*DataFrame, error) {
+	if meta.Typename() != dataFrameTypename {
+		return nil, fmt.Errorf("'%s' is not a dataframe", meta.Typename())
+	}
+	var size int
+	if err := meta.GetKeyValue("__values_-size", &size); err != nil {
+		return nil, err
+	}
+	d := &DataFrame{values: make(map[string]*Tensor, size)}
+	for i := 0; i < size; i++ {
+		key, err := jsonValue(meta, fmt.Sprintf("__values_-key-%d", i))
+		if err != nil {
+			return nil, err
+		}
+		member, err := meta.GetMember(fmt.Sprintf("__values_-value-%d", i))
+		if err != nil {
+			return nil, err
+		}
+		value, err := ReadTensor(member)
+		if err != nil {
+			return nil, err
+		}
+		name, err := columnName(key)
+		if err != nil {
+			return nil, err
+		}
+		d.values[name] = value
+	}
+	if meta.HasMember(dataFrameIndexKey) {
+		member, err := meta.GetMember(dataFrameIndexKey)
+		if err != nil {
+			return nil, err
+		}
+		if d.index, err = ReadTensor(member); err != nil {
+			return nil, err
+		}
+	} else if index, ok := d.values[dataFrameIndexKey]; ok {
+		d.index = index
+		delete(d.values, dataFrameIndexKey)
+	}
+
+	value, err := jsonValue(meta, "columns_")
+	if err != nil {
+		return nil, err
+	}
+	columns, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid columns of the dataframe: %v", value)
+	}
+	d.columns = make([]string, 0, len(columns))
+	for _, column := range columns {
+		name, err := columnName(column)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := d.values[name]; !ok {
+			return nil, fmt.Errorf("the column '%s' of the dataframe is missing", name)
+		}
+		d.columns = append(d.columns, name)
+	}
+	return d, nil
+}
+
+// jsonValue returns the value of the key, which is decoded if it is a JSON
+// encoded string, as the C++ and Python clients store the names of columns.
+func jsonValue(meta *ObjectMeta, key string) (interface{}, error) {
+	value, ok := meta.MetaData()[key]
+	if !ok {
+		return nil, fmt.Errorf("key '%s' doesn't exist in the metadata", key)
+	}
+	if content, ok := value.(string); ok {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(content), &decoded); err == nil {
+			return decoded, nil
+		}
+	}
+	return value, nil
+}
+
+// columnName returns the string names as is, and the JSON encoding of others.
+func columnName(value interface{}) (string, error) {
+	if name, ok := value.(string); ok {
+		return name, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// DataFrameBuilder writes 1-D arrow tensors to vineyard as the columns of a
+// `vineyard::DataFrame`, in the layout of the Python client, so that the
+// dataframe can be read as a pandas dataframe.
+type DataFrameBuilder struct {
+	ObjectBuilder
+
+	Client IIPCClient
+	// Index is the index of the dataframe, which is optional.
+	Index                tensor.Interface
+	PartitionIndexRow    int
+	PartitionIndexColumn int
+	RowBatchIndex        int
+
+	columns []string
+	values  []tensor.Interface
+	meta    ObjectMeta
+	id      common.ObjectID
+}
+
+func (d *DataFrameBuilder) Init(client IIPCClient) {
+	d.Client = client
+	d.Index = nil
+	d.PartitionIndexRow = -1
+	d.PartitionIndexColumn = -1
+	d.RowBatchIndex = 0
+	d.columns = nil
+	d.values = nil
+	d.id = common.InvalidObjectID()
+}
+
+// AddColumn appends the column, the columns must be 1-D tensors of the same
+// length.
+func (d *DataFrameBuilder) AddColumn(name string, column tensor.Interface) error {
+	for _, existing := range d.columns {
+		if existing == name {
+			return fmt.Errorf("the column '%s' already exists in the dataframe", name)
+		}
+	}
+	if column.NumDims() != 1 {
+		return fmt.Errorf("the column '%s' should be a 1-D tensor, but has %d dimensions", name, column.NumDims())
+	}
+	if len(d.values) > 0 && d.values[0].Len() != column.Len() {
+		return fmt.Errorf("the column '%s' has %d rows, expect %d", name, column.Len(), d.values[0].Len())
+	}
+	d.columns = append(d.columns, name)
+	d.values = append(d.values, column)
+	return nil
+}
+
+// Seal builds the dataframe and creates it in vineyard.
+func (d *DataFrameBuilder) Seal(ctx context.Context) error {
+	if d.sealed {
+		return errors.New("the builder has been already sealed")
+	}
+	if err := d.Build(ctx); err != nil {
+		return err
+	}
+	id, err := d.Client.CreateMetaData(ctx, &d.meta)
+	if err != nil {
+		return err
+	}
+	d.id = id
+	d.SetSeal(true)
+	return nil
+}
+
+// Build seals the columns and the index, and fills the metadata.
+func (d *DataFrameBuilder) Build(ctx context.Context) error {
+	d.meta.Init()
+	d.meta.SetTypename(dataFrameTypename)
+	columns := d.columns
+	if columns == nil {
+		columns = []string{}
+	}
+	content, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	d.meta.AddKeyValue("columns_", string(content))
+	d.meta.AddKeyValue("__values_-size", len(d.columns))
+	d.meta.AddKeyValue("partition_index_row_", d.PartitionIndexRow)
+	d.meta.AddKeyValue("partition_index_column_", d.PartitionIndexColumn)
+	d.meta.AddKeyValue("row_batch_index_", d.RowBatchIndex)
+	d.meta.SetNBytes(0)
+
+	if d.Index != nil {
+		if len(d.values) > 0 && d.Index.Len() != d.values[0].Len() {
+			return fmt.Errorf("the index has %d rows, expect %d", d.Index.Len(), d.values[0].Len())
+		}
+		if err := d.addTensor(ctx, dataFrameIndexKey, d.Index); err != nil {
+			return err
+		}
+	}
+	for i, name := range d.columns {
+		content, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		d.meta.AddKeyValue(fmt.Sprintf("__values_-key-%d", i), string(content))
+		if err := d.addTensor(ctx, fmt.Sprintf("__values_-value-%d", i), d.values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DataFrameBuilder) addTensor(ctx context.Context, name string, value tensor.Interface) error {
+	var builder TensorBuilder
+	builder.Init(d.Client, value)
+	if err := builder.Seal(ctx); err != nil {
+		return err
+	}
+	d.meta.SetNBytes(d.meta.GetNBytes() + builder.Meta().GetNBytes())
+	return d.meta.AddMember(name, builder.Meta())
+}
+
+func (d *DataFrameBuilder) Meta() *ObjectMeta {
+	return &d.meta
+}
+
+func (d *DataFrameBuilder) Id() common.ObjectID {
+	return d.id
+}
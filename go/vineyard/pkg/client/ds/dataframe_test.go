@@ -0,0 +1,93 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"gotest.tools/v3/assert"
+)
+
+func TestDataFrameBuilder(t *testing.T) {
+	a := newTensor([]int32{1, 2, 3}, []int64{3}, nil)
+	defer a.Release()
+	b := newTensor([]int32{4, 5, 6}, []int64{3}, nil)
+	defer b.Release()
+	index := newTensor([]int32{10, 20, 30}, []int64{3}, nil)
+	defer index.Release()
+
+	client := &fakeIPCClient{}
+	var builder DataFrameBuilder
+	builder.Init(client)
+	builder.Index = index
+	assert.NilError(t, builder.AddColumn("a", a))
+	assert.NilError(t, builder.AddColumn("b", b))
+	assert.ErrorContains(t, builder.AddColumn("a", b), "already exists")
+	matrix := newTensor([]int32{1, 2, 3, 4}, []int64{2, 2}, nil)
+	defer matrix.Release()
+	assert.ErrorContains(t, builder.AddColumn("m", matrix), "1-D tensor")
+	short := newTensor([]int32{1}, []int64{1}, nil)
+	defer short.Release()
+	assert.ErrorContains(t, builder.AddColumn("s", short), "has 1 rows")
+	assert.NilError(t, builder.Seal(context.Background()))
+
+	meta := builder.Meta()
+	assert.Equal(t, meta.Typename(), "vineyard::DataFrame")
+	assert.Equal(t, meta.MetaData()["columns_"], `["a","b"]`)
+	assert.Equal(t, meta.MetaData()["__values_-key-1"], `"b"`)
+	assert.Equal(t, meta.MetaData()["partition_index_row_"], -1)
+	assert.Equal(t, meta.GetNBytes(), 9*4)
+
+	object, err := ResolveObject(meta)
+	assert.NilError(t, err)
+	result, ok := object.(*DataFrame)
+	assert.Assert(t, ok, "unexpected object: %T", object)
+	assert.DeepEqual(t, result.Columns(), []string{"a", "b"})
+	assert.Equal(t, result.NumRows(), 3)
+	column, ok := result.Column("b")
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, arrow.Int32Traits.CastFromBytes(column.Data()), []int32{4, 5, 6})
+	assert.DeepEqual(t, arrow.Int32Traits.CastFromBytes(result.Index().Data()), []int32{10, 20, 30})
+}
+
+// TestReadDataFrame_Cpp reads the dataframe in the layout of the C++ client,
+// which keeps the index in the values and names the columns by numbers.
+func TestReadDataFrame_Cpp(t *testing.T) {
+	client := &fakeIPCClient{}
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::DataFrame")
+	meta.AddKeyValue("columns_", "[0]")
+	meta.AddKeyValue("__values_-size", 2)
+	meta.AddKeyValue("__values_-key-0", `"index_"`)
+	assert.NilError(t, meta.AddMember("__values_-value-0", buildTensor(t, client, []float64{1, 2}, "[2]")))
+	meta.AddKeyValue("__values_-key-1", "0")
+	assert.NilError(t, meta.AddMember("__values_-value-1", buildTensor(t, client, []float64{3, 4}, "[2]")))
+
+	result, err := ReadDataFrame(&meta)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.Columns(), []string{"0"})
+	assert.Equal(t, result.NumRows(), 2)
+	assert.Assert(t, result.Index() != nil)
+	_, ok := result.Column("index_")
+	assert.Assert(t, !ok)
+
+	meta.AddKeyValue("columns_", "[0, 1]")
+	_, err = ReadDataFrame(&meta)
+	assert.ErrorContains(t, err, "column '1' of the dataframe is missing")
+}
@@ -1,5 +1,39 @@
 package ds
 
+import (
+	"context"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// IClient is the part of the vineyard client that object metadata needs.
+type IClient interface {
+	InstanceID() common.InstanceID
+}
+
 type IIPCClient interface {
-	CreateBlob(size int, blob *BlobWriter)
+	IClient
+	CreateBlob(ctx context.Context, size int, blob *BlobWriter) error
+	Seal(ctx context.Context, id common.ObjectID) error
+	DropBuffer(ctx context.Context, id common.ObjectID, fd int) error
+	CreateMetaData(ctx context.Context, meta *ObjectMeta) (common.ObjectID, error)
+	Release(ctx context.Context, id common.ObjectID) error
+}
+
+// IRPCClient creates blobs from their content on the remote instance, the
+// blob writers it creates are local buffers until being sealed.
+type IRPCClient interface {
+	IIPCClient
+	CreateRemoteBlob(ctx context.Context, data []byte) (common.ObjectID, error)
+}
+
+// BlobTracker keeps the blobs that a client has fetched in use, see
+// Blob.Track.
+type BlobTracker interface {
+	// ReleaseBlob releases a reference of the blob, the shared memory in which
+	// no blob is in use anymore is unmapped if unmap is set.
+	ReleaseBlob(ctx context.Context, id common.ObjectID, unmap bool) error
+	// Valid reports whether the blobs are still valid, which they are not
+	// once the client has reconnected or disconnected.
+	Valid() bool
 }
@@ -16,13 +16,17 @@ limitations under the License.
 package ds
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
 )
 
 type ObjectMeta struct {
-	client     *IIPCClient
+	client     IClient
 	meta       map[string]interface{}
 	bufferSet  BufferSet
 	inComplete bool
@@ -32,11 +36,11 @@ func (o *ObjectMeta) Init() {
 	o.meta = make(map[string]interface{})
 }
 
-func (o *ObjectMeta) SetClient(client *IIPCClient) {
+func (o *ObjectMeta) SetClient(client IClient) {
 	o.client = client
 }
 
-func (o *ObjectMeta) GetClient() *IIPCClient {
+func (o *ObjectMeta) GetClient() IClient {
 	return o.client
 }
 
@@ -44,10 +48,69 @@ func (o *ObjectMeta) SetInstanceId(id common.InstanceID) {
 	o.meta["instance_id"] = id
 }
 
+func (o *ObjectMeta) GetInstanceId() (common.InstanceID, error) {
+	return toUint64(o.meta["instance_id"])
+}
+
+// IsLocal returns whether the object lives on the instance the client is
+// connected to. Newly created metadata which hasn't been sent to vineyard
+// is always local.
+func (o *ObjectMeta) IsLocal() bool {
+	if _, ok := o.meta["instance_id"]; !ok {
+		return true
+	}
+	if o.client == nil {
+		return false
+	}
+	instanceID, err := o.GetInstanceId()
+	return err == nil && instanceID == o.client.InstanceID()
+}
+
+func (o *ObjectMeta) SetGlobal(global bool) {
+	o.meta["global"] = global
+}
+
+func (o *ObjectMeta) IsGlobal() bool {
+	global, ok := o.meta["global"].(bool)
+	return ok && global
+}
+
+func (o *ObjectMeta) SetTypename(typename string) {
+	o.meta["typename"] = typename
+}
+
+func (o *ObjectMeta) Typename() string {
+	typename, _ := o.meta["typename"].(string)
+	return typename
+}
+
 func (o *ObjectMeta) AddKeyValue(key string, value interface{}) {
 	o.meta[key] = value
 }
 
+// GetKeyValue decodes the value stored under key into value, which should be
+// a pointer as in json.Unmarshal. Values which are stored as JSON encoded
+// strings by the C++ and Python clients (e.g., shapes) are decoded as well.
+func (o *ObjectMeta) GetKeyValue(key string, value interface{}) error {
+	item, ok := o.meta[key]
+	if !ok {
+		return fmt.Errorf("key '%s' doesn't exist in the metadata", key)
+	}
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, value); err == nil {
+		return nil
+	}
+	if str, ok := item.(string); ok {
+		if json.Unmarshal([]byte(str), value) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value at key '%s': %v", key, err)
+}
+
 func (o *ObjectMeta) HasKey(key string) bool {
 	if _, ok := o.meta[key]; !ok {
 		return false
@@ -55,26 +118,164 @@ func (o *ObjectMeta) HasKey(key string) bool {
 	return true
 }
 
+func (o *ObjectMeta) ResetKey(key string) {
+	delete(o.meta, key)
+}
+
 func (o *ObjectMeta) SetNBytes(nbytes int) {
 	o.meta["nbytes"] = nbytes
 }
 
+// GetNBytes returns 0 for objects that have no nbytes, e.g., global objects.
+func (o *ObjectMeta) GetNBytes() int {
+	nbytes, err := toUint64(o.meta["nbytes"])
+	if err != nil {
+		return 0
+	}
+	return int(nbytes)
+}
+
+// HasMember returns whether there is a member object (rather than a plain
+// key-value entry) named as name.
+func (o *ObjectMeta) HasMember(name string) bool {
+	_, ok := o.meta[name].(map[string]interface{})
+	return ok
+}
+
+// ListMembers returns the names of all member objects, in sorted order.
+func (o *ObjectMeta) ListMembers() []string {
+	members := make([]string, 0)
+	for key, value := range o.meta {
+		if _, ok := value.(map[string]interface{}); ok {
+			members = append(members, key)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// AddMember adds the metadata of the member object, the blobs referenced by
+// the member are added to the buffer set as well.
+func (o *ObjectMeta) AddMember(name string, member *ObjectMeta) error {
+	if _, ok := o.meta[name]; ok {
+		return fmt.Errorf("the key '%s' already exists in the metadata", name)
+	}
+	o.meta[name] = member.meta
+	o.bufferSet.Extend(&member.bufferSet)
+	return nil
+}
+
+// AddMemberID adds a member object by its id only, which makes the metadata
+// incomplete. The complete metadata will be resolved by vineyard when the
+// object is created.
+func (o *ObjectMeta) AddMemberID(name string, id common.ObjectID) error {
+	if _, ok := o.meta[name]; ok {
+		return fmt.Errorf("the key '%s' already exists in the metadata", name)
+	}
+	o.meta[name] = map[string]interface{}{"id": common.ObjectIDToString(id)}
+	o.inComplete = true
+	return nil
+}
+
+// GetMember returns the metadata of the member object named as name. The
+// blobs that have been resolved for this object are shared with the member.
+func (o *ObjectMeta) GetMember(name string) (*ObjectMeta, error) {
+	tree, ok := o.meta[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to get member '%s'", name)
+	}
+	member := &ObjectMeta{}
+	member.SetMetaData(o.client, tree)
+	for id := range member.bufferSet.buffers {
+		if blob, ok := o.bufferSet.buffers[id]; ok {
+			member.bufferSet.buffers[id] = blob
+		}
+	}
+	return member, nil
+}
+
+func (o *ObjectMeta) GetBufferSet() *BufferSet {
+	return &o.bufferSet
+}
+
+// SetBuffer sets the payload of a blob that the metadata refers to.
+func (o *ObjectMeta) SetBuffer(id common.ObjectID, blob *Blob) error {
+	if !o.bufferSet.Contains(id) {
+		return fmt.Errorf("the blob %s is not referred by the metadata", common.ObjectIDToString(id))
+	}
+	o.bufferSet.EmplaceBlob(blob)
+	return nil
+}
+
+// GetBuffer returns the blob that the metadata refers to, the payload of the
+// blob must have been fetched.
+func (o *ObjectMeta) GetBuffer(id common.ObjectID) (*Blob, error) {
+	blob, ok := o.bufferSet.Get(id)
+	if !ok || blob == nil {
+		return nil, fmt.Errorf("the blob %s is not available locally", common.ObjectIDToString(id))
+	}
+	return blob, nil
+}
+
 func (o *ObjectMeta) InComplete() bool {
 	return o.inComplete
 }
 
-func (o *ObjectMeta) MetaData() interface{} {
+func (o *ObjectMeta) MetaData() map[string]interface{} {
 	return o.meta
 }
 
 func (o *ObjectMeta) SetId(id common.ObjectID) {
-	o.meta["id"] = strconv.FormatUint(id, 10)
+	o.meta["id"] = common.ObjectIDToString(id)
+}
+
+func (o *ObjectMeta) GetId() (common.ObjectID, error) {
+	id, ok := o.meta["id"].(string)
+	if !ok || id == "" {
+		return common.InvalidObjectID(), fmt.Errorf("the metadata doesn't have a valid id")
+	}
+	return common.ObjectIDFromString(id)
 }
 
 func (o *ObjectMeta) SetSignature(signature common.Signature) {
 	o.meta["signature"] = signature
 }
 
+func (o *ObjectMeta) GetSignature() (common.Signature, error) {
+	return toUint64(o.meta["signature"])
+}
+
+// kLabelsKey is the key of the labels in the metadata, vineyard keeps the
+// labels as a JSON encoded object of strings.
+const kLabelsKey = "__labels"
+
+// Labels returns the labels of the object, the malformed labels are taken as
+// no labels.
+func (o *ObjectMeta) Labels() map[string]string {
+	labels := make(map[string]string)
+	if value, ok := o.meta[kLabelsKey].(string); ok {
+		if err := json.Unmarshal([]byte(value), &labels); err != nil {
+			return make(map[string]string)
+		}
+	}
+	return labels
+}
+
+// Label returns the value of the label, or "" if the object isn't labeled
+// with the key.
+func (o *ObjectMeta) Label(key string) string {
+	return o.Labels()[key]
+}
+
+// SetLabel labels the metadata before the object is created, the labels of
+// objects that have been created are changed by the Label of clients.
+func (o *ObjectMeta) SetLabel(key, value string) {
+	labels := o.Labels()
+	labels[key] = value
+	content, _ := json.Marshal(labels)
+	o.meta[kLabelsKey] = string(content)
+}
+
 func (o *ObjectMeta) Reset() {
 	o.client = nil
 	o.meta = make(map[string]interface{})
@@ -82,7 +283,73 @@ func (o *ObjectMeta) Reset() {
 	o.inComplete = false
 }
 
-func (o *ObjectMeta) SetMetaData(client *IIPCClient, val map[string]interface{}) {
+// SetMetaData replaces the metadata tree and collects the ids of all blobs
+// referenced by the tree into the buffer set. When a client is given only
+// blobs on the client's instance are collected.
+func (o *ObjectMeta) SetMetaData(client IClient, val map[string]interface{}) {
 	o.client = client
 	o.meta = val
+	o.bufferSet.Reset()
+	o.findAllBlobs(val)
+}
+
+// ParseMetaData decodes a metadata tree as returned by vineyard, keeping the
+// large integers (e.g., signatures) intact.
+func ParseMetaData(content []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var tree map[string]interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func (o *ObjectMeta) findAllBlobs(tree map[string]interface{}) {
+	if len(tree) == 0 {
+		return
+	}
+	idString, ok := tree["id"].(string)
+	if !ok || idString == "" {
+		return
+	}
+	id, err := common.ObjectIDFromString(idString)
+	if err != nil {
+		return
+	}
+	if common.IsBlob(id) {
+		if o.client == nil {
+			o.bufferSet.EmplaceBuffer(id)
+			return
+		}
+		instanceID, err := toUint64(tree["instance_id"])
+		if err == nil && instanceID == o.client.InstanceID() {
+			o.bufferSet.EmplaceBuffer(id)
+		}
+		return
+	}
+	for _, item := range tree {
+		if member, ok := item.(map[string]interface{}); ok {
+			o.findAllBlobs(member)
+		}
+	}
+}
+
+func toUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return strconv.ParseUint(v.String(), 10, 64)
+	case uint64:
+		return v, nil
+	case int:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case float64:
+		return uint64(v), nil
+	case nil:
+		return 0, fmt.Errorf("the value doesn't exist")
+	default:
+		return 0, fmt.Errorf("the value %v is not an integer", value)
+	}
 }
@@ -0,0 +1,157 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"testing"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+	"gotest.tools/v3/assert"
+)
+
+// a tensor's metadata, as the C++ client writes it
+const tensorMeta = `{
+	"id": "o0000fb9c2e16fd6a",
+	"typename": "vineyard::Tensor<double>",
+	"nbytes": 24,
+	"instance_id": 0,
+	"signature": 18446632004185316152,
+	"transient": true,
+	"value_type_": "double",
+	"shape_": "[3]",
+	"partition_index_": "[]",
+	"buffer_": {
+		"id": "o8000fb9c2e0d7a1c",
+		"typename": "vineyard::Blob",
+		"nbytes": 24,
+		"instance_id": 0,
+		"length": 24,
+		"transient": true
+	},
+	"remote_": {
+		"id": "o8000fb9c2e0d7a2c",
+		"typename": "vineyard::Blob",
+		"nbytes": 8,
+		"instance_id": 1,
+		"length": 8,
+		"transient": true
+	}
+}`
+
+type fakeClient struct {
+	instanceID common.InstanceID
+}
+
+func (f *fakeClient) InstanceID() common.InstanceID {
+	return f.instanceID
+}
+
+func TestObjectMeta_SetMetaData(t *testing.T) {
+	tree, err := ParseMetaData([]byte(tensorMeta))
+	assert.NilError(t, err)
+
+	var meta ObjectMeta
+	meta.SetMetaData(&fakeClient{instanceID: 0}, tree)
+
+	id, err := meta.GetId()
+	assert.NilError(t, err)
+	assert.Equal(t, id, common.ObjectID(0x0000fb9c2e16fd6a))
+	signature, err := meta.GetSignature()
+	assert.NilError(t, err)
+	assert.Equal(t, signature, common.Signature(18446632004185316152))
+	instanceID, err := meta.GetInstanceId()
+	assert.NilError(t, err)
+	assert.Equal(t, instanceID, common.InstanceID(0))
+	assert.Equal(t, meta.Typename(), "vineyard::Tensor<double>")
+	assert.Equal(t, meta.GetNBytes(), 24)
+	assert.Assert(t, meta.IsLocal())
+	assert.Assert(t, !meta.IsGlobal())
+
+	// only the local blob is collected
+	assert.DeepEqual(t, meta.GetBufferSet().AllBufferIds(), []common.ObjectID{0x8000fb9c2e0d7a1c})
+	assert.DeepEqual(t, meta.ListMembers(), []string{"buffer_", "remote_"})
+
+	var valueType string
+	assert.NilError(t, meta.GetKeyValue("value_type_", &valueType))
+	assert.Equal(t, valueType, "double")
+	var shape []int
+	assert.NilError(t, meta.GetKeyValue("shape_", &shape))
+	assert.DeepEqual(t, shape, []int{3})
+	assert.ErrorContains(t, meta.GetKeyValue("undefined_", &shape), "doesn't exist")
+
+	buffer, err := meta.GetMember("buffer_")
+	assert.NilError(t, err)
+	assert.Equal(t, buffer.Typename(), "vineyard::Blob")
+	assert.Equal(t, buffer.GetNBytes(), 24)
+	assert.DeepEqual(t, buffer.GetBufferSet().AllBufferIds(), []common.ObjectID{0x8000fb9c2e0d7a1c})
+
+	_, err = meta.GetMember("shape_")
+	assert.ErrorContains(t, err, "failed to get member")
+}
+
+func TestObjectMeta_SetMetaDataWithoutClient(t *testing.T) {
+	tree, err := ParseMetaData([]byte(tensorMeta))
+	assert.NilError(t, err)
+
+	var meta ObjectMeta
+	meta.SetMetaData(nil, tree)
+	assert.Equal(t, meta.GetBufferSet().Len(), 2)
+	assert.Assert(t, !meta.IsLocal())
+}
+
+func TestObjectMeta_AddMember(t *testing.T) {
+	tree, err := ParseMetaData([]byte(tensorMeta))
+	assert.NilError(t, err)
+	var tensor ObjectMeta
+	tensor.SetMetaData(nil, tree)
+
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Sequence")
+	assert.NilError(t, meta.AddMember("__elements_-0", &tensor))
+	assert.Assert(t, !meta.InComplete())
+	assert.Equal(t, meta.GetBufferSet().Len(), 2)
+
+	assert.NilError(t, meta.AddMemberID("__elements_-1", 0x0000fb9c2e16fd7a))
+	assert.Assert(t, meta.InComplete())
+	assert.ErrorContains(t, meta.AddMemberID("__elements_-1", 0x0000fb9c2e16fd7a), "already exists")
+	assert.DeepEqual(t, meta.ListMembers(), []string{"__elements_-0", "__elements_-1"})
+
+	member, err := meta.GetMember("__elements_-1")
+	assert.NilError(t, err)
+	id, err := member.GetId()
+	assert.NilError(t, err)
+	assert.Equal(t, id, common.ObjectID(0x0000fb9c2e16fd7a))
+}
+
+func TestObjectMeta_Labels(t *testing.T) {
+	var meta ObjectMeta
+	meta.Init()
+	assert.Equal(t, len(meta.Labels()), 0)
+	meta.SetLabel("k8s.v6d.io/job", "producer")
+	meta.SetLabel("app", "test")
+	assert.DeepEqual(t, meta.Labels(), map[string]string{"k8s.v6d.io/job": "producer", "app": "test"})
+	assert.Equal(t, meta.Label("app"), "test")
+	assert.Equal(t, meta.Label("missing"), "")
+
+	// the labels are kept as a JSON encoded string, as vineyard does
+	tree, err := ParseMetaData([]byte(`{"typename": "vineyard::Scalar<int>", "__labels": "{\"app\":\"test\"}"}`))
+	assert.NilError(t, err)
+	meta.SetMetaData(nil, tree)
+	assert.DeepEqual(t, meta.Labels(), map[string]string{"app": "test"})
+	meta.AddKeyValue("__labels", "malformed")
+	assert.Equal(t, len(meta.Labels()), 0)
+}
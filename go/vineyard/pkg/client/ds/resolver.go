@@ -0,0 +1,152 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// ObjectResolver builds a typed go value from the metadata of a vineyard
+// object, the payloads of the local blobs are available in the metadata.
+//
+// Resolvers of container types could resolve their members by ResolveObject.
+type ObjectResolver func(meta *ObjectMeta) (interface{}, error)
+
+var resolvers = struct {
+	sync.RWMutex
+	items map[string]ObjectResolver
+}{items: make(map[string]ObjectResolver)}
+
+// RegisterResolver registers the resolver for the given typename, it replaces
+// the resolver that has been registered for the same typename.
+//
+// The typename could be either a complete typename, e.g.,
+// `vineyard::Tensor<double>`, or a template name without arguments, e.g.,
+// `vineyard::Tensor`, which matches all instantiations of the template that
+// don't have their own resolver.
+func RegisterResolver(typename string, resolver ObjectResolver) {
+	resolvers.Lock()
+	defer resolvers.Unlock()
+	resolvers.items[typename] = resolver
+}
+
+// UnregisterResolver removes the resolver of the given typename.
+func UnregisterResolver(typename string) {
+	resolvers.Lock()
+	defer resolvers.Unlock()
+	delete(resolvers.items, typename)
+}
+
+// GetResolver returns the resolver for the given typename.
+func GetResolver(typename string) (ObjectResolver, bool) {
+	resolvers.RLock()
+	defer resolvers.RUnlock()
+	if resolver, ok := resolvers.items[typename]; ok {
+		return resolver, true
+	}
+	if index := strings.IndexByte(typename, '<'); index != -1 {
+		if resolver, ok := resolvers.items[typename[:index]]; ok {
+			return resolver, true
+		}
+	}
+	return nil, false
+}
+
+// ResolveObject builds the typed go value of the object by the resolver that
+// has been registered for its typename.
+func ResolveObject(meta *ObjectMeta) (interface{}, error) {
+	typename := meta.Typename()
+	resolver, ok := GetResolver(typename)
+	if !ok {
+		return nil, fmt.Errorf("no resolver has been registered for '%s'", typename)
+	}
+	return resolver(meta)
+}
+
+func resolveBlob(meta *ObjectMeta) (interface{}, error) {
+	id, err := meta.GetId()
+	if err != nil {
+		return nil, err
+	}
+	if id == common.EmptyBlobID() {
+		blob := &Blob{}
+		blob.Reset(id, 0, nil)
+		return blob, nil
+	}
+	return meta.GetBuffer(id)
+}
+
+// resolveSequence resolves a `vineyard::Sequence` as a slice of its resolved
+// elements.
+func resolveSequence(meta *ObjectMeta) (interface{}, error) {
+	var size int
+	if err := meta.GetKeyValue("__elements_-size", &size); err != nil {
+		return nil, err
+	}
+	elements := make([]interface{}, size)
+	for i := range elements {
+		member, err := meta.GetMember(fmt.Sprintf("__elements_-%d", i))
+		if err != nil {
+			return nil, err
+		}
+		if elements[i], err = ResolveObject(member); err != nil {
+			return nil, err
+		}
+	}
+	return elements, nil
+}
+
+func init() {
+	RegisterResolver("vineyard::Blob", resolveBlob)
+	RegisterResolver("vineyard::Sequence", resolveSequence)
+	RegisterResolver("vineyard::Tensor", func(meta *ObjectMeta) (interface{}, error) {
+		return ReadTensor(meta)
+	})
+	RegisterResolver(dataFrameTypename, func(meta *ObjectMeta) (interface{}, error) {
+		return ReadDataFrame(meta)
+	})
+
+	resolveArray := func(meta *ObjectMeta) (interface{}, error) {
+		return ReadArray(meta)
+	}
+	for _, typename := range []string{
+		"vineyard::NumericArray",
+		booleanArrayTypename,
+		"vineyard::BaseBinaryArray",
+		"vineyard::LargeStringArray",
+		"vineyard::LargeBinaryArray",
+		fixedSizeBinaryArrayTypename,
+		nullArrayTypename,
+		"vineyard::BaseListArray",
+		"vineyard::LargeListArray",
+		fixedSizeListArrayTypename,
+	} {
+		RegisterResolver(typename, resolveArray)
+	}
+	RegisterResolver(schemaProxyTypename, func(meta *ObjectMeta) (interface{}, error) {
+		return ReadSchema(meta)
+	})
+	RegisterResolver(recordBatchTypename, func(meta *ObjectMeta) (interface{}, error) {
+		return ReadRecordBatch(meta)
+	})
+	RegisterResolver(tableTypename, func(meta *ObjectMeta) (interface{}, error) {
+		return ReadTable(meta)
+	})
+}
@@ -0,0 +1,136 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/apache/arrow/go/arrow/tensor"
+	"gotest.tools/v3/assert"
+)
+
+// buildTensor writes a float64 tensor in the layout of the Python client.
+func buildTensor(t *testing.T, client *fakeIPCClient, values []float64, shape string) *ObjectMeta {
+	var writer BlobWriter
+	assert.NilError(t, client.CreateBlob(context.Background(), len(values)*8, &writer))
+	copy(writer.Bytes(), arrow.Float64Traits.CastToBytes(values))
+	blob, err := writer.Seal(context.Background())
+	assert.NilError(t, err)
+
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Tensor<double>")
+	meta.AddKeyValue("value_type_", "float64")
+	meta.AddKeyValue("shape_", shape)
+	meta.AddKeyValue("partition_index_", "[]")
+	meta.AddKeyValue("order_", `"C"`)
+	meta.SetNBytes(len(values) * 8)
+	assert.NilError(t, meta.AddMember("buffer_", newBlobMeta(client, blob)))
+	_, err = client.CreateMetaData(context.Background(), &meta)
+	assert.NilError(t, err)
+	return &meta
+}
+
+func TestResolveObject_Tensor(t *testing.T) {
+	client := &fakeIPCClient{}
+	meta := buildTensor(t, client, []float64{1, 2, 3, 4, 5, 6}, "[2, 3]")
+
+	object, err := ResolveObject(meta)
+	assert.NilError(t, err)
+	result, ok := object.(*Tensor)
+	assert.Assert(t, ok, "unexpected object: %T", object)
+	assert.Equal(t, result.DataType(), arrow.DataType(arrow.PrimitiveTypes.Float64))
+	assert.DeepEqual(t, result.Shape(), []int64{2, 3})
+	assert.DeepEqual(t, result.PartitionIndex(), []int64{})
+
+	arrowTensor := result.ToArrow().(*tensor.Float64)
+	defer arrowTensor.Release()
+	assert.Equal(t, arrowTensor.Value([]int64{1, 2}), float64(6))
+}
+
+func TestResolveObject_Sequence(t *testing.T) {
+	client := &fakeIPCClient{}
+	pool := memory.NewGoAllocator()
+	builder := array.NewStringBuilder(pool)
+	defer builder.Release()
+	builder.AppendValues([]string{"a", "b"}, nil)
+	arr := builder.NewArray()
+	defer arr.Release()
+
+	var arrayBuilder ArrayBuilder
+	arrayBuilder.Init(client, arr)
+	assert.NilError(t, arrayBuilder.Seal(context.Background()))
+
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Sequence")
+	meta.AddKeyValue("__elements_-size", 2)
+	assert.NilError(t, meta.AddMember("__elements_-0", arrayBuilder.Meta()))
+	assert.NilError(t, meta.AddMember("__elements_-1", buildTensor(t, client, []float64{math.Pi}, "[1]")))
+
+	object, err := ResolveObject(&meta)
+	assert.NilError(t, err)
+	elements, ok := object.([]interface{})
+	assert.Assert(t, ok, "unexpected object: %T", object)
+	assert.Equal(t, len(elements), 2)
+	assert.Equal(t, elements[0].(*array.String).Value(1), "b")
+	assert.Equal(t, elements[1].(*Tensor).ToArrow().(*tensor.Float64).Float64Values()[0], math.Pi)
+}
+
+type point struct {
+	x, y int
+}
+
+func TestRegisterResolver(t *testing.T) {
+	var meta ObjectMeta
+	meta.Init()
+	meta.SetTypename("my::Point<int>")
+	meta.AddKeyValue("x", 1)
+	meta.AddKeyValue("y", 2)
+
+	_, err := ResolveObject(&meta)
+	assert.ErrorContains(t, err, "no resolver")
+
+	RegisterResolver("my::Point", func(meta *ObjectMeta) (interface{}, error) {
+		var p point
+		if err := meta.GetKeyValue("x", &p.x); err != nil {
+			return nil, err
+		}
+		if err := meta.GetKeyValue("y", &p.y); err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	defer UnregisterResolver("my::Point")
+
+	object, err := ResolveObject(&meta)
+	assert.NilError(t, err)
+	assert.Equal(t, object, point{1, 2})
+
+	// the complete typename takes precedence over the template name
+	RegisterResolver("my::Point<int>", func(meta *ObjectMeta) (interface{}, error) {
+		return point{}, nil
+	})
+	defer UnregisterResolver("my::Point<int>")
+	object, err = ResolveObject(&meta)
+	assert.NilError(t, err)
+	assert.Equal(t, object, point{})
+}
@@ -0,0 +1,428 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/apache/arrow/go/arrow"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// The schema of record batches and tables is kept in vineyard as an arrow IPC
+// schema message. The arrow/ipc package can't be used here as the arrays in
+// vineyard are always large strings, large binaries and large lists, which
+// the go arrow library doesn't support, thus we encode and decode the schema
+// message (format/Message.fbs and format/Schema.fbs) by ourselves.
+
+const (
+	ipcContinuationMarker  = 0xFFFFFFFF
+	ipcMetadataVersionV5   = 4
+	ipcMessageHeaderSchema = 1
+)
+
+// the members of the `Type` union in format/Schema.fbs
+const (
+	fbTypeNull            = 1
+	fbTypeInt             = 2
+	fbTypeFloatingPoint   = 3
+	fbTypeBinary          = 4
+	fbTypeUtf8            = 5
+	fbTypeBool            = 6
+	fbTypeList            = 12
+	fbTypeFixedSizeBinary = 15
+	fbTypeFixedSizeList   = 16
+	fbTypeLargeBinary     = 19
+	fbTypeLargeUtf8       = 20
+	fbTypeLargeList       = 21
+)
+
+// the `Precision` enum in format/Schema.fbs
+const (
+	fbPrecisionHalf   = 0
+	fbPrecisionSingle = 1
+	fbPrecisionDouble = 2
+)
+
+// SerializeSchema encodes the schema as an encapsulated arrow IPC message,
+// strings, binaries and lists are encoded as their large variants.
+func SerializeSchema(schema *arrow.Schema) ([]byte, error) {
+	b := flatbuffers.NewBuilder(1024)
+
+	fields, err := writeFields(b, schema.Fields())
+	if err != nil {
+		return nil, err
+	}
+	metadata := writeKeyValues(b, schema.Metadata())
+
+	b.StartObject(4)
+	b.PrependInt16Slot(0, 0, 0) // little endian
+	b.PrependUOffsetTSlot(1, fields, 0)
+	if metadata != 0 {
+		b.PrependUOffsetTSlot(2, metadata, 0)
+	}
+	header := b.EndObject()
+
+	b.StartObject(5)
+	b.PrependInt16Slot(0, ipcMetadataVersionV5, 0)
+	b.PrependByteSlot(1, ipcMessageHeaderSchema, 0)
+	b.PrependUOffsetTSlot(2, header, 0)
+	b.Finish(b.EndObject())
+
+	message := b.FinishedBytes()
+	// the metadata is padded to make the message body 8-byte aligned
+	length := (len(message)+8+7)/8*8 - 8
+	content := make([]byte, 8+length)
+	binary.LittleEndian.PutUint32(content[0:], ipcContinuationMarker)
+	binary.LittleEndian.PutUint32(content[4:], uint32(length))
+	copy(content[8:], message)
+	return content, nil
+}
+
+func writeFields(b *flatbuffers.Builder, fields []arrow.Field) (flatbuffers.UOffsetT, error) {
+	offsets := make([]flatbuffers.UOffsetT, len(fields))
+	for i, field := range fields {
+		offset, err := writeField(b, field)
+		if err != nil {
+			return 0, err
+		}
+		offsets[i] = offset
+	}
+	b.StartVector(4, len(offsets), 4)
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	return b.EndVector(len(offsets)), nil
+}
+
+func writeField(b *flatbuffers.Builder, field arrow.Field) (flatbuffers.UOffsetT, error) {
+	typeType, typeOffset, children, err := writeType(b, field.Type)
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize field '%s': %v", field.Name, err)
+	}
+	childrenOffset, err := writeFields(b, children)
+	if err != nil {
+		return 0, err
+	}
+	metadata := writeKeyValues(b, field.Metadata)
+	name := b.CreateString(field.Name)
+
+	b.StartObject(7)
+	b.PrependUOffsetTSlot(0, name, 0)
+	b.PrependBoolSlot(1, field.Nullable, false)
+	b.PrependByteSlot(2, typeType, 0)
+	b.PrependUOffsetTSlot(3, typeOffset, 0)
+	b.PrependUOffsetTSlot(5, childrenOffset, 0)
+	if metadata != 0 {
+		b.PrependUOffsetTSlot(6, metadata, 0)
+	}
+	return b.EndObject(), nil
+}
+
+func writeType(b *flatbuffers.Builder, dtype arrow.DataType) (byte, flatbuffers.UOffsetT, []arrow.Field, error) {
+	writeInt := func(bitWidth int32, signed bool) flatbuffers.UOffsetT {
+		b.StartObject(2)
+		b.PrependInt32Slot(0, bitWidth, 0)
+		b.PrependBoolSlot(1, signed, false)
+		return b.EndObject()
+	}
+	writeFloat := func(precision int16) flatbuffers.UOffsetT {
+		b.StartObject(1)
+		b.PrependInt16Slot(0, precision, 0)
+		return b.EndObject()
+	}
+	writeEmpty := func() flatbuffers.UOffsetT {
+		b.StartObject(0)
+		return b.EndObject()
+	}
+
+	switch dtype.ID() {
+	case arrow.NULL:
+		return fbTypeNull, writeEmpty(), nil, nil
+	case arrow.BOOL:
+		return fbTypeBool, writeEmpty(), nil, nil
+	case arrow.INT8:
+		return fbTypeInt, writeInt(8, true), nil, nil
+	case arrow.UINT8:
+		return fbTypeInt, writeInt(8, false), nil, nil
+	case arrow.INT16:
+		return fbTypeInt, writeInt(16, true), nil, nil
+	case arrow.UINT16:
+		return fbTypeInt, writeInt(16, false), nil, nil
+	case arrow.INT32:
+		return fbTypeInt, writeInt(32, true), nil, nil
+	case arrow.UINT32:
+		return fbTypeInt, writeInt(32, false), nil, nil
+	case arrow.INT64:
+		return fbTypeInt, writeInt(64, true), nil, nil
+	case arrow.UINT64:
+		return fbTypeInt, writeInt(64, false), nil, nil
+	case arrow.FLOAT16:
+		return fbTypeFloatingPoint, writeFloat(fbPrecisionHalf), nil, nil
+	case arrow.FLOAT32:
+		return fbTypeFloatingPoint, writeFloat(fbPrecisionSingle), nil, nil
+	case arrow.FLOAT64:
+		return fbTypeFloatingPoint, writeFloat(fbPrecisionDouble), nil, nil
+	case arrow.STRING:
+		return fbTypeLargeUtf8, writeEmpty(), nil, nil
+	case arrow.BINARY:
+		return fbTypeLargeBinary, writeEmpty(), nil, nil
+	case arrow.FIXED_SIZE_BINARY:
+		b.StartObject(1)
+		b.PrependInt32Slot(0, int32(dtype.(*arrow.FixedSizeBinaryType).ByteWidth), 0)
+		return fbTypeFixedSizeBinary, b.EndObject(), nil, nil
+	case arrow.LIST:
+		item := arrow.Field{Name: "item", Type: dtype.(*arrow.ListType).Elem(), Nullable: true}
+		return fbTypeLargeList, writeEmpty(), []arrow.Field{item}, nil
+	case arrow.FIXED_SIZE_LIST:
+		listType := dtype.(*arrow.FixedSizeListType)
+		item := arrow.Field{Name: "item", Type: listType.Elem(), Nullable: true}
+		b.StartObject(1)
+		b.PrependInt32Slot(0, listType.Len(), 0)
+		return fbTypeFixedSizeList, b.EndObject(), []arrow.Field{item}, nil
+	default:
+		return 0, 0, nil, fmt.Errorf("unsupported arrow type: %s", dtype)
+	}
+}
+
+func writeKeyValues(b *flatbuffers.Builder, metadata arrow.Metadata) flatbuffers.UOffsetT {
+	if metadata.Len() == 0 {
+		return 0
+	}
+	offsets := make([]flatbuffers.UOffsetT, metadata.Len())
+	for i := range offsets {
+		key := b.CreateString(metadata.Keys()[i])
+		value := b.CreateString(metadata.Values()[i])
+		b.StartObject(2)
+		b.PrependUOffsetTSlot(0, key, 0)
+		b.PrependUOffsetTSlot(1, value, 0)
+		offsets[i] = b.EndObject()
+	}
+	b.StartVector(4, len(offsets), 4)
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	return b.EndVector(len(offsets))
+}
+
+// fbTable is a thin wrapper over the flatbuffers table for reading the
+// fields by slot.
+type fbTable struct {
+	flatbuffers.Table
+}
+
+func (t *fbTable) offset(slot int) flatbuffers.UOffsetT {
+	o := t.Offset(flatbuffers.VOffsetT(4 + 2*slot))
+	if o == 0 {
+		return 0
+	}
+	return flatbuffers.UOffsetT(o) + t.Pos
+}
+
+func (t *fbTable) stringAt(slot int) string {
+	if o := t.offset(slot); o != 0 {
+		return t.String(o)
+	}
+	return ""
+}
+
+func (t *fbTable) boolAt(slot int) bool {
+	if o := t.offset(slot); o != 0 {
+		return t.GetBool(o)
+	}
+	return false
+}
+
+func (t *fbTable) byteAt(slot int) byte {
+	if o := t.offset(slot); o != 0 {
+		return t.GetByte(o)
+	}
+	return 0
+}
+
+func (t *fbTable) int16At(slot int) int16 {
+	if o := t.offset(slot); o != 0 {
+		return t.GetInt16(o)
+	}
+	return 0
+}
+
+func (t *fbTable) int32At(slot int) int32 {
+	if o := t.offset(slot); o != 0 {
+		return t.GetInt32(o)
+	}
+	return 0
+}
+
+func (t *fbTable) tableAt(slot int) (fbTable, bool) {
+	var member fbTable
+	o := t.Offset(flatbuffers.VOffsetT(4 + 2*slot))
+	if o == 0 {
+		return member, false
+	}
+	t.Union(&member.Table, flatbuffers.UOffsetT(o))
+	return member, true
+}
+
+func (t *fbTable) tablesAt(slot int) []fbTable {
+	o := t.Offset(flatbuffers.VOffsetT(4 + 2*slot))
+	if o == 0 {
+		return nil
+	}
+	n := t.VectorLen(flatbuffers.UOffsetT(o))
+	start := t.Vector(flatbuffers.UOffsetT(o))
+	members := make([]fbTable, n)
+	for i := range members {
+		members[i].Bytes = t.Bytes
+		members[i].Pos = t.Indirect(start + flatbuffers.UOffsetT(i*4))
+	}
+	return members
+}
+
+// DeserializeSchema decodes the arrow IPC schema message written by
+// SerializeSchema, or by the C++ and Python clients. Large strings, large
+// binaries and large lists are decoded as their regular variants in go.
+func DeserializeSchema(content []byte) (schema *arrow.Schema, err error) {
+	defer func() {
+		// the flatbuffers library panics on malformed buffers
+		if r := recover(); r != nil {
+			schema, err = nil, fmt.Errorf("invalid schema message: %v", r)
+		}
+	}()
+
+	if len(content) < 4 {
+		return nil, fmt.Errorf("invalid schema message: too short")
+	}
+	if binary.LittleEndian.Uint32(content) == ipcContinuationMarker {
+		content = content[4:]
+	}
+	if len(content) < 4 {
+		return nil, fmt.Errorf("invalid schema message: too short")
+	}
+	length := int(binary.LittleEndian.Uint32(content))
+	if length > len(content)-4 {
+		return nil, fmt.Errorf("invalid schema message: truncated")
+	}
+	content = content[4 : 4+length]
+
+	var message fbTable
+	message.Bytes = content
+	message.Pos = flatbuffers.GetUOffsetT(content)
+	if message.byteAt(1) != ipcMessageHeaderSchema {
+		return nil, fmt.Errorf("invalid schema message: not a schema")
+	}
+	header, ok := message.tableAt(2)
+	if !ok {
+		return nil, fmt.Errorf("invalid schema message: no header")
+	}
+	fields, err := readFields(header.tablesAt(1))
+	if err != nil {
+		return nil, err
+	}
+	metadata := readKeyValues(header.tablesAt(2))
+	return arrow.NewSchema(fields, &metadata), nil
+}
+
+func readFields(tables []fbTable) ([]arrow.Field, error) {
+	fields := make([]arrow.Field, len(tables))
+	for i := range tables {
+		children, err := readFields(tables[i].tablesAt(5))
+		if err != nil {
+			return nil, err
+		}
+		fields[i].Name = tables[i].stringAt(0)
+		fields[i].Nullable = tables[i].boolAt(1)
+		fields[i].Metadata = readKeyValues(tables[i].tablesAt(6))
+		dtype, _ := tables[i].tableAt(3)
+		if fields[i].Type, err = readType(tables[i].byteAt(2), &dtype, children); err != nil {
+			return nil, fmt.Errorf("failed to deserialize field '%s': %v", fields[i].Name, err)
+		}
+	}
+	return fields, nil
+}
+
+func readType(typeType byte, dtype *fbTable, children []arrow.Field) (arrow.DataType, error) {
+	switch typeType {
+	case fbTypeNull:
+		return arrow.Null, nil
+	case fbTypeBool:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case fbTypeInt:
+		switch bitWidth, signed := dtype.int32At(0), dtype.boolAt(1); {
+		case bitWidth == 8 && signed:
+			return arrow.PrimitiveTypes.Int8, nil
+		case bitWidth == 8:
+			return arrow.PrimitiveTypes.Uint8, nil
+		case bitWidth == 16 && signed:
+			return arrow.PrimitiveTypes.Int16, nil
+		case bitWidth == 16:
+			return arrow.PrimitiveTypes.Uint16, nil
+		case bitWidth == 32 && signed:
+			return arrow.PrimitiveTypes.Int32, nil
+		case bitWidth == 32:
+			return arrow.PrimitiveTypes.Uint32, nil
+		case bitWidth == 64 && signed:
+			return arrow.PrimitiveTypes.Int64, nil
+		case bitWidth == 64:
+			return arrow.PrimitiveTypes.Uint64, nil
+		default:
+			return nil, fmt.Errorf("unsupported integer bit width: %d", bitWidth)
+		}
+	case fbTypeFloatingPoint:
+		switch precision := dtype.int16At(0); precision {
+		case fbPrecisionHalf:
+			return arrow.FixedWidthTypes.Float16, nil
+		case fbPrecisionSingle:
+			return arrow.PrimitiveTypes.Float32, nil
+		case fbPrecisionDouble:
+			return arrow.PrimitiveTypes.Float64, nil
+		default:
+			return nil, fmt.Errorf("unsupported floating point precision: %d", precision)
+		}
+	case fbTypeUtf8, fbTypeLargeUtf8:
+		return arrow.BinaryTypes.String, nil
+	case fbTypeBinary, fbTypeLargeBinary:
+		return arrow.BinaryTypes.Binary, nil
+	case fbTypeFixedSizeBinary:
+		return &arrow.FixedSizeBinaryType{ByteWidth: int(dtype.int32At(0))}, nil
+	case fbTypeList, fbTypeLargeList:
+		if len(children) != 1 {
+			return nil, fmt.Errorf("list type should have exactly one child")
+		}
+		return arrow.ListOf(children[0].Type), nil
+	case fbTypeFixedSizeList:
+		if len(children) != 1 {
+			return nil, fmt.Errorf("fixed size list type should have exactly one child")
+		}
+		return arrow.FixedSizeListOf(dtype.int32At(0), children[0].Type), nil
+	default:
+		return nil, fmt.Errorf("unsupported arrow type: %d", typeType)
+	}
+}
+
+func readKeyValues(tables []fbTable) arrow.Metadata {
+	if len(tables) == 0 {
+		return arrow.Metadata{}
+	}
+	keys := make([]string, len(tables))
+	values := make([]string, len(tables))
+	for i := range tables {
+		keys[i] = tables[i].stringAt(0)
+		values[i] = tables[i].stringAt(1)
+	}
+	return arrow.NewMetadata(keys, values)
+}
@@ -0,0 +1,268 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/apache/arrow/go/arrow/tensor"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+const tensorTypename = "vineyard::Tensor<%s>"
+
+var tensorPattern = regexp.MustCompile(`^vineyard::Tensor<(.+)>$`)
+
+// the value types of `vineyard::Tensor<T>`, named as the Python client does
+var tensorTypeNames = map[arrow.Type]string{
+	arrow.INT8:    "int8",
+	arrow.UINT8:   "uint8",
+	arrow.INT16:   "int16",
+	arrow.UINT16:  "uint16",
+	arrow.INT32:   "int",
+	arrow.UINT32:  "uint32",
+	arrow.INT64:   "int64",
+	arrow.UINT64:  "uint64",
+	arrow.FLOAT32: "float",
+	arrow.FLOAT64: "double",
+}
+
+// Tensor is a dense numeric `vineyard::Tensor<T>`, the data refers to the
+// blob directly and must not be modified.
+type Tensor struct {
+	dtype          arrow.DataType
+	shape          []int64
+	partitionIndex []int64
+	columnMajor    bool
+	buffer         *memory.Buffer
+}
+
+func (t *Tensor) DataType() arrow.DataType {
+	return t.dtype
+}
+
+func (t *Tensor) Shape() []int64 {
+	return t.shape
+}
+
+func (t *Tensor) PartitionIndex() []int64 {
+	return t.partitionIndex
+}
+
+func (t *Tensor) Data() []byte {
+	if t.buffer == nil {
+		return nil
+	}
+	return t.buffer.Bytes()
+}
+
+// ToArrow returns the arrow tensor that shares the data with this tensor.
+func (t *Tensor) ToArrow() tensor.Interface {
+	data := array.NewData(t.dtype, t.size(), []*memory.Buffer{nil, t.buffer}, nil, 0, 0)
+	defer data.Release()
+	var strides []int64
+	if t.columnMajor {
+		strides = make([]int64, len(t.shape))
+		stride := int64(t.dtype.(arrow.FixedWidthDataType).BitWidth() / 8)
+		for i, dim := range t.shape {
+			strides[i] = stride
+			stride *= dim
+		}
+	}
+	return tensor.New(data, t.shape, strides, nil)
+}
+
+func (t *Tensor) size() int {
+	size := int64(1)
+	for _, dim := range t.shape {
+		size *= dim
+	}
+	return int(size)
+}
+
+// ReadTensor rebuilds the tensor from the metadata of a `vineyard::Tensor<T>`
+// written by the C++ or Python client.
+func ReadTensor(meta *ObjectMeta) (*Tensor, error) {
+	matches := tensorPattern.FindStringSubmatch(meta.Typename())
+	if matches == nil {
+		return nil, fmt.Errorf("'%s' is not a tensor", meta.Typename())
+	}
+	dtype, ok := numericTypes[matches[1]]
+	if !ok {
+		// the Python client names the value type as numpy does
+		var valueType string
+		if err := meta.GetKeyValue("value_type_", &valueType); err == nil {
+			dtype, ok = numericTypes[valueType]
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported value type of tensor: %s", matches[1])
+	}
+
+	t := &Tensor{dtype: dtype}
+	if err := meta.GetKeyValue("shape_", &t.shape); err != nil {
+		return nil, err
+	}
+	if meta.HasKey("partition_index_") {
+		if err := meta.GetKeyValue("partition_index_", &t.partitionIndex); err != nil {
+			return nil, err
+		}
+	}
+	if meta.HasKey("order_") {
+		var order string
+		if err := meta.GetKeyValue("order_", &order); err != nil {
+			return nil, err
+		}
+		t.columnMajor = strings.Trim(order, `"`) == "F"
+	}
+	buffer, err := readMemberBuffer(meta, "buffer_")
+	if err != nil {
+		return nil, err
+	}
+	t.buffer = buffer
+	if size := t.size() * dtype.(arrow.FixedWidthDataType).BitWidth() / 8; size > len(t.Data()) {
+		return nil, fmt.Errorf("the tensor buffer is too short: %d < %d", len(t.Data()), size)
+	}
+	return t, nil
+}
+
+// TensorBuilder writes an arrow tensor to vineyard as a `vineyard::Tensor<T>`
+// in the layout of the Python client, so that the tensor can be read as a
+// numpy array. The tensor must be contiguous, in either row major or column
+// major order.
+type TensorBuilder struct {
+	ObjectBuilder
+
+	Tensor         tensor.Interface
+	PartitionIndex []int64
+	Client         IIPCClient
+
+	meta ObjectMeta
+	id   common.ObjectID
+}
+
+func (t *TensorBuilder) Init(client IIPCClient, tensor tensor.Interface) {
+	t.Client = client
+	t.Tensor = tensor
+	t.id = common.InvalidObjectID()
+}
+
+// Seal builds the tensor and creates it in vineyard.
+func (t *TensorBuilder) Seal(ctx context.Context) error {
+	if t.sealed {
+		return errors.New("the builder has been already sealed")
+	}
+	if err := t.Build(ctx); err != nil {
+		return err
+	}
+	id, err := t.Client.CreateMetaData(ctx, &t.meta)
+	if err != nil {
+		return err
+	}
+	t.id = id
+	t.SetSeal(true)
+	return nil
+}
+
+// Build copies the data of the tensor to a blob and fills the metadata.
+func (t *TensorBuilder) Build(ctx context.Context) error {
+	dtype := t.Tensor.DataType()
+	typeName, ok := tensorTypeNames[dtype.ID()]
+	if !ok {
+		return fmt.Errorf("unsupported value type of tensor: %s", dtype)
+	}
+	order := "C"
+	if !t.Tensor.IsRowMajor() {
+		if !t.Tensor.IsColMajor() {
+			return errors.New("the tensor is not contiguous")
+		}
+		order = "F"
+	}
+	width := dtype.(arrow.FixedWidthDataType).BitWidth() / 8
+	data := t.Tensor.Data()
+	begin, end := data.Offset()*width, (data.Offset()+t.Tensor.Len())*width
+	buffer := bufferBytes(data, 1)
+	if len(buffer) < end {
+		return fmt.Errorf("the tensor buffer is too short: %d < %d", len(buffer), end)
+	}
+
+	t.meta.Init()
+	t.meta.SetTypename(fmt.Sprintf(tensorTypename, typeName))
+	t.meta.AddKeyValue("value_type_", dtype.Name())
+	t.meta.AddKeyValue("value_type_meta_", numpyTypeString(dtype.ID(), width))
+	partitionIndex := t.PartitionIndex
+	if partitionIndex == nil {
+		partitionIndex = []int64{}
+	}
+	// the shape, the partition index and the order are encoded as JSON
+	// strings, as the Python client does
+	if err := t.addJSONValue("shape_", t.Tensor.Shape()); err != nil {
+		return err
+	}
+	if err := t.addJSONValue("partition_index_", partitionIndex); err != nil {
+		return err
+	}
+	if err := t.addJSONValue("order_", order); err != nil {
+		return err
+	}
+	t.meta.SetNBytes(end - begin)
+	blob, err := buildBlob(ctx, t.Client, buffer[begin:end])
+	if err != nil {
+		return err
+	}
+	return t.meta.AddMember("buffer_", blob)
+}
+
+func (t *TensorBuilder) addJSONValue(key string, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	t.meta.AddKeyValue(key, string(content))
+	return nil
+}
+
+func (t *TensorBuilder) Meta() *ObjectMeta {
+	return &t.meta
+}
+
+func (t *TensorBuilder) Id() common.ObjectID {
+	return t.id
+}
+
+// numpyTypeString is the `dtype.str` of numpy, e.g., "<f8", assuming the
+// little endian.
+func numpyTypeString(id arrow.Type, width int) string {
+	kind := "i"
+	switch id {
+	case arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		kind = "u"
+	case arrow.FLOAT32, arrow.FLOAT64:
+		kind = "f"
+	}
+	if width == 1 {
+		return fmt.Sprintf("|%s%d", kind, width)
+	}
+	return fmt.Sprintf("<%s%d", kind, width)
+}
@@ -0,0 +1,87 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/apache/arrow/go/arrow/tensor"
+	"gotest.tools/v3/assert"
+)
+
+// newTensor returns the arrow tensor of the values, the strides follow the
+// row major order unless given.
+func newTensor(values []int32, shape, strides []int64) *tensor.Int32 {
+	builder := array.NewInt32Builder(memory.NewGoAllocator())
+	defer builder.Release()
+	builder.AppendValues(values, nil)
+	arr := builder.NewArray()
+	defer arr.Release()
+	return tensor.NewInt32(arr.Data(), shape, strides, nil)
+}
+
+func TestTensorBuilder(t *testing.T) {
+	value := newTensor([]int32{1, 2, 3, 4, 5, 6}, []int64{2, 3}, nil)
+	defer value.Release()
+
+	client := &fakeIPCClient{}
+	var builder TensorBuilder
+	builder.Init(client, value)
+	builder.PartitionIndex = []int64{0, 1}
+	assert.NilError(t, builder.Seal(context.Background()))
+	assert.ErrorContains(t, builder.Seal(context.Background()), "already sealed")
+
+	meta := builder.Meta()
+	assert.Equal(t, meta.Typename(), "vineyard::Tensor<int>")
+	assert.Equal(t, meta.MetaData()["value_type_"], "int32")
+	assert.Equal(t, meta.MetaData()["value_type_meta_"], "<i4")
+	assert.Equal(t, meta.MetaData()["shape_"], "[2,3]")
+	assert.Equal(t, meta.MetaData()["partition_index_"], "[0,1]")
+	assert.Equal(t, meta.MetaData()["order_"], `"C"`)
+	assert.Equal(t, meta.GetNBytes(), 6*4)
+	id, err := meta.GetId()
+	assert.NilError(t, err)
+	assert.Equal(t, id, builder.Id())
+
+	result, err := ReadTensor(meta)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.Shape(), []int64{2, 3})
+	assert.DeepEqual(t, result.PartitionIndex(), []int64{0, 1})
+	assert.DeepEqual(t, arrow.Int32Traits.CastFromBytes(result.Data()), []int32{1, 2, 3, 4, 5, 6})
+
+	// the column major tensors are kept in order
+	columnMajor := newTensor([]int32{1, 4, 2, 5, 3, 6}, []int64{2, 3}, []int64{4, 8})
+	defer columnMajor.Release()
+	builder.Init(client, columnMajor)
+	builder.SetSeal(false)
+	assert.NilError(t, builder.Seal(context.Background()))
+	assert.Equal(t, builder.Meta().MetaData()["order_"], `"F"`)
+	result, err = ReadTensor(builder.Meta())
+	assert.NilError(t, err)
+	arrowTensor := result.ToArrow().(*tensor.Int32)
+	defer arrowTensor.Release()
+	assert.Equal(t, arrowTensor.Value([]int64{1, 2}), int32(6))
+
+	strided := newTensor([]int32{1, 2, 3, 4, 5, 6}, []int64{3}, []int64{8})
+	defer strided.Release()
+	builder.Init(client, strided)
+	builder.SetSeal(false)
+	assert.ErrorContains(t, builder.Seal(context.Background()), "not contiguous")
+}
@@ -16,85 +16,82 @@ limitations under the License.
 package vineyard
 
 import (
-	"encoding/binary"
-	"errors"
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"time"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
 )
 
-const kNumConnectAttempts = 10
-const kConnectTimeoutMs = 1000
+// kConnectRetryInterval is the interval between the attempts to connect.
+const kConnectRetryInterval = 200 * time.Millisecond
 
-func ConnectIPCSocketRetry(pathname string, conn **net.UnixConn) error {
-	var numRetries int = kNumConnectAttempts
-	var timeout int64 = kConnectTimeoutMs
+// kNumConnectAttempts is the number of attempts to connect when the context
+// has no deadline, otherwise the attempts keep going until the deadline.
+const kNumConnectAttempts = 10
 
-	err := ConnectIPCSocket(pathname, conn)
-	for {
-		if err == nil || numRetries < 0 {
-			break
-		}
-		fmt.Println("Connecting to IPC socket failed for pathname", pathname, "with ret err", err.Error(),
-			", retrying", numRetries, "more times.")
-		time.Sleep(time.Duration(timeout) * time.Millisecond)
-		err = ConnectIPCSocket(pathname, conn)
-		numRetries--
-	}
+func ConnectIPCSocketRetry(ctx context.Context, pathname string, conn **net.UnixConn) error {
+	err := connectRetry(ctx, func() error {
+		return ConnectIPCSocket(ctx, pathname, conn)
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("connecting to IPC socket %s failed: %w", pathname, err)
 	}
 	return nil
 }
 
-func ConnectIPCSocket(pathname string, conn **net.UnixConn) error {
-	addr, err := net.ResolveUnixAddr("unix", pathname)
-	if err != nil {
-		return err
-	}
-
-	*conn, err = net.DialUnix("unix", nil, addr)
+func ConnectIPCSocket(ctx context.Context, pathname string, conn **net.UnixConn) error {
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "unix", pathname)
 	if err != nil {
 		return err
 	}
-
+	*conn = c.(*net.UnixConn)
 	return nil
 }
 
-func ConnectRPCSocket(host string, port uint16, conn *net.Conn) error {
+func ConnectRPCSocket(ctx context.Context, host string, port uint16, conn *net.Conn) error {
+	var dialer net.Dialer
 	var err error
-	tcpAddr, err := net.ResolveTCPAddr("tcp", host+":"+strconv.Itoa(int(port)))
-	if err != nil {
-		return err
-	}
+	*conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	return err
+}
 
-	*conn, err = net.DialTCP("tcp", nil, tcpAddr)
+func ConnectRPCSocketRetry(ctx context.Context, host string, port uint16, conn *net.Conn) error {
+	err := connectRetry(ctx, func() error {
+		return ConnectRPCSocket(ctx, host, port, conn)
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("connecting to RPC socket %s:%d failed: %w", host, port, err)
 	}
 	return nil
 }
 
-func ConnectRPCSocketRetry(host string, port uint16, conn *net.Conn) error {
-	var numRetries int = kNumConnectAttempts
-	var timeout int64 = kConnectTimeoutMs
-
-	err := ConnectRPCSocket(host, port, conn)
-	for {
-		if err == nil || numRetries < 0 {
-			break
+// connectRetry calls connect until it succeeds, it returns the last error of
+// connect once the attempts run out, or the error of the context once the
+// context is done.
+func connectRetry(ctx context.Context, connect func() error) error {
+	_, bounded := ctx.Deadline()
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+		if !bounded && attempt >= kNumConnectAttempts {
+			return err
+		}
+		common.GetLogger().Debugf("connect attempt %d failed: %v, retrying", attempt, err)
+		timer := time.NewTimer(kConnectRetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
 		}
-		fmt.Println("Connecting to RPC socket failed for endpoint", host, ":", port, "with ret = ", err.Error(),
-			", retrying", numRetries, "more times.")
-		time.Sleep(time.Duration(timeout) * time.Millisecond)
-		err = ConnectRPCSocket(host, port, conn)
-		numRetries--
-	}
-	if err != nil {
-		return err
 	}
-	return nil
 }
 
 func SendBytes(conn net.Conn, data []byte, length int) error {
@@ -103,7 +100,7 @@ func SendBytes(conn net.Conn, data []byte, length int) error {
 	for bytesLeft > 0 {
 		nBytes, err := conn.Write(data[offset:length])
 		if err != nil {
-			return errors.New(fmt.Sprintf("Send message failed :%s", err.Error()))
+			return fmt.Errorf("Send message failed :%w", err)
 		}
 		bytesLeft -= nBytes
 		offset += nBytes
@@ -111,45 +108,31 @@ func SendBytes(conn net.Conn, data []byte, length int) error {
 	return nil
 }
 
+// SendMessage sends the message with its length ahead, see also
+// common.WriteMessage.
 func SendMessage(conn net.Conn, msg string) error {
-	// TODO: check 32 bits platform is also works
-	length := len(msg)
-	lengthBytes := make([]byte, strconv.IntSize/8)
-	binary.LittleEndian.PutUint64(lengthBytes, uint64(length))
-	if err := SendBytes(conn, lengthBytes, strconv.IntSize/8); err != nil {
-		return err
-	}
-	if err := SendBytes(conn, []byte(msg), length); err != nil {
-		return err
+	if err := common.WriteMessage(conn, []byte(msg), common.DEFAULT_MAX_MESSAGE_SIZE); err != nil {
+		return fmt.Errorf("Send message failed :%w", err)
 	}
 	return nil
 }
 
-func RecvBytes(conn net.Conn, data []byte, length int) error {
-	var bytesLeft int = length
-	var offset int = 0
-	for bytesLeft > 0 {
-		nBytes, err := conn.Read(data[offset:length])
-		if err != nil {
-			return errors.New(fmt.Sprintf("Receive message failed :%s", err.Error()))
-		}
-		bytesLeft -= nBytes
-		offset += nBytes
+// RecvBytes receives the raw content, the reader is the codec of the client
+// if the content follows a reply.
+func RecvBytes(r io.Reader, data []byte, length int) error {
+	if _, err := io.ReadFull(r, data[:length]); err != nil {
+		return fmt.Errorf("Receive message failed :%w", err)
 	}
 	return nil
 }
 
+// RecvMessage receives a message without reading ahead, see also
+// common.ReadMessage.
 func RecvMessage(conn net.Conn, msg *string) error {
-	lengthBytes := make([]byte, strconv.IntSize/8)
-
-	if err := RecvBytes(conn, lengthBytes, strconv.IntSize/8); err != nil {
-		return err
-	}
-	var length uint64 = binary.LittleEndian.Uint64(lengthBytes)
-	stringBytes := make([]byte, length)
-	if err := RecvBytes(conn, stringBytes, int(length)); err != nil {
-		return err
+	message, err := common.ReadMessage(conn, common.DEFAULT_MAX_MESSAGE_SIZE)
+	if err != nil {
+		return fmt.Errorf("Receive message failed :%w", err)
 	}
-	*msg = string(stringBytes)
+	*msg = string(message)
 	return nil
 }
@@ -16,15 +16,20 @@ limitations under the License.
 package vineyard
 
 import (
+	"context"
 	"net"
+	"path/filepath"
+	"strconv"
 	"testing"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
 )
 
-// need root permission to run
 func TestConnectIPCSocketRetry(t *testing.T) {
-	var pathname string = "/var/run/vineyard.sock"
+	ctx := vineyardtest.Context(t)
+	var pathname string = vineyardtest.Start(t, nil).IPCSocket()
 	conn := new(net.UnixConn)
-	err := ConnectIPCSocketRetry(pathname, &conn)
+	err := ConnectIPCSocketRetry(ctx, pathname, &conn)
 	if err != nil {
 		t.Fatal("Connect to IPC socket failed", err.Error())
 	}
@@ -32,12 +37,28 @@ func TestConnectIPCSocketRetry(t *testing.T) {
 }
 
 func TestConnectRPCSocketRetry(t *testing.T) {
-	var host string = "127.0.0.1"
-	var port uint16 = 9600
+	ctx := vineyardtest.Context(t)
+	host, portString, err := net.SplitHostPort(vineyardtest.Start(t, nil).RPCEndpoint())
+	if err != nil {
+		t.Fatal("invalid rpc endpoint", err)
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		t.Fatal("invalid rpc port", err)
+	}
 	var conn net.Conn
-	err := ConnectRPCSocketRetry(host, port, &conn)
+	err = ConnectRPCSocketRetry(ctx, host, uint16(port), &conn)
 	if err != nil {
 		t.Fatal("Connect to IPC socket failed", err.Error())
 	}
 	conn.Close()
 }
+
+func TestConnectIPCSocketRetry_Attempts(t *testing.T) {
+	pathname := filepath.Join(t.TempDir(), "missing.sock")
+	conn := new(net.UnixConn)
+	err := ConnectIPCSocketRetry(context.Background(), pathname, &conn)
+	if err == nil {
+		t.Fatal("connecting to a missing socket should fail")
+	}
+}
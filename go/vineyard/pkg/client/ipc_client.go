@@ -16,20 +16,21 @@ limitations under the License.
 package vineyard
 
 /*
-#cgo CFLAGS: -I ../common/memory
-#cgo LDFLAGS: -L ../common/memory -lfling
+#cgo CFLAGS: -I ${SRCDIR}/../common/memory
+#cgo LDFLAGS: -L ${SRCDIR}/../common/memory -lfling -lstdc++
 
 #include <sys/mman.h>
 
 #include "fling.h"
 */
-// nolint: typecheck
-import "C"
+import "C" // nolint: typecheck
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"syscall"
 	"unsafe"
 
 	"github.com/apache/arrow/go/arrow/memory"
@@ -39,13 +40,20 @@ import (
 
 type IPCClient struct {
 	ClientBase
-	connected     bool
+	// endpoint and options are the ones that the client is connected with,
+	// ipcSocket is the socket of the session that the client is redirected to.
+	endpoint      string
+	options       connectOptions
 	ipcSocket     string
-	conn          *net.UnixConn
-	instanceID    int
+	sessionID     common.SessionID
 	serverVersion string
 	rpcEndpoint   string
-	mmapTable     map[int]MmapEntry
+	mmapTable     map[int]*MmapEntry
+	usages        map[common.ObjectID]*blobUsage
+	tracker       *blobTracker
+	// staleMmaps is the shared memory of the previous connections that is
+	// still referred to by blobs, which is unmapped on disconnect.
+	staleMmaps []*MmapEntry
 }
 
 type MmapEntry struct {
@@ -55,74 +63,212 @@ type MmapEntry struct {
 	realign   bool
 	roPointer unsafe.Pointer
 	rwPointer unsafe.Pointer
+	// refCount is the number of blobs in use in the mapped memory
+	refCount int
 }
 
-func (m *MmapEntry) MapReadOnly() {
-	m.roPointer = C.mmap(nil, C.ulong(m.mapSize), C.PROT_READ, C.MAP_SHARED, C.int(m.clientFd), 0)
-	// TODO: error fix
+// length is the size of the region to map, the allocator on the server side
+// leaves a gap at the end of each segment which shouldn't be mapped when
+// realign is required.
+func (m *MmapEntry) length() int64 {
+	if m.realign {
+		return m.mapSize - int64(unsafe.Sizeof(C.size_t(0)))
+	}
+	return m.mapSize
+}
+
+func (m *MmapEntry) MapReadOnly() error {
+	if m.roPointer != nil {
+		return nil
+	}
+	pointer, err := C.mmap(nil, C.size_t(m.length()), C.PROT_READ, C.MAP_SHARED, C.int(m.clientFd), 0)
+	if uintptr(pointer) == ^uintptr(0) {
+		return fmt.Errorf("failed to mmap received fd as a readonly buffer: %v", err)
+	}
+	m.roPointer = pointer
+	return nil
+}
+
+func (m *MmapEntry) MapReadWrite() error {
+	if m.rwPointer != nil {
+		return nil
+	}
+	pointer, err := C.mmap(nil, C.size_t(m.length()), C.PROT_READ|C.PROT_WRITE, C.MAP_SHARED, C.int(m.clientFd), 0)
+	if uintptr(pointer) == ^uintptr(0) {
+		return fmt.Errorf("failed to mmap received fd as a writable buffer: %v", err)
+	}
+	m.rwPointer = pointer
+	return nil
 }
 
-func (m *MmapEntry) MapReadWrite() {
-	m.rwPointer = C.mmap(nil, C.ulong(m.mapSize), C.PROT_READ|C.PROT_WRITE, C.MAP_SHARED, C.int(m.clientFd), 0)
+// Unmap unmaps the memory, the received fd is kept as the server never sends
+// it again, and the memory is mapped again on demand.
+func (m *MmapEntry) Unmap() error {
+	if m.roPointer != nil {
+		if r, err := C.munmap(m.roPointer, C.size_t(m.length())); r != 0 {
+			return fmt.Errorf("failed to munmap the readonly buffer: %v", err)
+		}
+		m.roPointer = nil
+	}
+	if m.rwPointer != nil {
+		if r, err := C.munmap(m.rwPointer, C.size_t(m.length())); r != 0 {
+			return fmt.Errorf("failed to munmap the writable buffer: %v", err)
+		}
+		m.rwPointer = nil
+	}
+	return nil
 }
 
 // Connect to IPCClient steps as follows
 // 1. using unix socket connecct to vineyead server
 // 2. sending register request to server and get response from server
 // Note: you should send message's length first to server, then send message
-func (i *IPCClient) Connect(ipcSocket string) error {
-	if i.connected || i.ipcSocket == ipcSocket {
-		return nil
+//
+// The client is safe for concurrent use, and the connection is re-established
+// when it has been broken. The client connects to the session of the ipc
+// socket unless another session is specified by the options.
+func (i *IPCClient) Connect(ctx context.Context, ipcSocket string, options ...ConnectOption) error {
+	var opts connectOptions
+	for _, option := range options {
+		option(&opts)
 	}
-	i.ipcSocket = ipcSocket
-	i.conn = new(net.UnixConn)
-	if err := ConnectIPCSocketRetry(i.ipcSocket, &i.conn); err != nil {
+	if err := i.acquire(ctx); err != nil {
 		return err
 	}
-	i.ClientBase.conn = i.conn
-	var messageOut string
-	common.WriteRegisterRequest(&messageOut)
-	if err := i.DoWrite(messageOut); err != nil {
+	defer i.release()
+	if i.connected {
+		if i.endpoint == ipcSocket && i.options == opts {
+			return nil
+		}
+		return fmt.Errorf("the client has been connected to %s", i.endpoint)
+	}
+	i.ipcSocket = ipcSocket
+	i.sessionID = opts.sessionID
+	if opts.newSession {
+		socket, err := i.newSession(ctx)
+		if err != nil {
+			i.ipcSocket = ""
+			return err
+		}
+		i.ipcSocket = socket
+		i.sessionID = common.RootSessionID()
+	}
+	if err := i.connect(ctx); err != nil {
+		i.ipcSocket = ""
 		return err
 	}
-	var messageIn string
-	err := i.DoRead(&messageIn)
+	i.endpoint = ipcSocket
+	i.options = opts
+	i.connected = true
+	i.broken = false
+	i.redial = i.connect
+	return nil
+}
+
+// connect dials the ipc socket and registers to vineyard, and is redirected
+// to the socket of the session if it is served on another socket.
+func (i *IPCClient) connect(ctx context.Context) error {
+	registerReply, err := i.register(ctx, i.ipcSocket)
 	if err != nil {
 		return err
 	}
-	var registerReply common.RegisterReply
-	err = json.Unmarshal([]byte(messageIn), &registerReply)
-	if err != nil {
+	if i.sessionID != common.RootSessionID() && registerReply.IPCSocket != i.ipcSocket {
+		i.conn.Close()
+		if registerReply, err = i.register(ctx, registerReply.IPCSocket); err != nil {
+			return err
+		}
+		i.ipcSocket = registerReply.IPCSocket
+	}
+	if err := common.CheckServerVersion(registerReply.Version); err != nil {
+		i.conn.Close()
 		return err
 	}
-	i.instanceID = registerReply.InstanceID
+	i.sessionID = registerReply.SessionID
+	i.instanceID = common.InstanceID(registerReply.InstanceID)
 	if registerReply.Version == "" {
 		i.serverVersion = common.DEFAULT_SERVER_VERSION
 	} else {
 		i.serverVersion = registerReply.Version
 	}
-	i.connected = true
 	i.rpcEndpoint = registerReply.RPCEndpoint
-	i.mmapTable = make(map[int]MmapEntry)
-	// TODO: compatible server check
+	// the server sends the fds again on the new connection, and the blobs
+	// in use are released by vineyard when the connection is lost
+	i.resetUsages(false)
 	return nil
 }
 
-func (i *IPCClient) CreateBlob(size int, blob *ds.BlobWriter) {
-	if i.connected == false {
-		return
+// Disconnect closes the connection, then unmaps the shared memory and closes
+// the received fds. The blobs of the client are invalid after that, and the
+// data returned by them mustn't be used anymore.
+func (i *IPCClient) Disconnect(ctx context.Context) error {
+	if err := i.acquire(ctx); err != nil {
+		return err
 	}
+	defer i.release()
+	if !i.connected {
+		return nil
+	}
+	err := i.disconnect(ctx)
+	i.resetUsages(true)
+	return err
+}
+
+// register dials the ipc socket and registers to the session of the client.
+func (i *IPCClient) register(ctx context.Context, ipcSocket string) (*common.RegisterReply, error) {
+	conn := new(net.UnixConn)
+	if err := ConnectIPCSocketRetry(ctx, ipcSocket, &conn); err != nil {
+		return nil, err
+	}
+	i.setConn(conn)
+	i.watch(ctx)
+	defer i.unwatch()
+	var messageOut string
+	common.WriteRegisterRequest(i.sessionID, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return nil, err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return nil, err
+	}
+	var registerReply common.RegisterReply
+	if err := json.Unmarshal([]byte(messageIn), &registerReply); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if registerReply.Code != 0 || registerReply.Type != common.REGISTER_REPLY {
+		conn.Close()
+		return nil, common.NewReplyError(registerReply.Code, registerReply.Type, registerReply.Message)
+	}
+	return &registerReply, nil
+}
+
+// CreateBlob creates a blob of the given size in vineyard, the buffer of the
+// blob writer is the shared memory and can be filled in place.
+func (i *IPCClient) CreateBlob(ctx context.Context, size int, blob *ds.BlobWriter) error {
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
 	var buffer memory.Buffer
 	var id common.ObjectID = common.InvalidObjectID()
 	var payload ds.Payload
-	i.CreateBuffer(size, &id, &payload, &buffer)
-	blob.Reset(id, payload, buffer)
+	if err := i.createBuffer(size, &id, &payload, &buffer); err != nil {
+		return err
+	}
+	blob.Reset(i, id, payload, buffer)
+	return nil
 }
 
-func (i *IPCClient) CreateBuffer(size int, id *common.ObjectID, payload *ds.Payload, buffer *memory.Buffer) error {
-	if i.connected == false {
-		return errors.New("ipc client is not connected")
+func (i *IPCClient) CreateBuffer(ctx context.Context, size int, id *common.ObjectID, payload *ds.Payload, buffer *memory.Buffer) error {
+	if err := i.lock(ctx); err != nil {
+		return err
 	}
+	defer i.unlock()
+	return i.createBuffer(size, id, payload, buffer)
+}
+
+func (i *IPCClient) createBuffer(size int, id *common.ObjectID, payload *ds.Payload, buffer *memory.Buffer) error {
 	var messageOut string
 	common.WriteCreateBufferRequest(size, &messageOut)
 
@@ -134,14 +280,16 @@ func (i *IPCClient) CreateBuffer(size int, id *common.ObjectID, payload *ds.Payl
 	if err != nil {
 		return err
 	}
-	fmt.Println("receive from vineyard create buffer is :", messageIn)
+	common.GetLogger().Debugf("receive from vineyard create buffer is: %s", messageIn)
 	var createBufferReply common.CreateBufferReply
 	err = json.Unmarshal([]byte(messageIn), &createBufferReply)
 	if err != nil {
-		fmt.Println("create buffer reply json failed")
 		return err
 	}
-	*id = createBufferReply.ID // TODO: check whether two id is same
+	if createBufferReply.Code != 0 || createBufferReply.Type != common.CREAT_BUFFER_REPLY {
+		return common.NewReplyError(createBufferReply.Code, createBufferReply.Type, createBufferReply.Message)
+	}
+	*id = createBufferReply.ID
 	payload.ID = createBufferReply.ID
 	payload.StoreFd = createBufferReply.Created.StoreFd
 	payload.DataOffset = createBufferReply.Created.DataOffset
@@ -152,41 +300,273 @@ func (i *IPCClient) CreateBuffer(size int, id *common.ObjectID, payload *ds.Payl
 		return errors.New("data size not match")
 	}
 
-	var shared *uint8
+	var data []byte
 	if payload.DataSize > 0 {
-		i.MmapToClient(payload.StoreFd, int64(payload.MapSize), false, true, &shared)
-		//i.MmapToClient()
+		var shared *uint8
+		if err := i.MmapToClient(payload.StoreFd, int64(payload.MapSize), false, true, &shared); err != nil {
+			return i.markBroken(err)
+		}
+		data = bytesAt(shared, payload.DataOffset, payload.DataSize)
+		i.addUsage(payload.ID, payload.StoreFd, false)
+	}
+	*buffer = *memory.NewBufferBytes(data)
+	return nil
+}
+
+// Seal marks the blob as sealed, then it becomes immutable and visible to
+// other clients.
+func (i *IPCClient) Seal(ctx context.Context, id common.ObjectID) error {
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
+	var messageOut string
+	common.WriteSealRequest(id, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var sealReply common.SealReply
+	if err := json.Unmarshal([]byte(messageIn), &sealReply); err != nil {
+		return err
+	}
+	if sealReply.Code != 0 || sealReply.Type != common.SEAL_REPLY {
+		return common.NewReplyError(sealReply.Code, sealReply.Type, sealReply.Message)
+	}
+	return nil
+}
+
+// DropBuffer frees an unsealed blob on the vineyard server. The mapped store
+// fd is kept as other blobs may live in the same segment.
+func (i *IPCClient) DropBuffer(ctx context.Context, id common.ObjectID, fd int) error {
+	if !common.IsBlob(id) {
+		return fmt.Errorf("the object %s is not a blob", common.ObjectIDToString(id))
+	}
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
+	var messageOut string
+	common.WriteDropBufferRequest(id, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var dropBufferReply common.DropBufferReply
+	if err := json.Unmarshal([]byte(messageIn), &dropBufferReply); err != nil {
+		return err
+	}
+	if dropBufferReply.Code != 0 || dropBufferReply.Type != common.DROP_BUFFER_REPLY {
+		return common.NewReplyError(dropBufferReply.Code, dropBufferReply.Type, dropBufferReply.Message)
 	}
-	//fmt.Println(shared[0:1])
-	//buffer := memory.NewBufferBytes(shared[])
+	i.deleteUsage(id)
 	return nil
 }
 
+// GetMetaData fetches the metadata tree of the given object, as well as the
+// payloads of the blobs on this instance that the object refers to. The blobs
+// stay in use until the object is released by Release.
+func (i *IPCClient) GetMetaData(ctx context.Context, id common.ObjectID, meta *ds.ObjectMeta, syncRemote bool) error {
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
+	if err := i.getMetaData(id, meta, syncRemote); err != nil {
+		return err
+	}
+	blobs, err := i.getBlobs(meta.GetBufferSet().AllBufferIds())
+	if err != nil {
+		return err
+	}
+	for blobID, blob := range blobs {
+		if err := meta.SetBuffer(blobID, blob); err != nil {
+			return err
+		}
+	}
+	meta.SetClient(i)
+	return nil
+}
+
+// GetObject fetches the object from vineyard and builds the typed go value by
+// the resolver registered for its typename, see also ds.RegisterResolver.
+func (i *IPCClient) GetObject(ctx context.Context, id common.ObjectID, options ...GetObjectOption) (interface{}, error) {
+	var opts getObjectOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.fetchRemote {
+		var err error
+		if id, err = i.MigrateObject(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	var meta ds.ObjectMeta
+	if err := i.GetMetaData(ctx, id, &meta, false); err != nil {
+		return nil, err
+	}
+	return ds.ResolveObject(&meta)
+}
+
+// GetBlobs fetches the given blobs from vineyard. The data of the returned
+// blobs refers to the shared memory directly and must not be modified. The
+// blobs should be released by Blob.Release once they are no longer used, or
+// they are released when garbage collected.
+func (i *IPCClient) GetBlobs(ctx context.Context, ids []common.ObjectID) (map[common.ObjectID]*ds.Blob, error) {
+	blobs := make(map[common.ObjectID]*ds.Blob)
+	if len(ids) == 0 {
+		return blobs, nil
+	}
+	if err := i.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer i.unlock()
+	blobs, err := i.getBlobs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		if blob.Size() > 0 {
+			blob.Track(i.tracker)
+		}
+	}
+	return blobs, nil
+}
+
+func (i *IPCClient) getBlobs(ids []common.ObjectID) (map[common.ObjectID]*ds.Blob, error) {
+	blobs := make(map[common.ObjectID]*ds.Blob)
+	if len(ids) == 0 {
+		return blobs, nil
+	}
+	var messageOut string
+	common.WriteGetBuffersRequest(ids, false, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return nil, err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return nil, err
+	}
+	var getBuffersReply common.GetBuffersReply
+	if err := json.Unmarshal([]byte(messageIn), &getBuffersReply); err != nil {
+		return nil, err
+	}
+	if getBuffersReply.Code != 0 || getBuffersReply.Type != common.GET_BUFFERS_REPLY {
+		return nil, common.NewReplyError(getBuffersReply.Code, getBuffersReply.Type, getBuffersReply.Message)
+	}
+
+	// the server sends the fds that we haven't received yet, in order
+	fdsToRecv := make([]int, 0)
+	for _, payload := range getBuffersReply.Payloads {
+		if payload.DataSize <= 0 {
+			continue
+		}
+		if _, ok := i.mmapTable[payload.StoreFd]; ok {
+			continue
+		}
+		if !containsFd(fdsToRecv, payload.StoreFd) {
+			fdsToRecv = append(fdsToRecv, payload.StoreFd)
+		}
+	}
+	if getBuffersReply.Fds != nil && !equalFds(getBuffersReply.Fds, fdsToRecv) {
+		// the fds in flight can't be consumed reliably
+		return nil, i.markBroken(fmt.Errorf("the fd set is not matched between client and server: sent %v, expect %v",
+			getBuffersReply.Fds, fdsToRecv))
+	}
+
+	for _, payload := range getBuffersReply.Payloads {
+		var data []byte
+		if payload.DataSize > 0 {
+			var shared *uint8
+			if err := i.MmapToClient(payload.StoreFd, int64(payload.MapSize), true, true, &shared); err != nil {
+				return nil, i.markBroken(err)
+			}
+			data = bytesAt(shared, payload.DataOffset, payload.DataSize)
+			i.addUsage(payload.ID, payload.StoreFd, false)
+		}
+		blob := &ds.Blob{}
+		blob.Reset(payload.ID, payload.DataSize, data)
+		blobs[payload.ID] = blob
+	}
+	return blobs, nil
+}
+
+// bytesAt returns the bytes of the mapped region at the offset.
+func bytesAt(base *uint8, offset int, size int) []byte {
+	return unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(base), offset)), size)
+}
+
+func containsFd(fds []int, fd int) bool {
+	for _, item := range fds {
+		if item == fd {
+			return true
+		}
+	}
+	return false
+}
+
+func equalFds(lhs []int, rhs []int) bool {
+	if len(lhs) != len(rhs) {
+		return false
+	}
+	for index := range lhs {
+		if lhs[index] != rhs[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// MmapToClient maps the store fd into the client's address space, receiving
+// the fd from the vineyard server first if it hasn't been received. It must be
+// called in the round trip that the fd is sent along with.
 func (i *IPCClient) MmapToClient(fd int, mapSize int64, readOnly bool, realign bool, ptr **uint8) error {
-	_, ok := i.mmapTable[fd]
+	entry, ok := i.mmapTable[fd]
 	if !ok {
-		file, err := i.conn.File()
+		clientFd, err := i.recvFd()
 		if err != nil {
-			fmt.Println("Get connection file")
 			return err
 		}
-		clientFd := C.recv_fd(C.int(file.Fd()))
-		if clientFd <= 0 {
-			return errors.New("receive client fd error")
-		}
-		newEntry := MmapEntry{int(clientFd), mapSize, readOnly, realign, nil, nil}
+		entry = &MmapEntry{clientFd: clientFd, mapSize: mapSize, readOnly: readOnly, realign: realign}
+		i.mmapTable[fd] = entry
+	}
 
-		if readOnly {
-			newEntry.MapReadOnly()
-		} else {
-			newEntry.MapReadWrite()
+	if readOnly {
+		if err := entry.MapReadOnly(); err != nil {
+			return err
 		}
-		i.mmapTable[fd] = newEntry
+		*ptr = (*uint8)(entry.roPointer)
+	} else {
+		if err := entry.MapReadWrite(); err != nil {
+			return err
+		}
+		*ptr = (*uint8)(entry.rwPointer)
 	}
-
-	// TODO: set entry to read only
-	//if readOnly {
-	//} else {
-	//}
 	return nil
 }
+
+func (i *IPCClient) recvFd() (int, error) {
+	conn, ok := i.conn.(syscall.Conn)
+	if !ok {
+		return -1, errors.New("the connection can't pass fds")
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	var clientFd C.int
+	if err := rawConn.Control(func(fd uintptr) {
+		clientFd = C.recv_fd(C.int(fd))
+	}); err != nil {
+		return -1, err
+	}
+	if clientFd <= 0 {
+		return -1, errors.New("receive client fd error")
+	}
+	return int(clientFd), nil
+}
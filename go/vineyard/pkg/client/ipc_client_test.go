@@ -16,40 +16,54 @@ limitations under the License.
 package vineyard
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/apache/arrow/go/arrow"
 	"github.com/apache/arrow/go/arrow/array"
 	"github.com/apache/arrow/go/arrow/memory"
 	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
 	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
 )
 
 func TestIPCServer_Connect(t *testing.T) {
-	ipcAddr := "/var/run/vineyard.sock"
+	ctx := vineyardtest.Context(t)
+	ipcAddr := vineyardtest.Start(t, nil).IPCSocket()
 	ipcServer := IPCClient{}
-	err := ipcServer.Connect(ipcAddr)
+	err := ipcServer.Connect(ctx, ipcAddr)
 	if err != nil {
 		t.Error("connect to ipc server failed", err)
 	}
-	err = ipcServer.Disconnect()
+	err = ipcServer.Disconnect(ctx)
 	if err != nil {
 		t.Error("disconnect ipc server failed", err.Error())
 	}
 }
 
 func TestIPCClient_GetName(t *testing.T) {
-	ipcAddr := "/var/run/vineyard.sock"
+	ctx := vineyardtest.Context(t)
+	ipcAddr := vineyardtest.Start(t, nil).IPCSocket()
 	name := "test_name"
 	nameNoExist := "undefined_name"
 	ipcServer := IPCClient{}
-	err := ipcServer.Connect(ipcAddr)
+	err := ipcServer.Connect(ctx, ipcAddr)
 	if err != nil {
 		t.Error("connect to ipc server failed", err)
 	}
-	var id1 common.ObjectID = common.GenerateObjectID()
-	if err := ipcServer.PutName(id1, name); err != nil {
+	var meta vineyard.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Scalar<int64>")
+	meta.AddKeyValue("value_", 42)
+	id1, err := ipcServer.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+	if err := ipcServer.PutName(ctx, id1, name); err != nil {
 		if putErr, ok := err.(*common.ReplyError); ok {
 			t.Log("get name return code", putErr.Code)
 		} else {
@@ -57,7 +71,7 @@ func TestIPCClient_GetName(t *testing.T) {
 		}
 	}
 	var id2 common.ObjectID
-	if err := ipcServer.GetName(name, false, &id2); err != nil {
+	if err := ipcServer.GetName(ctx, name, false, &id2); err != nil {
 		if getErr, ok := err.(*common.ReplyError); ok {
 			if getErr.Code == common.KObjectNotExists {
 				t.Log("get object not exist")
@@ -72,7 +86,7 @@ func TestIPCClient_GetName(t *testing.T) {
 	t.Log("put name and get name success!")
 
 	var id3 common.ObjectID
-	if err := ipcServer.GetName(nameNoExist, false, &id3); err != nil {
+	if err := ipcServer.GetName(ctx, nameNoExist, false, &id3); err != nil {
 		if getErr, ok := err.(*common.ReplyError); ok {
 			if getErr.Code == common.KObjectNotExists {
 				t.Log("get object not exist")
@@ -83,7 +97,7 @@ func TestIPCClient_GetName(t *testing.T) {
 	}
 	t.Log("get no exist name test success")
 
-	if err := ipcServer.DropName(name); err != nil {
+	if err := ipcServer.DropName(ctx, name); err != nil {
 		if dropErr, ok := err.(*common.ReplyError); ok {
 			if dropErr.Code == common.KObjectNotExists {
 				t.Log("drop object not exist")
@@ -94,7 +108,7 @@ func TestIPCClient_GetName(t *testing.T) {
 	}
 	t.Log("drop name success")
 
-	if err := ipcServer.GetName(name, false, &id1); err != nil {
+	if err := ipcServer.GetName(ctx, name, false, &id1); err != nil {
 		if getErr, ok := err.(*common.ReplyError); ok {
 			if getErr.Code == common.KObjectNotExists {
 				t.Log("get object not exist")
@@ -104,15 +118,328 @@ func TestIPCClient_GetName(t *testing.T) {
 		}
 	}
 
-	err = ipcServer.Disconnect()
+	err = ipcServer.Disconnect(ctx)
 	if err != nil {
 		t.Error("disconnect ipc server failed", err.Error())
 	}
 }
 
-// need root privilege to run
-// TODO: unfinished
+func TestIPCClient_CreateBlob(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	ipcClient := newIPCClient(t, vineyardtest.Start(t, nil))
+
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 16, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	for index := range writer.Buf() {
+		writer.Buf()[index] = byte(index)
+	}
+	blob, err := writer.Seal(ctx)
+	if err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	if err := writer.Abort(ctx); err == nil {
+		t.Error("abort a sealed blob should fail")
+	}
+
+	blobs, err := ipcClient.GetBlobs(ctx, []common.ObjectID{blob.ID()})
+	if err != nil {
+		t.Fatal("get blobs failed", err)
+	}
+	data, err := blobs[blob.ID()].Data()
+	if err != nil {
+		t.Fatal("get blob data failed", err)
+	}
+	if len(data) != 16 || data[15] != 15 {
+		t.Error("the blob content is not match", data)
+	}
+
+	var aborted vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 16, &aborted); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	if err := aborted.Abort(ctx); err != nil {
+		t.Error("abort blob failed", err)
+	}
+}
+
+// TestIPCClient_ConcurrentDisconnect runs round trips while the client is
+// disconnected, which fail once the client is no longer connected.
+func TestIPCClient_ConcurrentDisconnect(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	ipcClient := newIPCClient(t, vineyardtest.Start(t, nil))
+
+	roundTrips := func() error {
+		var writer vineyard.BlobWriter
+		if err := ipcClient.CreateBlob(ctx, 16, &writer); err != nil {
+			return err
+		}
+		blob, err := writer.Seal(ctx)
+		if err != nil {
+			return err
+		}
+		blobs, err := ipcClient.GetBlobs(ctx, []common.ObjectID{blob.ID()})
+		if err != nil {
+			return err
+		}
+		if err := blobs[blob.ID()].Release(ctx); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if err := roundTrips(); err != nil {
+					if !errors.Is(err, errNotConnected) {
+						errs <- err
+					}
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := ipcClient.Disconnect(ctx); err != nil {
+		t.Error("disconnect failed", err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestIPCClient_Release(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	ipcClient := newIPCClient(t, server)
+
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 16, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	sealed, err := writer.Seal(ctx)
+	if err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	if server.RefCount(sealed.ID()) != 1 {
+		t.Error("the created blob should be referred", server.RefCount(sealed.ID()))
+	}
+
+	// the blob is in use by both the writer and the fetched blob
+	blobs, err := ipcClient.GetBlobs(ctx, []common.ObjectID{sealed.ID()})
+	if err != nil {
+		t.Fatal("get blobs failed", err)
+	}
+	blob := blobs[sealed.ID()]
+	if err := blob.Release(ctx); err != nil {
+		t.Error("release blob failed", err)
+	}
+	if _, err := blob.Data(); err == nil {
+		t.Error("the data of a released blob should be unavailable")
+	}
+	if err := blob.Release(ctx); err != nil {
+		t.Error("release blob twice should be a no-op", err)
+	}
+	if server.RefCount(sealed.ID()) != 1 {
+		t.Error("the blob is released before all references are released", server.RefCount(sealed.ID()))
+	}
+	if err := ipcClient.Release(ctx, sealed.ID()); err != nil {
+		t.Error("release blob failed", err)
+	}
+	if server.RefCount(sealed.ID()) != 0 {
+		t.Error("the blob should be released in vineyard", server.RefCount(sealed.ID()))
+	}
+	if err := ipcClient.Release(ctx, sealed.ID()); !errors.Is(err, common.ErrObjectNotExists) {
+		t.Error("release a blob that is not in use should fail", err)
+	}
+
+	// releasing an object releases the blobs it refers to
+	var member vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 8, &member); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	if _, err := member.Seal(ctx); err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	if err := ipcClient.Release(ctx, member.ID); err != nil {
+		t.Fatal("release blob failed", err)
+	}
+	var meta vineyard.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Scalar<int64>")
+	if err := meta.AddMemberID("buffer_", member.ID); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	id, err := ipcClient.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+	var result vineyard.ObjectMeta
+	if err := ipcClient.GetMetaData(ctx, id, &result, false); err != nil {
+		t.Fatal("get metadata failed", err)
+	}
+	if server.RefCount(member.ID) != 1 {
+		t.Error("the member should be referred", server.RefCount(member.ID))
+	}
+	if err := ipcClient.Release(ctx, id); err != nil {
+		t.Error("release object failed", err)
+	}
+	if server.RefCount(member.ID) != 0 {
+		t.Error("the member should be released in vineyard", server.RefCount(member.ID))
+	}
+}
+
+func TestIPCClient_ReleaseOnGC(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	ipcClient := newIPCClient(t, server)
+
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 16, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	copy(writer.Bytes(), "released on gc")
+	if _, err := writer.Seal(ctx); err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	if err := ipcClient.Release(ctx, writer.ID); err != nil {
+		t.Fatal("release blob failed", err)
+	}
+	blobs, err := ipcClient.GetBlobs(ctx, []common.ObjectID{writer.ID})
+	if err != nil {
+		t.Fatal("get blobs failed", err)
+	}
+	data, err := blobs[writer.ID].Data()
+	if err != nil {
+		t.Fatal("get data of blob failed", err)
+	}
+	blobs = nil
+
+	// the blob is released in vineyard, while the data stays mapped
+	for server.RefCount(writer.ID) != 0 {
+		if ctx.Err() != nil {
+			t.Fatal("the blob should be released on garbage collection")
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if string(data[:14]) != "released on gc" {
+		t.Error("the data of the collected blob should stay valid", data)
+	}
+}
+
+func TestIPCClient_Reconnect(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	ipcClient := newIPCClient(t, server)
+
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 16, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	copy(writer.Bytes(), "reconnected")
+	if _, err := writer.Seal(ctx); err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	blobs, err := ipcClient.GetBlobs(ctx, []common.ObjectID{writer.ID})
+	if err != nil {
+		t.Fatal("get blobs failed", err)
+	}
+	blob := blobs[writer.ID]
+	data, err := blob.Data()
+	if err != nil {
+		t.Fatal("get data of blob failed", err)
+	}
+
+	// the next request goes through a new connection
+	ipcClient.markBroken(errors.New("the connection is lost"))
+	if _, err := ipcClient.Exists(ctx, writer.ID); err != nil {
+		t.Fatal("reconnect failed", err)
+	}
+	if _, err := blob.Data(); err == nil {
+		t.Error("the blob of the previous connection should be invalid")
+	}
+	if err := blob.Release(ctx); err != nil {
+		t.Error("releasing an invalid blob should be a no-op", err)
+	}
+	// the memory that is still referred to stays mapped until disconnect
+	if len(ipcClient.mmapTable) != 0 || len(ipcClient.staleMmaps) == 0 {
+		t.Error("unexpected shared memory after reconnecting", len(ipcClient.mmapTable), len(ipcClient.staleMmaps))
+	}
+	if string(data[:11]) != "reconnected" {
+		t.Error("the data of the previous connection should stay mapped", data)
+	}
+
+	blobs, err = ipcClient.GetBlobs(ctx, []common.ObjectID{writer.ID})
+	if err != nil {
+		t.Fatal("get blobs after reconnecting failed", err)
+	}
+	if data, err := blobs[writer.ID].Data(); err != nil || string(data[:11]) != "reconnected" {
+		t.Error("unexpected data after reconnecting", err)
+	}
+}
+
+func TestIPCClient_CreateMetaData(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	ipcClient := newIPCClient(t, vineyardtest.Start(t, nil))
+
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, 8, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	blob, err := writer.Seal(ctx)
+	if err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+
+	var meta vineyard.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Scalar<int64>")
+	meta.AddKeyValue("value_", 42)
+	if err := meta.AddMemberID("buffer_", blob.ID()); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	id, err := ipcClient.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+	if metaID, _ := meta.GetId(); metaID != id {
+		t.Error("the id of metadata is not updated")
+	}
+	if _, err := meta.GetSignature(); err != nil {
+		t.Error("the signature of metadata is not updated", err)
+	}
+	if err := ipcClient.Persist(ctx, id); err != nil {
+		t.Error("persist failed", err)
+	}
+	if err := ipcClient.PutName(ctx, id, "test_create_metadata"); err != nil {
+		t.Error("put name failed", err)
+	}
+
+	var result vineyard.ObjectMeta
+	if err := ipcClient.GetMetaData(ctx, id, &result, false); err != nil {
+		t.Fatal("get metadata failed", err)
+	}
+	if result.Typename() != "vineyard::Scalar<int64>" {
+		t.Error("the typename is not match", result.Typename())
+	}
+	buffer, err := result.GetMember("buffer_")
+	if err != nil || buffer.Typename() != "vineyard::Blob" {
+		t.Error("the member is not resolved", err)
+	}
+	_ = ipcClient.DropName(ctx, "test_create_metadata")
+}
+
 func TestIPCClient_ArrowDataStructure(t *testing.T) {
+	ctx := vineyardtest.Context(t)
 	pool := memory.NewGoAllocator()
 
 	lb := array.NewFixedSizeListBuilder(pool, 3, arrow.PrimitiveTypes.Int64)
@@ -141,7 +468,9 @@ func TestIPCClient_ArrowDataStructure(t *testing.T) {
 	vb.Append(7)
 	vb.Append(8)
 
+	// the values of null lists are not appended by the builder
 	lb.AppendNull()
+	vb.AppendValues([]int64{-1, -1, -1}, nil)
 
 	arr := lb.NewArray().(*array.FixedSizeList)
 	defer arr.Release()
@@ -151,19 +480,37 @@ func TestIPCClient_ArrowDataStructure(t *testing.T) {
 	fmt.Printf("Type()    = %v\n", arr.DataType())
 	fmt.Printf("List      = %v\n", arr)
 
-	ipcAddr := "/var/run/vineyard.sock"
-	ipcClient := IPCClient{}
-	err := ipcClient.Connect(ipcAddr)
-	if err != nil {
-		t.Error("connect to ipc server failed", err)
+	ipcClient := newIPCClient(t, vineyardtest.Start(t, nil))
+
+	var builder vineyard.ArrayBuilder
+	builder.Init(ipcClient, arr)
+	if err := builder.Seal(ctx); err != nil {
+		t.Fatal("seal array failed", err)
+	}
+	if err := ipcClient.Persist(ctx, builder.Id()); err != nil {
+		t.Error("persist array failed", err)
 	}
 
-	var array vineyard.ArrayBuilder
-	array.Init(&ipcClient, arr)
-	array.Seal()
-	// TODO: how to get array's id
+	var meta vineyard.ObjectMeta
+	if err := ipcClient.GetMetaData(ctx, builder.Id(), &meta, false); err != nil {
+		t.Fatal("get metadata failed", err)
+	}
+	result, err := vineyard.ReadArray(&meta)
+	if err != nil {
+		t.Fatal("read array failed", err)
+	}
+	defer result.Release()
+	if result.Len() != arr.Len() || result.NullN() != 0 {
+		t.Error("the array is not match", result)
+	}
 
-	ipcClient.Persist(array.Id())
+	object, err := ipcClient.GetObject(ctx, builder.Id())
+	if err != nil {
+		t.Fatal("get object failed", err)
+	}
+	if _, ok := object.(*array.FixedSizeList); !ok {
+		t.Errorf("unexpected object: %T", object)
+	}
 }
 
 func TestJSON(t *testing.T) {
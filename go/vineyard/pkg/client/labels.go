@@ -0,0 +1,260 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// Label attaches the labels to the object, the existing labels of the same
+// keys are overwritten.
+func (c *ClientBase) Label(ctx context.Context, id common.ObjectID, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteLabelRequest(id, labels, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var labelReply common.LabelReply
+	if err := json.Unmarshal([]byte(messageIn), &labelReply); err != nil {
+		return err
+	}
+	if labelReply.Code != 0 || labelReply.Type != common.LABEL_REPLY {
+		return common.NewReplyError(labelReply.Code, labelReply.Type, labelReply.Message)
+	}
+	return nil
+}
+
+// ListByLabels lists the metadata of the objects whose typenames match the
+// pattern and whose labels match the selector. The pattern is the one of
+// ListData, e.g., "vineyard::Tensor<*>", and the selector follows the syntax
+// of the label selectors of kubernetes, e.g.,
+// "k8s.v6d.io/job=producer,env in (dev, test)". At most limit objects are
+// returned, and a non-positive limit means no limit.
+//
+// vineyard lists objects by typename only, thus the labels are matched in
+// the client on the metadata of all the objects of the typenames, and the
+// cost grows with the number of such objects in the instance. Narrow the
+// pattern down to the typenames of interest rather than "*".
+func (c *ClientBase) ListByLabels(ctx context.Context, pattern string, regex bool, selector string, limit int) ([]*ds.ObjectMeta, error) {
+	labelSelector, err := ParseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	metas, err := c.ListData(ctx, pattern, regex, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*ds.ObjectMeta, 0)
+	for _, meta := range metas {
+		if limit > 0 && len(matched) >= limit {
+			break
+		}
+		if labelSelector.Matches(meta.Labels()) {
+			matched = append(matched, meta)
+		}
+	}
+	return matched, nil
+}
+
+// LabelOperator is the operator of a requirement in label selectors.
+type LabelOperator string
+
+const (
+	LabelEquals       LabelOperator = "="
+	LabelNotEquals    LabelOperator = "!="
+	LabelIn           LabelOperator = "in"
+	LabelNotIn        LabelOperator = "notin"
+	LabelExists       LabelOperator = "exists"
+	LabelDoesNotExist LabelOperator = "!"
+)
+
+// LabelRequirement is a requirement on the label of the key, the values are
+// the candidates of the in and notin operators.
+type LabelRequirement struct {
+	Key      string
+	Operator LabelOperator
+	Values   []string
+}
+
+// Matches tells whether the labels satisfy the requirement. As kubernetes
+// does, the labels without the key satisfy the != and notin requirements.
+func (r *LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case LabelExists:
+		return ok
+	case LabelDoesNotExist:
+		return !ok
+	case LabelEquals, LabelIn:
+		return ok && r.hasValue(value)
+	case LabelNotEquals, LabelNotIn:
+		return !ok || !r.hasValue(value)
+	default:
+		return false
+	}
+}
+
+func (r *LabelRequirement) hasValue(value string) bool {
+	for _, candidate := range r.Values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelSelector selects the labels that satisfy all the requirements, the
+// empty selector selects everything.
+type LabelSelector struct {
+	Requirements []LabelRequirement
+}
+
+// Matches tells whether the labels satisfy all the requirements.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	for index := range s.Requirements {
+		if !s.Requirements[index].Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector parses the selector in the syntax of the label selectors
+// of kubernetes, i.e., the requirements separated by commas, each of which is
+// one of "key", "!key", "key=value", "key==value", "key!=value",
+// "key in (v1, v2)" and "key notin (v1, v2)".
+func ParseLabelSelector(selector string) (*LabelSelector, error) {
+	requirements, err := splitRequirements(selector)
+	if err != nil {
+		return nil, err
+	}
+	result := &LabelSelector{Requirements: make([]LabelRequirement, 0, len(requirements))}
+	for _, requirement := range requirements {
+		parsed, err := parseLabelRequirement(requirement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+		}
+		result.Requirements = append(result.Requirements, parsed)
+	}
+	return result, nil
+}
+
+// splitRequirements splits the selector by the commas out of parentheses.
+func splitRequirements(selector string) ([]string, error) {
+	requirements := make([]string, 0)
+	if strings.TrimSpace(selector) == "" {
+		return requirements, nil
+	}
+	depth, start := 0, 0
+	for index, char := range selector {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				requirements = append(requirements, selector[start:index])
+				start = index + 1
+			}
+		}
+		if depth < 0 || depth > 1 {
+			return nil, fmt.Errorf("invalid label selector %q: unbalanced parentheses", selector)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid label selector %q: unbalanced parentheses", selector)
+	}
+	return append(requirements, selector[start:]), nil
+}
+
+func parseLabelRequirement(requirement string) (LabelRequirement, error) {
+	requirement = strings.TrimSpace(requirement)
+	if requirement == "" {
+		return LabelRequirement{}, errors.New("empty requirement")
+	}
+	if strings.HasPrefix(requirement, "!") {
+		key := strings.TrimSpace(requirement[1:])
+		return LabelRequirement{Key: key, Operator: LabelDoesNotExist}, validateLabelToken("key", key)
+	}
+	if open := strings.IndexByte(requirement, '('); open >= 0 {
+		if !strings.HasSuffix(requirement, ")") {
+			return LabelRequirement{}, fmt.Errorf("unexpected content after the values in %q", requirement)
+		}
+		fields := strings.Fields(requirement[:open])
+		if len(fields) != 2 {
+			return LabelRequirement{}, fmt.Errorf("expect 'key in (values)' or 'key notin (values)', got %q", requirement)
+		}
+		operator := LabelOperator(fields[1])
+		if operator != LabelIn && operator != LabelNotIn {
+			return LabelRequirement{}, fmt.Errorf("unknown operator %q", fields[1])
+		}
+		values := strings.Split(requirement[open+1:len(requirement)-1], ",")
+		for index := range values {
+			values[index] = strings.TrimSpace(values[index])
+			if err := validateLabelToken("value", values[index]); err != nil {
+				return LabelRequirement{}, err
+			}
+		}
+		return LabelRequirement{Key: fields[0], Operator: operator, Values: values}, validateLabelToken("key", fields[0])
+	}
+	for _, operator := range []string{"!=", "==", "="} {
+		if index := strings.Index(requirement, operator); index >= 0 {
+			key := strings.TrimSpace(requirement[:index])
+			value := strings.TrimSpace(requirement[index+len(operator):])
+			if err := validateLabelToken("value", value); err != nil {
+				return LabelRequirement{}, err
+			}
+			parsed := LabelRequirement{Key: key, Operator: LabelEquals, Values: []string{value}}
+			if operator == "!=" {
+				parsed.Operator = LabelNotEquals
+			}
+			return parsed, validateLabelToken("key", key)
+		}
+	}
+	return LabelRequirement{Key: requirement, Operator: LabelExists}, validateLabelToken("key", requirement)
+}
+
+// validateLabelToken rejects the keys and values that can't be expressed in
+// selectors, the values may be empty.
+func validateLabelToken(kind, token string) error {
+	if token == "" && kind == "key" {
+		return errors.New("empty key")
+	}
+	if strings.ContainsAny(token, " \t\n,()=!") {
+		return fmt.Errorf("invalid %s %q", kind, token)
+	}
+	return nil
+}
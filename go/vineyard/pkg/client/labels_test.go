@@ -0,0 +1,130 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"testing"
+
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	labels := map[string]string{"k8s.v6d.io/job": "producer", "env": "dev", "empty": ""}
+	cases := map[string]bool{
+		"":                                      true,
+		"k8s.v6d.io/job=producer":               true,
+		"k8s.v6d.io/job == producer":            true,
+		"k8s.v6d.io/job=consumer":               false,
+		"env!=prod":                             true,
+		"env!=dev":                              false,
+		"missing!=dev":                          true,
+		"env in (dev, test)":                    true,
+		"env notin (dev,test)":                  false,
+		"missing notin (dev)":                   true,
+		"env":                                   true,
+		"!env":                                  false,
+		"!missing":                              true,
+		"empty=":                                true,
+		"k8s.v6d.io/job=producer,env=prod":      false,
+		"k8s.v6d.io/job=producer, env in (dev)": true,
+	}
+	for selector, expected := range cases {
+		parsed, err := ParseLabelSelector(selector)
+		if err != nil {
+			t.Errorf("parse %q failed: %v", selector, err)
+			continue
+		}
+		if parsed.Matches(labels) != expected {
+			t.Errorf("unexpected result of %q, expect %v", selector, expected)
+		}
+	}
+	for _, selector := range []string{",", "=dev", "env in dev", "env in (dev", "env has (dev)", "env=(dev)", "a b=c", "env in (dev)x"} {
+		if _, err := ParseLabelSelector(selector); err == nil {
+			t.Errorf("expect the selector %q to be invalid", selector)
+		}
+	}
+}
+
+func TestClientBase_Label(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client, err := Connect(ctx, server.IPCSocket())
+	if err != nil {
+		t.Fatal("connect to vineyard failed", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	create := func(value int, labels map[string]string) common.ObjectID {
+		var meta vineyard.ObjectMeta
+		meta.Init()
+		meta.SetTypename("vineyard::Scalar<int64>")
+		meta.AddKeyValue("value_", value)
+		for key, label := range labels {
+			meta.SetLabel(key, label)
+		}
+		id, err := client.CreateMetaData(ctx, &meta)
+		if err != nil {
+			t.Fatal("create metadata failed", err)
+		}
+		return id
+	}
+	producer := create(1, map[string]string{"k8s.v6d.io/job": "producer"})
+	other := create(2, nil)
+	if err := client.Label(ctx, other, map[string]string{"k8s.v6d.io/job": "consumer", "env": "dev"}); err != nil {
+		t.Fatal("label the object failed", err)
+	}
+	if err := client.Label(ctx, producer, map[string]string{"env": "dev"}); err != nil {
+		t.Fatal("label the object failed", err)
+	}
+	var missing common.ObjectID = 42
+	if err := client.Label(ctx, missing, map[string]string{"env": "dev"}); err == nil {
+		t.Error("labeling an object that doesn't exist should fail")
+	}
+
+	var meta vineyard.ObjectMeta
+	if err := client.GetMetaData(ctx, producer, &meta, false); err != nil {
+		t.Fatal("get metadata failed", err)
+	}
+	if meta.Label("k8s.v6d.io/job") != "producer" || meta.Label("env") != "dev" {
+		t.Error("unexpected labels", meta.Labels())
+	}
+
+	metas, err := client.ListByLabels(ctx, "*", false, "k8s.v6d.io/job=producer", 0)
+	if err != nil {
+		t.Fatal("list by labels failed", err)
+	}
+	if len(metas) != 1 {
+		t.Fatal("unexpected objects", len(metas))
+	}
+	if id, _ := metas[0].GetId(); id != producer {
+		t.Error("unexpected object", common.ObjectIDToString(id))
+	}
+	if metas, err = client.ListByLabels(ctx, "vineyard::Scalar<*>", false, "env=dev", 0); err != nil || len(metas) != 2 {
+		t.Error("unexpected objects", len(metas), err)
+	}
+	if metas, err = client.ListByLabels(ctx, "*", false, "env=dev", 1); err != nil || len(metas) != 1 {
+		t.Error("the limit is not applied", len(metas), err)
+	}
+	if metas, err = client.ListByLabels(ctx, "vineyard::Tensor<*>", false, "env=dev", 0); err != nil || len(metas) != 0 {
+		t.Error("the pattern is not applied", len(metas), err)
+	}
+	if _, err = client.ListByLabels(ctx, "*", false, "env in (dev", 0); err == nil {
+		t.Error("expect the selector to be invalid")
+	}
+}
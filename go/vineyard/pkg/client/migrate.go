@@ -0,0 +1,192 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// GetObjectOption configures how GetObject fetches the object.
+type GetObjectOption func(*getObjectOptions)
+
+type getObjectOptions struct {
+	fetchRemote bool
+}
+
+// WithFetchRemote migrates the object to the instance that the client is
+// connected to if it lives on another instance, see also MigrateObject.
+func WithFetchRemote() GetObjectOption {
+	return func(options *getObjectOptions) {
+		options.fetchRemote = true
+	}
+}
+
+// MigrateObject copies the object to the instance that the client is
+// connected to, and returns the id of the copy. The object itself is returned
+// if it is local already.
+func (i *IPCClient) MigrateObject(ctx context.Context, id common.ObjectID) (common.ObjectID, error) {
+	return migrateObject(ctx, &i.ClientBase, i, id)
+}
+
+// MigrateObject copies the object to the instance that the client is
+// connected to, and returns the id of the copy. The object itself is returned
+// if it is local already.
+func (r *RPCClient) MigrateObject(ctx context.Context, id common.ObjectID) (common.ObjectID, error) {
+	return migrateObject(ctx, &r.ClientBase, r, id)
+}
+
+// migrateObject fetches the object from the instance it lives on over rpc,
+// and creates the blobs and the metadata on the instance of the client.
+func migrateObject(ctx context.Context, base *ClientBase, client ds.IIPCClient, id common.ObjectID) (common.ObjectID, error) {
+	var meta ds.ObjectMeta
+	if err := base.GetMetaData(ctx, id, &meta, true); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if meta.IsLocal() {
+		return id, nil
+	}
+	if meta.IsGlobal() {
+		return common.InvalidObjectID(), fmt.Errorf("migrating the global object %s is not supported", common.ObjectIDToString(id))
+	}
+	owner, err := meta.GetInstanceId()
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	instances, err := base.ClusterInfo(ctx)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	instance, ok := instances[owner]
+	if !ok {
+		return common.InvalidObjectID(), fmt.Errorf("the instance %d of the object %s is not found in the cluster",
+			owner, common.ObjectIDToString(id))
+	}
+
+	var peer RPCClient
+	if err := peer.Connect(ctx, instance.RPCEndpoint); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	defer peer.Disconnect(context.Background())
+	var remote ds.ObjectMeta
+	if err := peer.GetMetaData(ctx, id, &remote, false); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	m := migration{client: client, owner: owner, migrated: make(map[common.ObjectID]common.ObjectID)}
+	return m.migrate(ctx, &remote)
+}
+
+// migration copies the members of an object, the members that are local
+// already are referred as is.
+type migration struct {
+	client   ds.IIPCClient
+	owner    common.InstanceID
+	migrated map[common.ObjectID]common.ObjectID
+}
+
+// kMigrationSkippedKeys are the keys that are assigned by vineyard when the
+// copy is created.
+var kMigrationSkippedKeys = map[string]bool{
+	"id":          true,
+	"signature":   true,
+	"instance_id": true,
+	"transient":   true,
+}
+
+func (m *migration) migrate(ctx context.Context, meta *ds.ObjectMeta) (common.ObjectID, error) {
+	id, err := meta.GetId()
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if migrated, ok := m.migrated[id]; ok {
+		return migrated, nil
+	}
+	instanceID, err := meta.GetInstanceId()
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if instanceID == m.client.InstanceID() || id == common.EmptyBlobID() {
+		return id, nil
+	}
+	if instanceID != m.owner {
+		return common.InvalidObjectID(), fmt.Errorf("the member %s lives on instance %d rather than instance %d",
+			common.ObjectIDToString(id), instanceID, m.owner)
+	}
+
+	var result common.ObjectID
+	if common.IsBlob(id) {
+		if result, err = m.migrateBlob(ctx, meta, id); err != nil {
+			return common.InvalidObjectID(), err
+		}
+	} else {
+		var target ds.ObjectMeta
+		target.Init()
+		for key, value := range meta.MetaData() {
+			if !kMigrationSkippedKeys[key] && !meta.HasMember(key) {
+				target.AddKeyValue(key, value)
+			}
+		}
+		for _, name := range meta.ListMembers() {
+			member, err := meta.GetMember(name)
+			if err != nil {
+				return common.InvalidObjectID(), err
+			}
+			memberID, err := m.migrate(ctx, member)
+			if err != nil {
+				return common.InvalidObjectID(), err
+			}
+			if err := target.AddMemberID(name, memberID); err != nil {
+				return common.InvalidObjectID(), err
+			}
+		}
+		if result, err = m.client.CreateMetaData(ctx, &target); err != nil {
+			return common.InvalidObjectID(), err
+		}
+	}
+	m.migrated[id] = result
+	return result, nil
+}
+
+// migrateBlob copies the content of the blob to a new blob, which is not in
+// use by the client once created.
+func (m *migration) migrateBlob(ctx context.Context, meta *ds.ObjectMeta, id common.ObjectID) (common.ObjectID, error) {
+	blob, err := meta.GetBuffer(id)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	data, err := blob.Data()
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var writer ds.BlobWriter
+	if err := m.client.CreateBlob(ctx, len(data), &writer); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	copy(writer.Bytes(), data)
+	sealed, err := writer.Seal(ctx)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if sealed.Size() > 0 {
+		if err := m.client.Release(ctx, sealed.ID()); err != nil {
+			return common.InvalidObjectID(), err
+		}
+	}
+	return sealed.ID(), nil
+}
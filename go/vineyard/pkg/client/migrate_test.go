@@ -0,0 +1,100 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+func TestClient_MigrateObject(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	servers := vineyardtest.StartCluster(t, 2, nil)
+	owner := newIPCClient(t, servers[0])
+	var writer vineyard.BlobWriter
+	if err := owner.CreateBlob(ctx, 6*8, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	copy(writer.Bytes(), arrow.Float64Traits.CastToBytes([]float64{1, 2, 3, 4, 5, 6}))
+	if _, err := writer.Seal(ctx); err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	var meta vineyard.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Tensor<double>")
+	meta.AddKeyValue("value_type_", "float64")
+	meta.AddKeyValue("shape_", "[2, 3]")
+	meta.AddKeyValue("partition_index_", "[]")
+	meta.SetNBytes(6 * 8)
+	if err := meta.AddMemberID("buffer_", writer.ID); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	id, err := owner.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+	if local, err := owner.MigrateObject(ctx, id); err != nil || local != id {
+		t.Error("migrating a local object should be a no-op", local, err)
+	}
+
+	for _, endpoint := range []string{servers[1].IPCSocket(), servers[1].RPCEndpoint()} {
+		client, err := Connect(ctx, endpoint)
+		if err != nil {
+			t.Fatal("connect to vineyard failed", err)
+		}
+		defer client.Disconnect(context.Background())
+		if _, err := client.GetObject(ctx, id); err == nil {
+			t.Error("the payload of a remote object should be unavailable")
+		}
+
+		migrated, err := client.MigrateObject(ctx, id)
+		if err != nil {
+			t.Fatal("migrate object failed", err)
+		}
+		if migrated == id {
+			t.Fatal("the object should be copied")
+		}
+		var result vineyard.ObjectMeta
+		if err := client.GetMetaData(ctx, migrated, &result, false); err != nil {
+			t.Fatal("get metadata failed", err)
+		}
+		if !result.IsLocal() || result.Typename() != "vineyard::Tensor<double>" {
+			t.Error("unexpected migrated object", result.MetaData())
+		}
+
+		object, err := client.GetObject(ctx, id, WithFetchRemote())
+		if err != nil {
+			t.Fatal("get object with fetching remote failed", err)
+		}
+		tensor, ok := object.(*vineyard.Tensor)
+		if !ok {
+			t.Fatalf("unexpected object: %T", object)
+		}
+		if values := arrow.Float64Traits.CastFromBytes(tensor.Data()); len(values) != 6 || values[5] != 6 {
+			t.Error("the content of the tensor is not migrated", values)
+		}
+	}
+
+	var missing common.ObjectID = 42
+	if _, err := owner.MigrateObject(ctx, missing); err == nil {
+		t.Error("migrating an object that doesn't exist should fail")
+	}
+}
@@ -16,49 +16,82 @@ limitations under the License.
 package vineyard
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
 
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
 	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
 )
 
+// RPCClient connects to vineyard over tcp. The instance id of the client is
+// the one of the remote instance it connects to, where the blobs are created.
 type RPCClient struct {
 	ClientBase
-	connected        bool
-	ipcSocket        string
-	conn             *net.UnixConn
-	instanceID       int
-	remoteInstanceID int
-	rpcEndpoint      string
+	ipcSocket   string
+	rpcEndpoint string
+	compress    bool
 }
 
-func (r *RPCClient) Connect(rpcEndpoint string) error {
-	if r.connected || r.rpcEndpoint == rpcEndpoint {
-		return nil
+// SetCompression enables the zstd compression of the blob payloads that are
+// transferred over the connection, which is disabled by default.
+func (r *RPCClient) SetCompression(compress bool) {
+	r.compress = compress
+}
+
+// Connect registers to the vineyard server at the rpc endpoint, i.e.,
+// "host:port". The client is safe for concurrent use, and the connection is
+// re-established when it has been broken.
+func (r *RPCClient) Connect(ctx context.Context, rpcEndpoint string) error {
+	if err := r.acquire(ctx); err != nil {
+		return err
+	}
+	defer r.release()
+	if r.connected {
+		if r.rpcEndpoint == rpcEndpoint {
+			return nil
+		}
+		return fmt.Errorf("the client has been connected to %s", r.rpcEndpoint)
 	}
 	r.rpcEndpoint = rpcEndpoint
+	if err := r.connect(ctx); err != nil {
+		r.rpcEndpoint = ""
+		return err
+	}
+	r.connected = true
+	r.broken = false
+	r.redial = r.connect
+	return nil
+}
 
-	str := strings.Split(rpcEndpoint, ":")
+// connect dials the rpc endpoint and registers to vineyard.
+func (r *RPCClient) connect(ctx context.Context) error {
+	str := strings.Split(r.rpcEndpoint, ":")
 	host := str[0]
-	port := str[1]
-	if port == "" {
-		port = "9600"
+	port := "9600"
+	if len(str) > 1 && str[1] != "" {
+		port = str[1]
 	}
 	var conn net.Conn
 	portNum, err := strconv.Atoi(port)
 	if err != nil {
 		return err
 	}
-	err = ConnectRPCSocketRetry(host, uint16(portNum), &conn)
+	err = ConnectRPCSocketRetry(ctx, host, uint16(portNum), &conn)
 	if err != nil {
 		return err
 	}
 
-	r.ClientBase.conn = conn
+	r.setConn(conn)
+	r.watch(ctx)
+	defer r.unwatch()
 	var messageOut string
-	common.WriteRegisterRequest(&messageOut)
+	common.WriteRegisterRequest(common.RootSessionID(), &messageOut)
 	if err := r.DoWrite(messageOut); err != nil {
 		return err
 	}
@@ -70,15 +103,216 @@ func (r *RPCClient) Connect(rpcEndpoint string) error {
 	var registerReply common.RegisterReply
 	err = json.Unmarshal([]byte(messageIn), &registerReply)
 	if err != nil {
+		conn.Close()
+		return err
+	}
+	if registerReply.Code != 0 || registerReply.Type != common.REGISTER_REPLY {
+		conn.Close()
+		return common.NewReplyError(registerReply.Code, registerReply.Type, registerReply.Message)
+	}
+	if err := common.CheckServerVersion(registerReply.Version); err != nil {
+		conn.Close()
 		return err
 	}
 
-	r.connected = true
 	r.ipcSocket = registerReply.IPCSocket
-	r.remoteInstanceID = registerReply.InstanceID
-	// TODO: compatible server check
+	r.instanceID = common.InstanceID(registerReply.InstanceID)
+	return nil
+}
 
-	// r.instanceID = registerReply.InstanceID
-	// fmt.Println(messageIn)
+// CreateRemoteBlob creates a sealed blob with the given content on the remote
+// vineyard instance, the content is sent over the connection.
+func (r *RPCClient) CreateRemoteBlob(ctx context.Context, data []byte) (common.ObjectID, error) {
+	if err := r.lock(ctx); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	defer r.unlock()
+	var messageOut string
+	common.WriteCreateRemoteBufferRequest(len(data), r.compress, &messageOut)
+	if err := r.DoWrite(messageOut); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	// the server reads the content before replying
+	if len(data) > 0 {
+		var err error
+		if r.compress {
+			err = common.SendCompressed(r.conn, data)
+		} else {
+			err = SendBytes(r.conn, data, len(data))
+		}
+		if err != nil {
+			return common.InvalidObjectID(), r.markBroken(err)
+		}
+	}
+	var messageIn string
+	if err := r.DoRead(&messageIn); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var createBufferReply common.CreateBufferReply
+	if err := json.Unmarshal([]byte(messageIn), &createBufferReply); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if createBufferReply.Code != 0 || createBufferReply.Type != common.CREAT_BUFFER_REPLY {
+		err := common.NewReplyError(createBufferReply.Code, createBufferReply.Type, createBufferReply.Message)
+		// the server may reply before the content is consumed, e.g., when it
+		// runs out of memory, and the rest of content can't be told apart
+		// from the next request.
+		return common.InvalidObjectID(), r.markBroken(err)
+	}
+	if createBufferReply.Created.DataSize != len(data) {
+		return common.InvalidObjectID(), fmt.Errorf("the result blob size doesn't match with the requested size: %d vs. %d",
+			createBufferReply.Created.DataSize, len(data))
+	}
+	return createBufferReply.ID, nil
+}
+
+// GetRemoteBlobs fetches the given blobs from the remote vineyard instance,
+// the content of blobs is received over the connection and copied into
+// the memory of the client.
+func (r *RPCClient) GetRemoteBlobs(ctx context.Context, ids []common.ObjectID) (map[common.ObjectID]*ds.Blob, error) {
+	blobs := make(map[common.ObjectID]*ds.Blob)
+	if len(ids) == 0 {
+		return blobs, nil
+	}
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+	return r.getRemoteBlobs(ids)
+}
+
+func (r *RPCClient) getRemoteBlobs(ids []common.ObjectID) (map[common.ObjectID]*ds.Blob, error) {
+	blobs := make(map[common.ObjectID]*ds.Blob)
+	if len(ids) == 0 {
+		return blobs, nil
+	}
+	var messageOut string
+	common.WriteGetRemoteBuffersRequest(ids, false, r.compress, &messageOut)
+	if err := r.DoWrite(messageOut); err != nil {
+		return nil, err
+	}
+	var messageIn string
+	if err := r.DoRead(&messageIn); err != nil {
+		return nil, err
+	}
+	var getBuffersReply common.GetBuffersReply
+	if err := json.Unmarshal([]byte(messageIn), &getBuffersReply); err != nil {
+		return nil, err
+	}
+	if getBuffersReply.Code != 0 || getBuffersReply.Type != common.GET_BUFFERS_REPLY {
+		return nil, common.NewReplyError(getBuffersReply.Code, getBuffersReply.Type, getBuffersReply.Message)
+	}
+
+	// the server sends the content of blobs in the order of payloads, and
+	// compresses it only if it supports compression as well. The content is
+	// read through the codec, which may have buffered it with the reply.
+	buffers := make([][]byte, 0, len(getBuffersReply.Payloads))
+	for _, payload := range getBuffersReply.Payloads {
+		buffer := make([]byte, payload.DataSize)
+		blob := &ds.Blob{}
+		blob.Reset(payload.ID, payload.DataSize, buffer)
+		blobs[payload.ID] = blob
+		buffers = append(buffers, buffer)
+	}
+	var err error
+	if getBuffersReply.Compress {
+		err = common.RecvCompressed(r.codec, buffers...)
+	} else {
+		for _, buffer := range buffers {
+			if err = RecvBytes(r.codec, buffer, len(buffer)); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, r.markBroken(err)
+	}
+	return blobs, nil
+}
+
+// CreateBlob creates a local buffer of the given size, which is sent to the
+// remote instance as a blob when the blob writer is sealed.
+func (r *RPCClient) CreateBlob(ctx context.Context, size int, blob *ds.BlobWriter) error {
+	if !r.connected {
+		return errors.New("rpc client is not connected")
+	}
+	payload := ds.Payload{
+		ID:       common.InvalidObjectID(),
+		StoreFd:  -1,
+		ArenaFd:  -1,
+		DataSize: size,
+	}
+	blob.Reset(r, common.InvalidObjectID(), payload, *memory.NewBufferBytes(make([]byte, size)))
+	return nil
+}
+
+// Seal is a no-op, as the remote blobs are sealed when they are created.
+func (r *RPCClient) Seal(ctx context.Context, id common.ObjectID) error {
+	return nil
+}
+
+// DropBuffer releases a blob writer that hasn't been sealed, which has never
+// been sent to the remote instance, the remote blobs are immutable and can
+// only be deleted by DelData.
+func (r *RPCClient) DropBuffer(ctx context.Context, id common.ObjectID, fd int) error {
+	if id == common.InvalidObjectID() {
+		return nil
+	}
+	return common.NewReplyError(common.KObjectSealed, common.DROP_BUFFER_REQUEST,
+		"the remote blob has been sealed: "+common.ObjectIDToString(id))
+}
+
+// Release is a no-op, as the remote blobs are copied to the client and never
+// referred in the remote instance.
+func (r *RPCClient) Release(ctx context.Context, id common.ObjectID) error {
 	return nil
 }
+
+// GetBlobs is the same as GetRemoteBlobs.
+func (r *RPCClient) GetBlobs(ctx context.Context, ids []common.ObjectID) (map[common.ObjectID]*ds.Blob, error) {
+	return r.GetRemoteBlobs(ctx, ids)
+}
+
+// GetMetaData fetches the metadata tree of the given object, as well as the
+// content of the blobs that the object refers to, which must be on the remote
+// instance.
+func (r *RPCClient) GetMetaData(ctx context.Context, id common.ObjectID, meta *ds.ObjectMeta, syncRemote bool) error {
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	defer r.unlock()
+	if err := r.getMetaData(id, meta, syncRemote); err != nil {
+		return err
+	}
+	blobs, err := r.getRemoteBlobs(meta.GetBufferSet().AllBufferIds())
+	if err != nil {
+		return err
+	}
+	for blobID, blob := range blobs {
+		if err := meta.SetBuffer(blobID, blob); err != nil {
+			return err
+		}
+	}
+	meta.SetClient(r)
+	return nil
+}
+
+// GetObject fetches the object from vineyard and builds the typed go value by
+// the resolver registered for its typename, see also ds.RegisterResolver.
+func (r *RPCClient) GetObject(ctx context.Context, id common.ObjectID, options ...GetObjectOption) (interface{}, error) {
+	var opts getObjectOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.fetchRemote {
+		var err error
+		if id, err = r.MigrateObject(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	var meta ds.ObjectMeta
+	if err := r.GetMetaData(ctx, id, &meta, false); err != nil {
+		return nil, err
+	}
+	return ds.ResolveObject(&meta)
+}
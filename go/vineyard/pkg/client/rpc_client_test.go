@@ -15,17 +15,101 @@ limitations under the License.
 
 package vineyard
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
 
 func TestRPCServer_Connect(t *testing.T) {
-	ipcAddr := "0.0.0.0:9600"
+	ctx := vineyardtest.Context(t)
+	ipcAddr := vineyardtest.Start(t, nil).RPCEndpoint()
 	var rpcServer RPCClient
-	err := rpcServer.Connect(ipcAddr)
+	err := rpcServer.Connect(ctx, ipcAddr)
 	if err != nil {
 		t.Error("connect to rpc server failed", err.Error())
 	}
-	err = rpcServer.Disconnect()
+	err = rpcServer.Disconnect(ctx)
 	if err != nil {
 		t.Error("disconnect rpc server failed", err.Error())
 	}
 }
+
+func TestRPCClient_RemoteBlobs(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	for _, compress := range []bool{false, true} {
+		client := newRPCClient(t, server)
+		client.SetCompression(compress)
+
+		contents := [][]byte{
+			bytes.Repeat([]byte("vineyard"), 100000),
+			{},
+			[]byte("remote blob"),
+		}
+		ids := make([]common.ObjectID, 0, len(contents))
+		for _, content := range contents {
+			id, err := client.CreateRemoteBlob(ctx, content)
+			if err != nil {
+				t.Fatal("create remote blob failed", compress, err)
+			}
+			ids = append(ids, id)
+		}
+		// the connection is still in sync after the blobs are received
+		for round := 0; round < 2; round++ {
+			result, err := client.GetRemoteBlobs(ctx, ids)
+			if err != nil {
+				t.Fatal("get remote blobs failed", compress, err)
+			}
+			for index, id := range ids {
+				data, err := result[id].Data()
+				if err != nil || !bytes.Equal(data, contents[index]) {
+					t.Error("the content of remote blob doesn't match", compress, index, err)
+				}
+			}
+		}
+	}
+}
+
+func TestRPCClient_BlobWriter(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	client := newRPCClient(t, vineyardtest.Start(t, nil))
+
+	var writer vineyard.BlobWriter
+	if err := client.CreateBlob(ctx, 16, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	for index := range writer.Bytes() {
+		writer.Bytes()[index] = byte(index)
+	}
+	if writer.ID != common.InvalidObjectID() {
+		t.Fatal("the blob shouldn't be sent before sealing")
+	}
+	blob, err := writer.Seal(ctx)
+	if err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	blobs, err := client.GetBlobs(ctx, []common.ObjectID{blob.ID()})
+	if err != nil {
+		t.Fatal("get blobs failed", err)
+	}
+	data, err := blobs[blob.ID()].Data()
+	if blob.ID() != writer.ID || err != nil || !bytes.Equal(data, writer.Bytes()) {
+		t.Error("the sealed blob doesn't match", blob.ID(), writer.ID, err)
+	}
+	if err := writer.Abort(ctx); !errors.Is(err, common.ErrObjectSealed) {
+		t.Error("abort a sealed blob should fail", err)
+	}
+
+	var aborted vineyard.BlobWriter
+	if err := client.CreateBlob(ctx, 16, &aborted); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	if err := aborted.Abort(ctx); err != nil {
+		t.Error("abort blob failed", err)
+	}
+}
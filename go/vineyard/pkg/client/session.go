@@ -0,0 +1,120 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// ConnectOption configures the session that the ipc client connects to.
+type ConnectOption func(*connectOptions)
+
+type connectOptions struct {
+	sessionID  common.SessionID
+	newSession bool
+}
+
+// WithSession connects to the session of the given id rather than the session
+// of the ipc socket, the client is redirected to the socket of the session.
+func WithSession(id common.SessionID) ConnectOption {
+	return func(options *connectOptions) {
+		options.sessionID = id
+	}
+}
+
+// WithNewSession creates a new session in vineyard and connects to it, the
+// objects and names in the session are isolated from other sessions. It
+// takes precedence over WithSession.
+func WithNewSession() ConnectOption {
+	return func(options *connectOptions) {
+		options.newSession = true
+	}
+}
+
+// SessionID returns the id of the session that the client is connected to.
+func (i *IPCClient) SessionID() common.SessionID {
+	return i.sessionID
+}
+
+// IPCSocket returns the ipc socket that the client is connected to, which is
+// the socket of the session the client has been redirected to.
+func (i *IPCClient) IPCSocket() string {
+	return i.ipcSocket
+}
+
+// newSession asks vineyard on the ipc socket to create a new session, and
+// returns the socket of the session. The connection is closed afterwards.
+func (i *IPCClient) newSession(ctx context.Context) (string, error) {
+	if err := i.connect(ctx); err != nil {
+		return "", err
+	}
+	defer i.conn.Close()
+	i.watch(ctx)
+	defer i.unwatch()
+	var messageOut string
+	common.WriteNewSessionRequest(&messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return "", err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return "", err
+	}
+	var newSessionReply common.NewSessionReply
+	if err := json.Unmarshal([]byte(messageIn), &newSessionReply); err != nil {
+		return "", err
+	}
+	if newSessionReply.Code != 0 || newSessionReply.Type != common.NEW_SESSION_REPLY {
+		return "", common.NewReplyError(newSessionReply.Code, newSessionReply.Type, newSessionReply.Message)
+	}
+	common.WriteExitRequest(&messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return "", err
+	}
+	return newSessionReply.SocketPath, nil
+}
+
+// DeleteSession deletes the session that the client is connected to, along
+// with the objects and names in it, and disconnects the client. The root
+// session can't be deleted.
+func (i *IPCClient) DeleteSession(ctx context.Context) error {
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
+	var messageOut string
+	common.WriteDeleteSessionRequest(&messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var deleteSessionReply common.DeleteSessionReply
+	if err := json.Unmarshal([]byte(messageIn), &deleteSessionReply); err != nil {
+		return err
+	}
+	if deleteSessionReply.Code != 0 || deleteSessionReply.Type != common.DELETE_SESSION_REPLY {
+		return common.NewReplyError(deleteSessionReply.Code, deleteSessionReply.Type, deleteSessionReply.Message)
+	}
+	// vineyard closes the connections to the session once it's deleted
+	i.connected = false
+	return i.conn.Close()
+}
@@ -0,0 +1,79 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"testing"
+
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+func TestIPCClient_Session(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+
+	root := newIPCClient(t, server)
+	if root.SessionID() != common.RootSessionID() || root.IPCSocket() != server.IPCSocket() {
+		t.Error("the client should connect to the root session", root.SessionID(), root.IPCSocket())
+	}
+
+	session := newIPCClient(t, server, WithNewSession())
+	if session.SessionID() == common.RootSessionID() || session.IPCSocket() == server.IPCSocket() {
+		t.Fatal("the client should be redirected to the new session", session.SessionID(), session.IPCSocket())
+	}
+
+	// the names are isolated between sessions
+	var meta vineyard.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Scalar<int64>")
+	meta.AddKeyValue("value_", 42)
+	id, err := session.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+	if err := session.PutName(ctx, id, "test_session"); err != nil {
+		t.Fatal("put name failed", err)
+	}
+	var found common.ObjectID
+	if err := root.GetName(ctx, "test_session", false, &found); err == nil {
+		t.Error("the name in the session should be invisible to the root session")
+	}
+
+	attached := newIPCClient(t, server, WithSession(session.SessionID()))
+	if attached.SessionID() != session.SessionID() || attached.IPCSocket() != session.IPCSocket() {
+		t.Error("the client should be redirected to the session", attached.SessionID(), attached.IPCSocket())
+	}
+	if err := attached.GetName(ctx, "test_session", false, &found); err != nil || found != id {
+		t.Error("get name in the session failed", err)
+	}
+
+	var missing IPCClient
+	if err := missing.Connect(ctx, server.IPCSocket(), WithSession(session.SessionID()+1)); err == nil {
+		t.Error("connect to a session that doesn't exist should fail")
+	}
+
+	if err := root.DeleteSession(ctx); err == nil {
+		t.Error("the root session should not be deleted")
+	}
+	if err := session.DeleteSession(ctx); err != nil {
+		t.Fatal("delete session failed", err)
+	}
+	if err := missing.Connect(ctx, server.IPCSocket(), WithSession(session.SessionID())); err == nil {
+		t.Error("connect to a deleted session should fail")
+	}
+}
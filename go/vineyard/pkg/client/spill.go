@@ -0,0 +1,155 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// Evict spills the local blobs of the objects out of the shared memory, which
+// requires vineyardd to be deployed with a spill path. The pinned blobs are
+// kept in memory.
+func (c *ClientBase) Evict(ctx context.Context, ids []common.ObjectID) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteEvictRequest(ids, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var evictReply common.EvictReply
+	if err := json.Unmarshal([]byte(messageIn), &evictReply); err != nil {
+		return err
+	}
+	if evictReply.Code != 0 || evictReply.Type != common.EVICT_REPLY {
+		return common.NewReplyError(evictReply.Code, evictReply.Type, evictReply.Message)
+	}
+	return nil
+}
+
+// Load reloads the spilled blobs of the objects into the shared memory, e.g.,
+// to warm up the inputs before they are used. The pinned blobs are never
+// spilled until they are unpinned.
+func (c *ClientBase) Load(ctx context.Context, ids []common.ObjectID, pin bool) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteLoadRequest(ids, pin, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var loadReply common.LoadReply
+	if err := json.Unmarshal([]byte(messageIn), &loadReply); err != nil {
+		return err
+	}
+	if loadReply.Code != 0 || loadReply.Type != common.LOAD_REPLY {
+		return common.NewReplyError(loadReply.Code, loadReply.Type, loadReply.Message)
+	}
+	return nil
+}
+
+// Unpin allows the blobs of the objects that are pinned by Load to be spilled
+// again.
+func (c *ClientBase) Unpin(ctx context.Context, ids []common.ObjectID) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteUnpinRequest(ids, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var unpinReply common.UnpinReply
+	if err := json.Unmarshal([]byte(messageIn), &unpinReply); err != nil {
+		return err
+	}
+	if unpinReply.Code != 0 || unpinReply.Type != common.UNPIN_REPLY {
+		return common.NewReplyError(unpinReply.Code, unpinReply.Type, unpinReply.Message)
+	}
+	return nil
+}
+
+// IsSpilled tells whether the blob has been spilled out of the shared memory.
+func (c *ClientBase) IsSpilled(ctx context.Context, id common.ObjectID) (bool, error) {
+	if err := c.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteIsSpilledRequest(id, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return false, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return false, err
+	}
+	var isSpilledReply common.IsSpilledReply
+	if err := json.Unmarshal([]byte(messageIn), &isSpilledReply); err != nil {
+		return false, err
+	}
+	if isSpilledReply.Code != 0 || isSpilledReply.Type != common.IS_SPILLED_REPLY {
+		return false, common.NewReplyError(isSpilledReply.Code, isSpilledReply.Type, isSpilledReply.Message)
+	}
+	return isSpilledReply.IsSpilled, nil
+}
+
+// IsInUse tells whether the blob is in use by clients, the blobs that are not
+// in use are the candidates to be spilled. vineyardd takes the blobs it
+// doesn't track as in use.
+func (c *ClientBase) IsInUse(ctx context.Context, id common.ObjectID) (bool, error) {
+	if err := c.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WriteIsInUseRequest(id, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return false, err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return false, err
+	}
+	var isInUseReply common.IsInUseReply
+	if err := json.Unmarshal([]byte(messageIn), &isInUseReply); err != nil {
+		return false, err
+	}
+	if isInUseReply.Code != 0 || isInUseReply.Type != common.IS_IN_USE_REPLY {
+		return false, common.NewReplyError(isInUseReply.Code, isInUseReply.Type, isInUseReply.Message)
+	}
+	return isInUseReply.IsInUse, nil
+}
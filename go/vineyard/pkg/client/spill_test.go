@@ -0,0 +1,140 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+func TestClientBase_Spill(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, &vineyardtest.Options{Spill: true})
+	ipcClient := newIPCClient(t, server)
+	rpcClient := newRPCClient(t, server)
+
+	content := bytes.Repeat([]byte("spill"), 1024)
+	var writer vineyard.BlobWriter
+	if err := ipcClient.CreateBlob(ctx, len(content), &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	copy(writer.Bytes(), content)
+	if _, err := writer.Seal(ctx); err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	var meta vineyard.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Scalar<int64>")
+	if err := meta.AddMemberID("buffer_", writer.ID); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	id, err := ipcClient.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+
+	// the blobs in use are not spilled
+	if inUse, err := ipcClient.IsInUse(ctx, writer.ID); err != nil || !inUse {
+		t.Error("the created blob should be in use", inUse, err)
+	}
+	if err := ipcClient.Evict(ctx, []common.ObjectID{id}); err != nil {
+		t.Fatal("evict failed", err)
+	}
+	if spilled, err := ipcClient.IsSpilled(ctx, writer.ID); err != nil || spilled {
+		t.Error("the blob in use shouldn't be spilled", spilled, err)
+	}
+	if err := ipcClient.Release(ctx, writer.ID); err != nil {
+		t.Fatal("release blob failed", err)
+	}
+	if inUse, err := rpcClient.IsInUse(ctx, writer.ID); err != nil || inUse {
+		t.Error("the released blob shouldn't be in use", inUse, err)
+	}
+
+	if err := rpcClient.Evict(ctx, []common.ObjectID{id}); err != nil {
+		t.Fatal("evict failed", err)
+	}
+	if spilled, err := rpcClient.IsSpilled(ctx, writer.ID); err != nil || !spilled {
+		t.Error("the blob should be spilled", spilled, err)
+	}
+	status, err := rpcClient.InstanceStatus(ctx)
+	if err != nil {
+		t.Fatal("get instance status failed", err)
+	}
+	if status.MemoryUsage != 0 {
+		t.Error("the memory of the spilled blob should be freed", status.MemoryUsage)
+	}
+
+	// the pinned blobs stay in memory
+	if err := rpcClient.Load(ctx, []common.ObjectID{id}, true); err != nil {
+		t.Fatal("load failed", err)
+	}
+	if spilled, err := rpcClient.IsSpilled(ctx, writer.ID); err != nil || spilled {
+		t.Error("the blob should be reloaded", spilled, err)
+	}
+	if err := rpcClient.Evict(ctx, []common.ObjectID{id}); err != nil {
+		t.Fatal("evict failed", err)
+	}
+	if spilled, err := rpcClient.IsSpilled(ctx, writer.ID); err != nil || spilled {
+		t.Error("the pinned blob shouldn't be spilled", spilled, err)
+	}
+	if err := rpcClient.Unpin(ctx, []common.ObjectID{id}); err != nil {
+		t.Fatal("unpin failed", err)
+	}
+	if err := rpcClient.Evict(ctx, []common.ObjectID{writer.ID}); err != nil {
+		t.Fatal("evict failed", err)
+	}
+	if spilled, err := rpcClient.IsSpilled(ctx, writer.ID); err != nil || !spilled {
+		t.Error("the unpinned blob should be spilled", spilled, err)
+	}
+
+	// the spilled blobs are reloaded once accessed
+	blobs, err := rpcClient.GetBlobs(ctx, []common.ObjectID{writer.ID})
+	if err != nil {
+		t.Fatal("get blobs failed", err)
+	}
+	if data, err := blobs[writer.ID].Data(); err != nil || !bytes.Equal(data, content) {
+		t.Error("the content of the reloaded blob is corrupted", err)
+	}
+	if spilled, err := rpcClient.IsSpilled(ctx, writer.ID); err != nil || spilled {
+		t.Error("the accessed blob should be reloaded", spilled, err)
+	}
+}
+
+func TestClientBase_SpillDisabled(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client, err := Connect(ctx, server.IPCSocket())
+	if err != nil {
+		t.Fatal("connect to vineyard failed", err)
+	}
+	defer client.Disconnect(context.Background())
+	var missing common.ObjectID = 42
+	if err := client.Evict(ctx, []common.ObjectID{missing}); !errors.Is(err, common.ErrInvalid) {
+		t.Error("evicting should fail when spilling is disabled", err)
+	}
+	if err := client.Load(ctx, []common.ObjectID{missing}, false); err != nil {
+		t.Error("loading should be bypassed when spilling is disabled", err)
+	}
+	if inUse, err := client.IsInUse(ctx, missing); err != nil || !inUse {
+		t.Error("the unknown blob is taken as in use", inUse, err)
+	}
+}
@@ -0,0 +1,552 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// StreamOpenMode is the mode to open a stream, a stream can be opened by at
+// most one reader and one writer.
+type StreamOpenMode int64
+
+const (
+	StreamOpenRead  StreamOpenMode = 1
+	StreamOpenWrite StreamOpenMode = 2
+)
+
+const (
+	byteStreamTypename        = "vineyard::ByteStream"
+	recordBatchStreamTypename = "vineyard::RecordBatchStream"
+)
+
+// kDefaultByteStreamChunkSize is the size of the chunks that the writers of
+// byte streams cut the data into if not specified.
+const kDefaultByteStreamChunkSize = 1 << 20
+
+// CreateStream creates the stream in vineyard for the stream object, which
+// has been created by CreateMetaData.
+func (c *ClientBase) CreateStream(ctx context.Context, id common.ObjectID) error {
+	var messageOut string
+	common.WriteCreateStreamRequest(id, &messageOut)
+	return c.doStreamRequest(ctx, messageOut, common.CREATE_STREAM_REPLY)
+}
+
+func (c *ClientBase) OpenStream(ctx context.Context, id common.ObjectID, mode StreamOpenMode) error {
+	var messageOut string
+	common.WriteOpenStreamRequest(id, int64(mode), &messageOut)
+	return c.doStreamRequest(ctx, messageOut, common.OPEN_STREAM_REPLY)
+}
+
+// PushNextStreamChunk pushes the object to the stream as the next chunk, it
+// blocks until the stream has room for the chunk.
+func (c *ClientBase) PushNextStreamChunk(ctx context.Context, id common.ObjectID, chunk common.ObjectID) error {
+	var messageOut string
+	common.WritePushNextStreamChunkRequest(id, chunk, &messageOut)
+	return c.doStreamRequest(ctx, messageOut, common.PUSH_NEXT_STREAM_CHUNK_REPLY)
+}
+
+// PullNextStreamChunk returns the id of the next chunk in the stream, it
+// blocks until the chunk is ready. The error matches common.ErrStreamDrained
+// once the stream has been stopped and all chunks have been pulled.
+func (c *ClientBase) PullNextStreamChunk(ctx context.Context, id common.ObjectID) (common.ObjectID, error) {
+	if err := c.lock(ctx); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	defer c.unlock()
+	var messageOut string
+	common.WritePullNextStreamChunkRequest(id, &messageOut)
+	if err := c.DoWrite(messageOut); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var pullReply common.PullNextStreamChunkReply
+	if err := json.Unmarshal([]byte(messageIn), &pullReply); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if pullReply.Code != 0 || pullReply.Type != common.PULL_NEXT_STREAM_CHUNK_REPLY {
+		return common.InvalidObjectID(), common.NewReplyError(pullReply.Code, pullReply.Type, pullReply.Message)
+	}
+	return pullReply.Chunk, nil
+}
+
+// StopStream marks the end of the stream, the readers see the failure of
+// the stream if failed is set.
+func (c *ClientBase) StopStream(ctx context.Context, id common.ObjectID, failed bool) error {
+	var messageOut string
+	common.WriteStopStreamRequest(id, failed, &messageOut)
+	return c.doStreamRequest(ctx, messageOut, common.STOP_STREAM_REPLY)
+}
+
+func (c *ClientBase) DropStream(ctx context.Context, id common.ObjectID) error {
+	var messageOut string
+	common.WriteDropStreamRequest(id, &messageOut)
+	return c.doStreamRequest(ctx, messageOut, common.DROP_STREAM_REPLY)
+}
+
+// doStreamRequest sends the stream request whose reply carries no result.
+func (c *ClientBase) doStreamRequest(ctx context.Context, messageOut string, replyType string) error {
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if err := c.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := c.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var streamReply common.StreamReply
+	if err := json.Unmarshal([]byte(messageIn), &streamReply); err != nil {
+		return err
+	}
+	if streamReply.Code != 0 || streamReply.Type != replyType {
+		return common.NewReplyError(streamReply.Code, streamReply.Type, streamReply.Message)
+	}
+	return nil
+}
+
+// GetNextStreamChunk allocates the next chunk of the given size in the byte
+// stream, the returned buffer is the shared memory and can be filled in
+// place. The chunk becomes visible to the reader when the next chunk is
+// allocated or the stream is stopped. The chunk is in use by the client until
+// released by Release, as the buffer is the shared memory.
+func (i *IPCClient) GetNextStreamChunk(ctx context.Context, id common.ObjectID, size int) (common.ObjectID, []byte, error) {
+	if err := i.lock(ctx); err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	defer i.unlock()
+	var messageOut string
+	common.WriteGetNextStreamChunkRequest(id, size, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	var getNextReply common.GetNextStreamChunkReply
+	if err := json.Unmarshal([]byte(messageIn), &getNextReply); err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	if getNextReply.Code != 0 || getNextReply.Type != common.GET_NEXT_STREAM_CHUNK_REPLY {
+		return common.InvalidObjectID(), nil, common.NewReplyError(getNextReply.Code, getNextReply.Type, getNextReply.Message)
+	}
+	payload := getNextReply.Buffer
+	if payload.DataSize != size {
+		return common.InvalidObjectID(), nil, fmt.Errorf("the size of the stream chunk is not matched: %d != %d", payload.DataSize, size)
+	}
+	if payload.DataSize == 0 {
+		return payload.ID, []byte{}, nil
+	}
+	var shared *uint8
+	if err := i.MmapToClient(payload.StoreFd, int64(payload.MapSize), false, true, &shared); err != nil {
+		return common.InvalidObjectID(), nil, i.markBroken(err)
+	}
+	// vineyard doesn't count the chunks for the connection
+	i.addUsage(payload.ID, payload.StoreFd, true)
+	return payload.ID, bytesAt(shared, payload.DataOffset, payload.DataSize), nil
+}
+
+// Stream is a stream opened by the client, as either the reader or the
+// writer. The requests on a stream block until the peer catches up, which
+// is the backpressure of the stream, and can be canceled by the context.
+type Stream struct {
+	client Client
+	id     common.ObjectID
+	mode   StreamOpenMode
+}
+
+// OpenStreamAs opens the stream in the given mode.
+func OpenStreamAs(ctx context.Context, client Client, id common.ObjectID, mode StreamOpenMode) (*Stream, error) {
+	if err := client.OpenStream(ctx, id, mode); err != nil {
+		return nil, err
+	}
+	return &Stream{client: client, id: id, mode: mode}, nil
+}
+
+func (s *Stream) ID() common.ObjectID {
+	return s.id
+}
+
+func (s *Stream) Mode() StreamOpenMode {
+	return s.mode
+}
+
+// Params returns the parameters of the stream, which are set when the stream
+// is created. The values are not necessarily strings, e.g., the Python client
+// sets the "length" of byte streams as an integer, which is a json.Number.
+func (s *Stream) Params(ctx context.Context) (map[string]interface{}, error) {
+	var meta ds.ObjectMeta
+	if err := s.client.GetMetaData(ctx, s.id, &meta, false); err != nil {
+		return nil, err
+	}
+	switch params := meta.MetaData()["params_"].(type) {
+	case nil:
+		return make(map[string]interface{}), nil
+	case string:
+		decoded, err := ds.ParseMetaData([]byte(params))
+		if err != nil {
+			return nil, fmt.Errorf("invalid params of stream %s: %w", common.ObjectIDToString(s.id), err)
+		}
+		return decoded, nil
+	case map[string]interface{}:
+		return params, nil
+	default:
+		return nil, fmt.Errorf("invalid params of stream %s: %v", common.ObjectIDToString(s.id), params)
+	}
+}
+
+// Push pushes the object to the stream as the next chunk.
+func (s *Stream) Push(ctx context.Context, chunk common.ObjectID) error {
+	if s.mode != StreamOpenWrite {
+		return errors.New("the stream is not opened for writing")
+	}
+	return s.client.PushNextStreamChunk(ctx, s.id, chunk)
+}
+
+// Pull returns the id of the next chunk, the error matches
+// common.ErrStreamDrained at the end of the stream.
+func (s *Stream) Pull(ctx context.Context) (common.ObjectID, error) {
+	if s.mode != StreamOpenRead {
+		return common.InvalidObjectID(), errors.New("the stream is not opened for reading")
+	}
+	return s.client.PullNextStreamChunk(ctx, s.id)
+}
+
+// Finish marks the end of the stream after all chunks have been written.
+func (s *Stream) Finish(ctx context.Context) error {
+	return s.client.StopStream(ctx, s.id, false)
+}
+
+// Abort stops the stream as failed.
+func (s *Stream) Abort(ctx context.Context) error {
+	return s.client.StopStream(ctx, s.id, true)
+}
+
+// Drop releases the stream in vineyard.
+func (s *Stream) Drop(ctx context.Context) error {
+	return s.client.DropStream(ctx, s.id)
+}
+
+// newStream creates the stream object of the typename with the parameters.
+func newStream(ctx context.Context, client Client, typename string, params map[string]interface{}) (common.ObjectID, error) {
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	// the nested maps in metadata are members, thus the parameters are
+	// kept as a JSON string, as the C++ and Python clients do.
+	content, err := json.Marshal(params)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	var meta ds.ObjectMeta
+	meta.Init()
+	meta.SetTypename(typename)
+	meta.AddKeyValue("params_", string(content))
+	meta.SetNBytes(0)
+	id, err := client.CreateMetaData(ctx, &meta)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if err := client.CreateStream(ctx, id); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	return id, nil
+}
+
+// NewByteStream creates a `vineyard::ByteStream`, whose chunks are blobs.
+func NewByteStream(ctx context.Context, client Client, params map[string]interface{}) (common.ObjectID, error) {
+	return newStream(ctx, client, byteStreamTypename, params)
+}
+
+// ByteStreamWriter writes to the chunks in the shared memory, thus it can
+// only be opened by an ipc client.
+type ByteStreamWriter struct {
+	*Stream
+	ipcClient *IPCClient
+	// chunk is the chunk being written
+	chunk common.ObjectID
+}
+
+func OpenByteStreamWriter(ctx context.Context, client *IPCClient, id common.ObjectID) (*ByteStreamWriter, error) {
+	stream, err := OpenStreamAs(ctx, client, id, StreamOpenWrite)
+	if err != nil {
+		return nil, err
+	}
+	return &ByteStreamWriter{Stream: stream, ipcClient: client, chunk: common.InvalidObjectID()}, nil
+}
+
+// Next allocates the next chunk of the given size, which should be filled
+// before the next call of Next or Finish.
+func (w *ByteStreamWriter) Next(ctx context.Context, size int) ([]byte, error) {
+	chunk, buffer, err := w.ipcClient.GetNextStreamChunk(ctx, w.id, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.releaseChunk(ctx); err != nil {
+		return nil, err
+	}
+	if len(buffer) > 0 {
+		w.chunk = chunk
+	}
+	return buffer, nil
+}
+
+// Finish marks the end of the stream after all chunks have been written.
+func (w *ByteStreamWriter) Finish(ctx context.Context) error {
+	if err := w.Stream.Finish(ctx); err != nil {
+		return err
+	}
+	return w.releaseChunk(ctx)
+}
+
+// Abort stops the stream as failed.
+func (w *ByteStreamWriter) Abort(ctx context.Context) error {
+	if err := w.Stream.Abort(ctx); err != nil {
+		return err
+	}
+	return w.releaseChunk(ctx)
+}
+
+// releaseChunk releases the chunk that has been written, which has been
+// handed over to the reader.
+func (w *ByteStreamWriter) releaseChunk(ctx context.Context) error {
+	if w.chunk == common.InvalidObjectID() {
+		return nil
+	}
+	chunk := w.chunk
+	w.chunk = common.InvalidObjectID()
+	return w.ipcClient.Release(ctx, chunk)
+}
+
+// WriteChunk writes the data to the stream as a chunk.
+func (w *ByteStreamWriter) WriteChunk(ctx context.Context, data []byte) error {
+	chunk, err := w.Next(ctx, len(data))
+	if err != nil {
+		return err
+	}
+	copy(chunk, data)
+	return nil
+}
+
+// Writer returns an io.WriteCloser that cuts the written data into chunks of
+// the chunk size, a non-positive chunk size means 1MiB. Closing the writer
+// flushes the buffered data and finishes the stream. The context applies to
+// all the writes.
+func (w *ByteStreamWriter) Writer(ctx context.Context, chunkSize int) io.WriteCloser {
+	if chunkSize <= 0 {
+		chunkSize = kDefaultByteStreamChunkSize
+	}
+	return &byteStreamIOWriter{ctx: ctx, writer: w, buffer: make([]byte, 0, chunkSize)}
+}
+
+// byteStreamIOWriter buffers the written data until a chunk is full, the
+// chunks are written in place unless buffered.
+type byteStreamIOWriter struct {
+	ctx    context.Context
+	writer *ByteStreamWriter
+	buffer []byte
+	closed bool
+}
+
+func (w *byteStreamIOWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("the byte stream writer has been closed")
+	}
+	chunkSize, written := cap(w.buffer), 0
+	for len(data) > 0 {
+		if len(w.buffer) == 0 && len(data) >= chunkSize {
+			if err := w.writer.WriteChunk(w.ctx, data[:chunkSize]); err != nil {
+				return written, err
+			}
+			data, written = data[chunkSize:], written+chunkSize
+			continue
+		}
+		n := copy(w.buffer[len(w.buffer):chunkSize], data)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		data, written = data[n:], written+n
+		if len(w.buffer) == chunkSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *byteStreamIOWriter) flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	if err := w.writer.WriteChunk(w.ctx, w.buffer); err != nil {
+		return err
+	}
+	w.buffer = w.buffer[:0]
+	return nil
+}
+
+// Close flushes the buffered data and finishes the stream.
+func (w *byteStreamIOWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	w.closed = true
+	return w.writer.Finish(w.ctx)
+}
+
+type ByteStreamReader struct {
+	*Stream
+	// chunk is the chunk that has been read
+	chunk *ds.Blob
+}
+
+func OpenByteStreamReader(ctx context.Context, client Client, id common.ObjectID) (*ByteStreamReader, error) {
+	stream, err := OpenStreamAs(ctx, client, id, StreamOpenRead)
+	if err != nil {
+		return nil, err
+	}
+	return &ByteStreamReader{Stream: stream}, nil
+}
+
+// Next returns the content of the next chunk, which refers to the shared
+// memory directly for an ipc client and must not be modified. The content is
+// valid until the next call of Next. The error matches common.ErrStreamDrained
+// at the end of the stream.
+func (r *ByteStreamReader) Next(ctx context.Context) ([]byte, error) {
+	if r.chunk != nil {
+		if err := r.chunk.Release(ctx); err != nil {
+			return nil, err
+		}
+		r.chunk = nil
+	}
+	chunk, err := r.Pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := r.client.GetBlobs(ctx, []common.ObjectID{chunk})
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := blobs[chunk]
+	if !ok {
+		return nil, fmt.Errorf("the chunk %s of the stream is not found", common.ObjectIDToString(chunk))
+	}
+	r.chunk = blob
+	return blob.Data()
+}
+
+// Reader returns an io.Reader of the content of the chunks, which reaches
+// io.EOF at the end of the stream. The context applies to all the reads.
+func (r *ByteStreamReader) Reader(ctx context.Context) io.Reader {
+	return &byteStreamIOReader{ctx: ctx, reader: r}
+}
+
+type byteStreamIOReader struct {
+	ctx    context.Context
+	reader *ByteStreamReader
+	// chunk is the rest of the chunk that has been read
+	chunk []byte
+}
+
+func (r *byteStreamIOReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(r.chunk) == 0 {
+		chunk, err := r.reader.Next(r.ctx)
+		if errors.Is(err, common.ErrStreamDrained) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.chunk = chunk
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// NewRecordBatchStream creates a `vineyard::RecordBatchStream`, whose chunks
+// are `vineyard::RecordBatch` objects.
+func NewRecordBatchStream(ctx context.Context, client Client, params map[string]interface{}) (common.ObjectID, error) {
+	return newStream(ctx, client, recordBatchStreamTypename, params)
+}
+
+type RecordBatchStreamWriter struct {
+	*Stream
+}
+
+func OpenRecordBatchStreamWriter(ctx context.Context, client Client, id common.ObjectID) (*RecordBatchStreamWriter, error) {
+	stream, err := OpenStreamAs(ctx, client, id, StreamOpenWrite)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordBatchStreamWriter{Stream: stream}, nil
+}
+
+// Write creates the record batch in vineyard and pushes it to the stream.
+func (w *RecordBatchStreamWriter) Write(ctx context.Context, record array.Record) error {
+	var builder ds.RecordBatchBuilder
+	builder.Init(w.client, record)
+	if err := builder.Seal(ctx); err != nil {
+		return err
+	}
+	return w.Push(ctx, builder.Id())
+}
+
+type RecordBatchStreamReader struct {
+	*Stream
+}
+
+func OpenRecordBatchStreamReader(ctx context.Context, client Client, id common.ObjectID) (*RecordBatchStreamReader, error) {
+	stream, err := OpenStreamAs(ctx, client, id, StreamOpenRead)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordBatchStreamReader{Stream: stream}, nil
+}
+
+// Read returns the next record batch, which refers to the shared memory
+// directly for an ipc client. The error matches common.ErrStreamDrained at
+// the end of the stream.
+func (r *RecordBatchStreamReader) Read(ctx context.Context) (array.Record, error) {
+	chunk, err := r.Pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var meta ds.ObjectMeta
+	if err := r.client.GetMetaData(ctx, chunk, &meta, false); err != nil {
+		return nil, err
+	}
+	return ds.ReadRecordBatch(&meta)
+}
@@ -0,0 +1,167 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+func TestStream_PushPull(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	client := newIPCClient(t, vineyardtest.Start(t, nil))
+
+	var streamID common.ObjectID = 100
+	if err := client.CreateStream(ctx, streamID); err != nil {
+		t.Fatal("create stream failed", err)
+	}
+	if _, err := OpenStreamAs(ctx, client, 101, StreamOpenWrite); !errors.Is(err, common.ErrObjectNotExists) {
+		t.Error("open an unknown stream should fail", err)
+	}
+	writer, err := OpenStreamAs(ctx, client, streamID, StreamOpenWrite)
+	if err != nil {
+		t.Fatal("open stream failed", err)
+	}
+	reader, err := OpenStreamAs(ctx, client, streamID, StreamOpenRead)
+	if err != nil {
+		t.Fatal("open stream failed", err)
+	}
+	if _, err := writer.Pull(ctx); err == nil {
+		t.Error("pull from the writer should fail")
+	}
+	for chunk := common.ObjectID(1); chunk <= 3; chunk++ {
+		if err := writer.Push(ctx, chunk); err != nil {
+			t.Fatal("push chunk failed", err)
+		}
+	}
+	if err := writer.Finish(ctx); err != nil {
+		t.Fatal("finish stream failed", err)
+	}
+
+	for expected := common.ObjectID(1); expected <= 3; expected++ {
+		chunk, err := reader.Pull(ctx)
+		if err != nil || chunk != expected {
+			t.Fatal("pull chunk failed", chunk, err)
+		}
+	}
+	if _, err := reader.Pull(ctx); !errors.Is(err, common.ErrStreamDrained) {
+		t.Error("expect the stream to be drained", err)
+	}
+	if err := reader.Drop(ctx); err != nil {
+		t.Error("drop stream failed", err)
+	}
+}
+
+func TestStream_ByteStream(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client := newIPCClient(t, server)
+	rpcClient := newRPCClient(t, server)
+
+	id, err := NewByteStream(ctx, client, map[string]interface{}{"kind": "bytes", "length": 1024})
+	if err != nil {
+		t.Fatal("create byte stream failed", err)
+	}
+	writer, err := OpenByteStreamWriter(ctx, client, id)
+	if err != nil {
+		t.Fatal("open byte stream writer failed", err)
+	}
+	// the reader of the rpc client blocks until the chunks are written
+	reader, err := OpenByteStreamReader(ctx, rpcClient, id)
+	if err != nil {
+		t.Fatal("open byte stream reader failed", err)
+	}
+	params, err := reader.Params(ctx)
+	if err != nil || params["kind"] != "bytes" || params["length"] != json.Number("1024") {
+		t.Error("the params of the stream is not match", params, err)
+	}
+
+	chunks := [][]byte{[]byte("hello"), bytes.Repeat([]byte("vineyard"), 1024)}
+	done := make(chan error, 1)
+	go func() {
+		for _, chunk := range chunks {
+			if err := writer.WriteChunk(ctx, chunk); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- writer.Finish(ctx)
+	}()
+	for _, expected := range chunks {
+		data, err := reader.Next(ctx)
+		if err != nil || !bytes.Equal(data, expected) {
+			t.Fatal("read chunk failed", len(data), err)
+		}
+	}
+	if _, err := reader.Next(ctx); !errors.Is(err, common.ErrStreamDrained) {
+		t.Error("expect the stream to be drained", err)
+	}
+	if err := <-done; err != nil {
+		t.Error("write byte stream failed", err)
+	}
+}
+
+func TestStream_ByteStreamIO(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client := newIPCClient(t, server)
+
+	id, err := NewByteStream(ctx, client, nil)
+	if err != nil {
+		t.Fatal("create byte stream failed", err)
+	}
+	writer, err := OpenByteStreamWriter(ctx, client, id)
+	if err != nil {
+		t.Fatal("open byte stream writer failed", err)
+	}
+	// the reads block the connection until the chunks are written
+	readerClient := newIPCClient(t, server)
+	reader, err := OpenByteStreamReader(ctx, readerClient, id)
+	if err != nil {
+		t.Fatal("open byte stream reader failed", err)
+	}
+
+	content := bytes.Repeat([]byte("vineyard"), 1000)
+	done := make(chan error, 1)
+	go func() {
+		w := writer.Writer(ctx, 1000)
+		if _, err := w.Write(content[:10]); err != nil {
+			done <- err
+			return
+		}
+		if _, err := io.Copy(w, bytes.NewReader(content[10:])); err != nil {
+			done <- err
+			return
+		}
+		done <- w.Close()
+	}()
+	result, err := io.ReadAll(reader.Reader(ctx))
+	if err != nil {
+		t.Fatal("read byte stream failed", err)
+	}
+	if !bytes.Equal(result, content) {
+		t.Error("the content of the byte stream is not matched", len(result))
+	}
+	if err := <-done; err != nil {
+		t.Error("write byte stream failed", err)
+	}
+}
@@ -0,0 +1,249 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// blobUsage is the reference count of a blob that is in use by the client, as
+// the UsageTracker of the C++ client does.
+type blobUsage struct {
+	refCount int
+	storeFd  int
+	// local is set for the blobs that vineyard doesn't count for the
+	// connection, e.g., the chunks of streams, which are released without
+	// telling vineyard.
+	local bool
+}
+
+// blobTracker tracks the blobs fetched over a connection of the client, see
+// ds.Blob.Track. It's revoked once the connection is replaced or closed, as
+// vineyard releases the blobs in use by the connection when it's lost.
+type blobTracker struct {
+	client  *IPCClient
+	revoked int32
+}
+
+var _ ds.BlobTracker = &blobTracker{}
+
+func (t *blobTracker) ReleaseBlob(ctx context.Context, id common.ObjectID, unmap bool) error {
+	if err := t.client.lock(ctx); err != nil {
+		return err
+	}
+	defer t.client.unlock()
+	// the blob has been forgotten along with the connection
+	if !t.Valid() {
+		return nil
+	}
+	return t.client.removeUsage(id, unmap)
+}
+
+func (t *blobTracker) Valid() bool {
+	return atomic.LoadInt32(&t.revoked) == 0
+}
+
+// resetUsages forgets the blobs in use and the received fds of the current
+// connection, and revokes the tracker of the blobs. The shared memory in which
+// no blob is in use is unmapped, while the rest stays mapped until the client
+// is disconnected, as the data of the blobs may still be referred to. All the
+// shared memory is unmapped if all is set.
+func (i *IPCClient) resetUsages(all bool) {
+	if i.tracker != nil {
+		atomic.StoreInt32(&i.tracker.revoked, 1)
+	}
+	i.tracker = &blobTracker{client: i}
+	for _, entry := range i.mmapTable {
+		if entry.refCount > 0 && !all {
+			i.staleMmaps = append(i.staleMmaps, entry)
+		} else if err := entry.Unmap(); err != nil {
+			common.GetLogger().Warnf("failed to unmap the shared memory of fd %d: %v", entry.clientFd, err)
+		}
+		// the memory that has been mapped stays valid after the fd is closed
+		syscall.Close(entry.clientFd)
+	}
+	if all {
+		for _, entry := range i.staleMmaps {
+			if err := entry.Unmap(); err != nil {
+				common.GetLogger().Warnf("failed to unmap the shared memory of fd %d: %v", entry.clientFd, err)
+			}
+		}
+		i.staleMmaps = nil
+	}
+	i.mmapTable = make(map[int]*MmapEntry)
+	i.usages = make(map[common.ObjectID]*blobUsage)
+}
+
+// Release releases a reference of the blob, or of the blobs that the object
+// refers to. The blob is released in vineyard once no reference is left in
+// the client, and the shared memory is unmapped once no blob in it is in use.
+func (i *IPCClient) Release(ctx context.Context, id common.ObjectID) error {
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
+	if common.IsBlob(id) {
+		return i.removeUsage(id, true)
+	}
+	var meta ds.ObjectMeta
+	if err := i.getMetaData(id, &meta, true); err != nil {
+		return err
+	}
+	for _, blobID := range meta.GetBufferSet().AllBufferIds() {
+		// the blobs that haven't been fetched are not in use
+		if _, ok := i.usages[blobID]; !ok {
+			continue
+		}
+		if err := i.removeUsage(blobID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IncreaseReferenceCount adds a reference of the blobs, the blobs that are not
+// in use by the client yet are referred in vineyard as well, which keeps them
+// from being evicted until released.
+func (i *IPCClient) IncreaseReferenceCount(ctx context.Context, ids []common.ObjectID) error {
+	if err := i.lock(ctx); err != nil {
+		return err
+	}
+	defer i.unlock()
+	remoteIDs := make([]common.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if usage, ok := i.usages[id]; ok && !usage.local {
+			usage.refCount++
+		} else if !ok {
+			remoteIDs = append(remoteIDs, id)
+		}
+	}
+	if len(remoteIDs) == 0 {
+		return nil
+	}
+	var messageOut string
+	common.WriteIncreaseReferenceCountRequest(remoteIDs, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var increaseReply common.IncreaseReferenceCountReply
+	if err := json.Unmarshal([]byte(messageIn), &increaseReply); err != nil {
+		return err
+	}
+	if increaseReply.Code != 0 || increaseReply.Type != common.INCREASE_REFERENCE_COUNT_REPLY {
+		return common.NewReplyError(increaseReply.Code, increaseReply.Type, increaseReply.Message)
+	}
+	// the payloads are not mapped, thus no store fd is referred
+	for _, id := range remoteIDs {
+		i.addUsage(id, -1, false)
+	}
+	return nil
+}
+
+// addUsage adds a reference of the blob in the shared memory of the store fd.
+func (i *IPCClient) addUsage(id common.ObjectID, storeFd int, local bool) {
+	if i.usages == nil {
+		i.usages = make(map[common.ObjectID]*blobUsage)
+	}
+	usage, ok := i.usages[id]
+	if !ok {
+		usage = &blobUsage{storeFd: storeFd, local: local}
+		i.usages[id] = usage
+		if entry, ok := i.mmapTable[storeFd]; ok {
+			entry.refCount++
+		}
+	}
+	usage.refCount++
+}
+
+// removeUsage removes a reference of the blob, and releases the blob in
+// vineyard if no reference is left. The shared memory in which no blob is in
+// use anymore is unmapped if unmap is set, or stays mapped until the client
+// is disconnected otherwise.
+func (i *IPCClient) removeUsage(id common.ObjectID, unmap bool) error {
+	usage, ok := i.usages[id]
+	if !ok {
+		return common.NewReplyError(common.KObjectNotExists, common.RELEASE_REQUEST,
+			fmt.Sprintf("the blob %s is not in use", common.ObjectIDToString(id)))
+	}
+	usage.refCount--
+	if usage.refCount > 0 {
+		return nil
+	}
+	if unmap {
+		i.deleteUsage(id)
+	} else {
+		// the reference of the shared memory is kept
+		delete(i.usages, id)
+	}
+	if usage.local {
+		return nil
+	}
+	var messageOut string
+	common.WriteReleaseRequest(id, &messageOut)
+	if err := i.DoWrite(messageOut); err != nil {
+		return err
+	}
+	var messageIn string
+	if err := i.DoRead(&messageIn); err != nil {
+		return err
+	}
+	var releaseReply common.ReleaseReply
+	if err := json.Unmarshal([]byte(messageIn), &releaseReply); err != nil {
+		return err
+	}
+	if releaseReply.Code != 0 || releaseReply.Type != common.RELEASE_REPLY {
+		return common.NewReplyError(releaseReply.Code, releaseReply.Type, releaseReply.Message)
+	}
+	return nil
+}
+
+// deleteUsage forgets the blob regardless of its references, and unmaps the
+// shared memory in which no blob is in use anymore.
+func (i *IPCClient) deleteUsage(id common.ObjectID) {
+	usage, ok := i.usages[id]
+	if !ok {
+		return
+	}
+	delete(i.usages, id)
+	i.unrefMmap(usage.storeFd)
+}
+
+// unrefMmap removes a reference of the shared memory of the store fd, and
+// unmaps it if no reference is left.
+func (i *IPCClient) unrefMmap(storeFd int) {
+	entry, ok := i.mmapTable[storeFd]
+	if !ok {
+		return
+	}
+	entry.refCount--
+	if entry.refCount > 0 {
+		return
+	}
+	if err := entry.Unmap(); err != nil {
+		common.GetLogger().Warnf("failed to unmap the shared memory of fd %d: %v", storeFd, err)
+	}
+}
@@ -0,0 +1,403 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+type blob struct {
+	id     common.ObjectID
+	offset int
+	size   int
+	sealed bool
+	// memory is the shared memory of the instance that the blob lives on.
+	memory     *arena
+	instanceID common.InstanceID
+	// spilled is the content of the blob once it is spilled out of the
+	// memory, and pinned blobs are never spilled.
+	spilled []byte
+	pinned  bool
+}
+
+// localLocked tells whether the blob lives on the instance of the server, the
+// empty blob exists on every instance.
+func (s *Server) localLocked(b *blob) bool {
+	return b.size == 0 || b.instanceID == s.options.InstanceID
+}
+
+func (s *Server) createBlobLocked(size int) (*blob, error) {
+	if size == 0 {
+		return s.blobs[common.EmptyBlobID()], nil
+	}
+	offset, ok := s.memory.allocate(size)
+	if !ok {
+		return nil, newStatusError(common.KNotEnoughMemory, "failed to allocate %d bytes", size)
+	}
+	b := &blob{id: s.newIDLocked(true), offset: offset, size: size, memory: s.memory, instanceID: s.options.InstanceID}
+	s.blobs[b.id] = b
+	return b, nil
+}
+
+func (s *Server) deleteBlobLocked(id common.ObjectID) {
+	b, ok := s.blobs[id]
+	if !ok || id == common.EmptyBlobID() {
+		return
+	}
+	delete(s.blobs, id)
+	delete(s.refs, id)
+	if b.spilled == nil {
+		b.memory.release(b.offset, b.size)
+	}
+}
+
+// RefCount returns the number of connections that refer to the blob.
+func (s *Server) RefCount(id common.ObjectID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.refs[id])
+}
+
+// addRefLocked makes the connection refer to the blob, the empty blob is
+// never referred.
+func (s *Server) addRefLocked(c *connection, b *blob) {
+	if b.size == 0 {
+		return
+	}
+	conns, ok := s.refs[b.id]
+	if !ok {
+		conns = make(map[*connection]struct{})
+		s.refs[b.id] = conns
+	}
+	conns[c] = struct{}{}
+}
+
+// releaseAllLocked drops the references of the connection when it is closed.
+func (s *Server) releaseAllLocked(c *connection) {
+	for id, conns := range s.refs {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(s.refs, id)
+		}
+	}
+}
+
+func (s *Server) data(b *blob) []byte {
+	if b.size == 0 {
+		return nil
+	}
+	return b.memory.data[b.offset : b.offset+b.size]
+}
+
+func (s *Server) payload(b *blob) common.CreatedBuffer {
+	if b.size == 0 {
+		return common.CreatedBuffer{ID: b.id, StoreFd: -1, IsSealed: b.sealed, IsOwner: true}
+	}
+	return common.CreatedBuffer{
+		ID:         b.id,
+		StoreFd:    b.memory.fd,
+		DataOffset: b.offset,
+		DataSize:   b.size,
+		MapSize:    b.memory.mapSize(),
+		Pointer:    uint64(b.offset),
+		IsSealed:   b.sealed,
+		IsOwner:    true,
+	}
+}
+
+// fdsToSend returns the store fds of the payloads that haven't been sent over
+// the ipc socket, in order.
+func (c *connection) fdsToSend(payloads ...common.CreatedBuffer) []int {
+	fds := make([]int, 0)
+	if _, ok := c.Conn.(*net.UnixConn); !ok {
+		return fds
+	}
+	for _, payload := range payloads {
+		if payload.DataSize <= 0 || c.fds[payload.StoreFd] {
+			continue
+		}
+		found := false
+		for _, fd := range fds {
+			found = found || fd == payload.StoreFd
+		}
+		if !found {
+			fds = append(fds, payload.StoreFd)
+		}
+	}
+	return fds
+}
+
+// sendFds passes the fds to the client, one fd a message with a single byte,
+// as recv_fd of vineyard expects.
+func (c *connection) sendFds(fds []int) error {
+	for _, fd := range fds {
+		if _, _, err := c.Conn.(*net.UnixConn).WriteMsgUnix([]byte{0}, syscall.UnixRights(fd), nil); err != nil {
+			return err
+		}
+		c.fds[fd] = true
+	}
+	return nil
+}
+
+func (c *connection) createBuffer(request []byte) error {
+	var req common.CreateBufferRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	b, err := s.createBlobLocked(req.Size)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.addRefLocked(c, b)
+	payload := s.payload(b)
+	s.mu.Unlock()
+
+	if err := c.reply(common.CreateBufferReply{Type: common.CREAT_BUFFER_REPLY, ID: b.id, Created: payload}); err != nil {
+		return err
+	}
+	return c.sendFds(c.fdsToSend(payload))
+}
+
+func (c *connection) seal(request []byte) error {
+	var req common.SealRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.blobs[req.ReqObjectID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to seal blob %s", common.ObjectIDToString(req.ReqObjectID))
+	}
+	if b.sealed && b.id != common.EmptyBlobID() {
+		return newStatusError(common.KObjectSealed, "the blob %s has been sealed", common.ObjectIDToString(b.id))
+	}
+	b.sealed = true
+	s.notifyLocked()
+	return c.reply(common.SealReply{Type: common.SEAL_REPLY})
+}
+
+// payloadsLocked returns the payloads of the blobs, the blobs that don't exist
+// on the instance are skipped as vineyardd does.
+func (s *Server) payloadsLocked(ids []common.ObjectID, unsafe bool) ([]*blob, []common.CreatedBuffer, error) {
+	blobs := make([]*blob, 0, len(ids))
+	payloads := make([]common.CreatedBuffer, 0, len(ids))
+	for _, id := range ids {
+		b, ok := s.blobs[id]
+		if !ok || !s.localLocked(b) {
+			continue
+		}
+		if !b.sealed && !unsafe {
+			return nil, nil, newStatusError(common.KObjectNotSealed, "the blob %s hasn't been sealed", common.ObjectIDToString(id))
+		}
+		// the spilled blobs are reloaded once accessed again
+		if err := s.reloadLocked(b); err != nil {
+			return nil, nil, err
+		}
+		blobs = append(blobs, b)
+		payloads = append(payloads, s.payload(b))
+	}
+	return blobs, payloads, nil
+}
+
+func (c *connection) getBuffers(request []byte) error {
+	var req common.GetBuffersRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	blobs, payloads, err := s.payloadsLocked(req.IDs, req.Unsafe)
+	if err == nil {
+		for _, b := range blobs {
+			s.addRefLocked(c, b)
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	fds := c.fdsToSend(payloads...)
+	if err := c.reply(common.GetBuffersReply{
+		Type:     common.GET_BUFFERS_REPLY,
+		Payloads: payloads,
+		Fds:      fds,
+		Num:      len(payloads),
+	}); err != nil {
+		return err
+	}
+	return c.sendFds(fds)
+}
+
+func (c *connection) dropBuffer(request []byte) error {
+	var req common.DropBufferRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[req.ID]; !ok {
+		return newStatusError(common.KObjectNotExists, "failed to drop blob %s", common.ObjectIDToString(req.ID))
+	}
+	s.deleteBlobLocked(req.ID)
+	s.notifyLocked()
+	return c.reply(common.DropBufferReply{Type: common.DROP_BUFFER_REPLY})
+}
+
+func (c *connection) increaseReferenceCount(request []byte) error {
+	var req common.IncreaseReferenceCountRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range req.IDs {
+		if b, ok := s.blobs[id]; ok {
+			s.addRefLocked(c, b)
+		}
+	}
+	return c.reply(common.IncreaseReferenceCountReply{Type: common.INCREASE_REFERENCE_COUNT_REPLY})
+}
+
+func (c *connection) release(request []byte) error {
+	var req common.ReleaseRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := s.refs[req.ObjectID]
+	if _, ok := conns[c]; !ok {
+		return newStatusError(common.KObjectNotExists, "the blob %s is not referred by the connection", common.ObjectIDToString(req.ObjectID))
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(s.refs, req.ObjectID)
+	}
+	return c.reply(common.ReleaseReply{Type: common.RELEASE_REPLY})
+}
+
+// createRemoteBuffer receives the content of the blob after the request, and
+// seals the blob.
+func (c *connection) createRemoteBuffer(request []byte) error {
+	var req common.CreateRemoteBufferRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	b, err := s.createBlobLocked(req.Size)
+	s.mu.Unlock()
+	if err != nil {
+		// the content can't be skipped reliably when compressed, thus the
+		// connection is closed after the error is replied
+		if replyErr := c.fail(err); replyErr != nil {
+			return replyErr
+		}
+		return errors.New("the content of the remote buffer has been discarded")
+	}
+	// the region is owned by the blob, which is invisible until sealed
+	if req.Compress {
+		err = common.RecvCompressed(c, s.data(b))
+	} else {
+		_, err = io.ReadFull(c, s.data(b))
+	}
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	b.sealed = true
+	payload := s.payload(b)
+	s.notifyLocked()
+	s.mu.Unlock()
+	payload.StoreFd = -1
+	return c.reply(common.CreateBufferReply{Type: common.CREAT_BUFFER_REPLY, ID: b.id, Created: payload})
+}
+
+// getRemoteBuffers sends the content of the blobs after the reply.
+func (c *connection) getRemoteBuffers(request []byte) error {
+	var req map[string]json.RawMessage
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	var num int
+	var unsafe, compress bool
+	if err := decodeFields(req, map[string]interface{}{"num": &num, "unsafe": &unsafe, "compress": &compress}); err != nil {
+		return err
+	}
+	ids := make([]common.ObjectID, num)
+	for index := range ids {
+		if err := decode(req[strconv.Itoa(index)], &ids[index]); err != nil {
+			return err
+		}
+	}
+
+	s := c.server
+	s.mu.Lock()
+	blobs, payloads, err := s.payloadsLocked(ids, unsafe)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	buffers := make([][]byte, 0, len(blobs))
+	for index := range payloads {
+		payloads[index].StoreFd = -1
+		buffers = append(buffers, s.data(blobs[index]))
+	}
+	if err := c.reply(common.GetBuffersReply{
+		Type:     common.GET_BUFFERS_REPLY,
+		Payloads: payloads,
+		Num:      len(payloads),
+		Compress: compress,
+	}); err != nil {
+		return err
+	}
+	if compress {
+		return common.SendCompressed(c, buffers...)
+	}
+	for _, buffer := range buffers {
+		if _, err := c.Write(buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeFields decodes the fields of the request that exist.
+func decodeFields(request map[string]json.RawMessage, fields map[string]interface{}) error {
+	for key, value := range fields {
+		if content, ok := request[key]; ok {
+			if err := decode(content, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// kAlignment is the alignment of the blobs in the shared memory.
+const kAlignment = 64
+
+// kMapSizeGap is the trailing size_t of the segment which is left unmapped by
+// the clients, as the allocator of vineyardd keeps its bookkeeping there.
+const kMapSizeGap = 8
+
+type span struct {
+	offset int
+	size   int
+}
+
+// arena is the shared memory of the server, a memfd that is mapped by both
+// the server and the ipc clients, the blobs are allocated from it by a first
+// fit free list.
+type arena struct {
+	fd   int
+	data []byte
+	free []span
+}
+
+func newArena(capacity int) (*arena, error) {
+	capacity = alignUp(capacity)
+	fd, err := unix.MemfdCreate("vineyardtest", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the memfd: %w", err)
+	}
+	if err := unix.Ftruncate(fd, int64(capacity+kMapSizeGap)); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to resize the memfd: %w", err)
+	}
+	data, err := unix.Mmap(fd, 0, capacity+kMapSizeGap, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to mmap the memfd: %w", err)
+	}
+	return &arena{fd: fd, data: data, free: []span{{offset: 0, size: capacity}}}, nil
+}
+
+// mapSize is the size of the segment that the clients map.
+func (a *arena) mapSize() int {
+	return len(a.data)
+}
+
+// allocate returns the offset of a new region of the size, or false if the
+// memory is exhausted.
+func (a *arena) allocate(size int) (int, bool) {
+	size = alignUp(size)
+	for index, region := range a.free {
+		if region.size < size {
+			continue
+		}
+		if region.size == size {
+			a.free = append(a.free[:index], a.free[index+1:]...)
+		} else {
+			a.free[index] = span{offset: region.offset + size, size: region.size - size}
+		}
+		return region.offset, true
+	}
+	return 0, false
+}
+
+// release returns the region to the free list, merging the neighbours.
+func (a *arena) release(offset, size int) {
+	size = alignUp(size)
+	index := sort.Search(len(a.free), func(i int) bool { return a.free[i].offset > offset })
+	a.free = append(a.free, span{})
+	copy(a.free[index+1:], a.free[index:])
+	a.free[index] = span{offset: offset, size: size}
+	if index+1 < len(a.free) && offset+size == a.free[index+1].offset {
+		a.free[index].size += a.free[index+1].size
+		a.free = append(a.free[:index+1], a.free[index+2:]...)
+	}
+	if index > 0 && a.free[index-1].offset+a.free[index-1].size == offset {
+		a.free[index-1].size += a.free[index].size
+		a.free = append(a.free[:index], a.free[index+1:]...)
+	}
+}
+
+// used returns the bytes that have been allocated.
+func (a *arena) used() int {
+	used := len(a.data) - kMapSizeGap
+	for _, region := range a.free {
+		used -= region.size
+	}
+	return used
+}
+
+func (a *arena) close() error {
+	err := unix.Munmap(a.data)
+	if closeErr := unix.Close(a.fd); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func alignUp(size int) int {
+	if size <= 0 {
+		return kAlignment
+	}
+	return (size + kAlignment - 1) / kAlignment * kAlignment
+}
@@ -0,0 +1,59 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"testing"
+)
+
+func TestArena_AllocateRelease(t *testing.T) {
+	memory, err := newArena(4 * kAlignment)
+	if err != nil {
+		t.Fatal("create arena failed", err)
+	}
+	defer memory.close()
+	if memory.mapSize() != 4*kAlignment+kMapSizeGap {
+		t.Error("unexpected map size", memory.mapSize())
+	}
+
+	offsets := make([]int, 0, 4)
+	for index := 0; index < 4; index++ {
+		offset, ok := memory.allocate(1)
+		if !ok {
+			t.Fatal("allocate failed", index)
+		}
+		offsets = append(offsets, offset)
+	}
+	if _, ok := memory.allocate(1); ok {
+		t.Fatal("the arena should be exhausted")
+	}
+
+	// the released regions are merged with the neighbours
+	memory.release(offsets[1], 1)
+	memory.release(offsets[3], 1)
+	memory.release(offsets[2], 1)
+	if len(memory.free) != 1 {
+		t.Fatal("the free regions are not merged", memory.free)
+	}
+	offset, ok := memory.allocate(3 * kAlignment)
+	if !ok || offset != offsets[1] {
+		t.Error("allocate from the merged region failed", offset, ok)
+	}
+	copy(memory.data[offset:], "vineyard")
+	if string(memory.data[offset:offset+8]) != "vineyard" {
+		t.Error("the memory is not writable")
+	}
+}
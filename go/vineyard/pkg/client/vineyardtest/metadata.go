@@ -0,0 +1,512 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// link is a member of a metadata tree which refers to another object, the
+// metadata trees are kept flat and expanded when fetched.
+type link common.ObjectID
+
+// createDataLocked registers the metadata tree as a new object, the members
+// are registered as well unless they exist already.
+func (s *Server) createDataLocked(tree map[string]interface{}) (common.ObjectID, common.Signature, error) {
+	if err := s.registerMembersLocked(tree); err != nil {
+		return common.InvalidObjectID(), common.InvalidSignature(), err
+	}
+	id := s.newIDLocked(false)
+	signature := common.Signature(s.newIDLocked(false))
+	tree["id"] = common.ObjectIDToString(id)
+	tree["signature"] = signature
+	tree["instance_id"] = s.options.InstanceID
+	s.objects[id] = tree
+	return id, signature, nil
+}
+
+func (s *Server) registerMembersLocked(tree map[string]interface{}) error {
+	for key, value := range tree {
+		member, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, err := s.registerMemberLocked(member)
+		if err != nil {
+			return err
+		}
+		tree[key] = link(id)
+	}
+	return nil
+}
+
+func (s *Server) registerMemberLocked(member map[string]interface{}) (common.ObjectID, error) {
+	idString, _ := member["id"].(string)
+	if idString == "" {
+		id, _, err := s.createDataLocked(member)
+		return id, err
+	}
+	id, err := common.ObjectIDFromString(idString)
+	if err != nil {
+		return common.InvalidObjectID(), newStatusError(common.KMetaTreeInvalid, "invalid member id: %s", idString)
+	}
+	if _, ok := s.objects[id]; ok {
+		return id, nil
+	}
+	// the metadata of the local blobs is generated when fetched
+	if _, ok := s.blobs[id]; ok {
+		return id, nil
+	}
+	if _, ok := member["typename"]; !ok {
+		return common.InvalidObjectID(), newStatusError(common.KObjectNotExists, "failed to find the member %s", idString)
+	}
+	if err := s.registerMembersLocked(member); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if _, ok := member["signature"]; !ok {
+		member["signature"] = common.Signature(s.newIDLocked(false))
+	}
+	if _, ok := member["instance_id"]; !ok {
+		member["instance_id"] = s.options.InstanceID
+	}
+	s.objects[id] = member
+	return id, nil
+}
+
+// metaLocked returns the expanded metadata tree of the object.
+func (s *Server) metaLocked(id common.ObjectID) (map[string]interface{}, bool) {
+	if tree, ok := s.objects[id]; ok {
+		result := make(map[string]interface{}, len(tree))
+		for key, value := range tree {
+			if member, ok := value.(link); ok {
+				if result[key], ok = s.metaLocked(common.ObjectID(member)); !ok {
+					return nil, false
+				}
+			} else {
+				result[key] = value
+			}
+		}
+		return result, true
+	}
+	if b, ok := s.blobs[id]; ok && b.sealed {
+		instanceID := b.instanceID
+		if b.size == 0 {
+			instanceID = s.options.InstanceID
+		}
+		return map[string]interface{}{
+			"id":          common.ObjectIDToString(id),
+			"typename":    "vineyard::Blob",
+			"length":      b.size,
+			"nbytes":      b.size,
+			"instance_id": instanceID,
+			"transient":   true,
+		}, true
+	}
+	return nil, false
+}
+
+func (s *Server) existsLocked(id common.ObjectID) bool {
+	_, ok := s.metaLocked(id)
+	return ok
+}
+
+// referencedLocked tells whether the object is a member of other objects.
+func (s *Server) referencedLocked(id common.ObjectID) bool {
+	for _, tree := range s.objects {
+		for _, value := range tree {
+			if member, ok := value.(link); ok && common.ObjectID(member) == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deleteLocked deletes the object, the object that is still referenced is
+// kept unless forced. The members are deleted as well if deep.
+func (s *Server) deleteLocked(id common.ObjectID, force, deep bool) {
+	if !force && s.referencedLocked(id) {
+		return
+	}
+	tree := s.objects[id]
+	delete(s.objects, id)
+	s.deleteBlobLocked(id)
+	if !deep {
+		return
+	}
+	for _, value := range tree {
+		if member, ok := value.(link); ok {
+			s.deleteLocked(common.ObjectID(member), false, deep)
+		}
+	}
+}
+
+func (s *Server) persistLocked(id common.ObjectID) {
+	tree, ok := s.objects[id]
+	if !ok {
+		return
+	}
+	tree["transient"] = false
+	for _, value := range tree {
+		if member, ok := value.(link); ok {
+			s.persistLocked(common.ObjectID(member))
+		}
+	}
+}
+
+// match tells whether the name matches the glob or regular expression.
+func match(pattern string, regex bool, name string) bool {
+	if regex {
+		matched, err := regexp.MatchString("^(?:"+pattern+")$", name)
+		return err == nil && matched
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+func (c *connection) createData(request []byte) error {
+	var req struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(req.Content))
+	decoder.UseNumber()
+	var tree map[string]interface{}
+	if err := decoder.Decode(&tree); err != nil || tree == nil {
+		return newStatusError(common.KMetaTreeInvalid, "malformed metadata: %v", err)
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, signature, err := s.createDataLocked(tree)
+	if err != nil {
+		return err
+	}
+	s.notifyLocked()
+	return c.reply(common.CreateDataReply{
+		Type:       common.CREAT_DATA_REPLY,
+		ID:         id,
+		Signature:  signature,
+		InstanceID: s.options.InstanceID,
+	})
+}
+
+func (c *connection) getData(request []byte) error {
+	var req common.GetDataRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content := make(map[string]json.RawMessage)
+	for _, id := range req.ID {
+		// the whole tree is replied for the invalid object id, which only
+		// consists of the instances here
+		if id == common.InvalidObjectID() {
+			raw, err := json.Marshal(map[string]interface{}{"instances": s.instancesLocked()})
+			if err != nil {
+				return err
+			}
+			content[common.ObjectIDToString(id)] = raw
+			continue
+		}
+		tree, ok := s.metaLocked(id)
+		for !ok && req.Wait {
+			if err := s.waitLocked(); err != nil {
+				return err
+			}
+			tree, ok = s.metaLocked(id)
+		}
+		if !ok {
+			return newStatusError(common.KObjectNotExists, "failed to find the object %s", common.ObjectIDToString(id))
+		}
+		raw, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		content[common.ObjectIDToString(id)] = raw
+	}
+	return c.reply(common.GetDataReply{Type: common.GET_DATA_REPLY, Content: content})
+}
+
+// instancesLocked returns the instances subtree of the metadata.
+func (s *Server) instancesLocked() map[string]interface{} {
+	hostname, _ := os.Hostname()
+	instances := make(map[string]interface{}, len(s.servers))
+	for _, server := range s.servers {
+		instances["i"+strconv.FormatUint(server.options.InstanceID, 10)] = map[string]interface{}{
+			"hostname":     hostname,
+			"nodename":     hostname,
+			"ipc_socket":   server.IPCSocket(),
+			"rpc_endpoint": server.RPCEndpoint(),
+		}
+	}
+	return instances
+}
+
+func (c *connection) listData(request []byte) error {
+	var req common.ListDataRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]common.ObjectID, 0, len(s.objects))
+	for id := range s.objects {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	content := make(map[string]json.RawMessage)
+	for _, id := range ids {
+		if req.Limit > 0 && len(content) >= req.Limit {
+			break
+		}
+		typename, _ := s.objects[id]["typename"].(string)
+		if !match(req.Pattern, req.Regex, typename) {
+			continue
+		}
+		tree, ok := s.metaLocked(id)
+		if !ok {
+			continue
+		}
+		raw, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		content[common.ObjectIDToString(id)] = raw
+	}
+	return c.reply(common.GetDataReply{Type: common.GET_DATA_REPLY, Content: content})
+}
+
+// label merges the labels into the "__labels" of the object, which is a JSON
+// encoded object as vineyardd keeps.
+func (c *connection) label(request []byte) error {
+	var req common.LabelRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	if len(req.Keys) != len(req.Values) {
+		return newStatusError(common.KInvalid, "the numbers of the keys and values of labels don't match")
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tree, ok := s.objects[req.ID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "object %s doesn't exist", common.ObjectIDToString(req.ID))
+	}
+	labels := make(map[string]string)
+	if content, ok := tree["__labels"].(string); ok {
+		if err := json.Unmarshal([]byte(content), &labels); err != nil {
+			return newStatusError(common.KMetaTreeInvalid, "invalid labels: %v", err)
+		}
+	}
+	for index, key := range req.Keys {
+		labels[key] = req.Values[index]
+	}
+	content, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	tree["__labels"] = string(content)
+	s.notifyLocked()
+	return c.reply(common.LabelReply{Type: common.LABEL_REPLY})
+}
+
+func (c *connection) exists(request []byte) error {
+	var req common.ExistsRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c.reply(common.ExistsReply{Type: common.EXISTS_REPLY, Exists: s.existsLocked(req.ID)})
+}
+
+func (c *connection) delData(request []byte) error {
+	var req common.DelDataRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range req.ID {
+		s.deleteLocked(id, req.Force, req.Deep)
+	}
+	s.notifyLocked()
+	return c.reply(common.DelDataReply{Type: common.DEL_DATA_REPLY})
+}
+
+func (c *connection) persist(request []byte) error {
+	var req common.PersistRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.existsLocked(req.ID) {
+		return newStatusError(common.KObjectNotExists, "failed to persist the object %s", common.ObjectIDToString(req.ID))
+	}
+	s.persistLocked(req.ID)
+	return c.reply(common.PersisReply{Type: common.PERSIST_REPLY})
+}
+
+func (c *connection) ifPersist(request []byte) error {
+	var req common.IfPersistRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tree, ok := s.metaLocked(req.ID)
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to find the object %s", common.ObjectIDToString(req.ID))
+	}
+	transient, _ := tree["transient"].(bool)
+	return c.reply(common.IfPersistReply{Type: common.IF_PERSIST_REPLY, Persist: !transient})
+}
+
+func (c *connection) shallowCopy(request []byte) error {
+	var req common.ShallowCopyRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tree, ok := s.objects[req.ID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to copy the object %s", common.ObjectIDToString(req.ID))
+	}
+	target := make(map[string]interface{}, len(tree))
+	for key, value := range tree {
+		target[key] = value
+	}
+	id := s.newIDLocked(false)
+	target["id"] = common.ObjectIDToString(id)
+	target["signature"] = common.Signature(s.newIDLocked(false))
+	target["transient"] = true
+	s.objects[id] = target
+	s.notifyLocked()
+	return c.reply(common.ShallowCopyReply{Type: common.SHALLOW_COPY_REPLY, TargetID: id})
+}
+
+func (c *connection) clear() error {
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects = make(map[common.ObjectID]map[string]interface{})
+	s.names = make(map[string]common.ObjectID)
+	for id, b := range s.blobs {
+		if b.sealed {
+			s.deleteBlobLocked(id)
+		}
+	}
+	s.notifyLocked()
+	return c.reply(common.ClearReply{Type: common.CLEAR_REPLY})
+}
+
+func (c *connection) putName(request []byte) error {
+	var req common.PutNameRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.existsLocked(req.ReqObjectID) {
+		return newStatusError(common.KObjectNotExists, "failed to put name for the object %s",
+			common.ObjectIDToString(req.ReqObjectID))
+	}
+	s.names[req.Name] = req.ReqObjectID
+	s.notifyLocked()
+	return c.reply(common.PutNameReply{Type: common.PUT_NAME_REPLY})
+}
+
+func (c *connection) getName(request []byte) error {
+	var req common.GetNameRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.names[req.Name]
+	for !ok && req.Wait {
+		if err := s.waitLocked(); err != nil {
+			return err
+		}
+		id, ok = s.names[req.Name]
+	}
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to find name %s", req.Name)
+	}
+	return c.reply(common.GetNameReply{Type: common.GET_NAME_REPLY, RepObjectID: id})
+}
+
+func (c *connection) dropName(request []byte) error {
+	var req common.DropNameRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.names, req.Name)
+	s.notifyLocked()
+	return c.reply(common.DropNameReply{Type: common.DROP_NAME_REPLY})
+}
+
+func (c *connection) listName(request []byte) error {
+	var req common.ListNameRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		if match(req.Pattern, req.Regex, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if req.Limit > 0 && len(names) > req.Limit {
+		names = names[:req.Limit]
+	}
+	result := make(map[string]common.ObjectID, len(names))
+	for _, name := range names {
+		result[name] = s.names[name]
+	}
+	return c.reply(common.ListNameReply{Type: common.LIST_NAME_REPLY, Size: len(result), Names: result})
+}
@@ -0,0 +1,546 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vineyardtest provides an in-process fake vineyard server for tests.
+//
+// The server speaks the protocol of vineyardd on a temporary unix socket and a
+// tcp port, and keeps the metadata, names, blobs and streams in memory. The
+// blobs live in a memfd which is passed to the ipc clients over the socket, as
+// vineyardd does, so the ipc clients share the memory with the server.
+//
+//	server := vineyardtest.Start(t, nil)
+//	client, err := vineyard.Connect(vineyardtest.Context(t), server.IPCSocket())
+//
+// Start closes the server when the test completes, NewServer leaves it to the
+// caller. NewCluster and StartCluster start several servers as the instances
+// of a cluster, which share the metadata and names while each instance keeps
+// its own blobs.
+package vineyardtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// kDefaultMemorySize is the capacity of the shared memory if not specified.
+const kDefaultMemorySize = 256 * 1024 * 1024
+
+// Options are the options of the fake server.
+type Options struct {
+	// InstanceID is the id of the vineyard instance, 0 by default.
+	InstanceID common.InstanceID
+	// MemorySize is the capacity of the shared memory for blobs, 256MiB by
+	// default.
+	MemorySize int
+	// Spill enables spilling blobs out of the shared memory, as vineyardd does
+	// when a spill path is given. The spilled content is kept in the memory of
+	// the process.
+	Spill bool
+	// Version is the version of vineyardd that the server replies on
+	// registering, common.VINEYARD_VERSION by default.
+	Version string
+}
+
+// Server is the fake vineyard server, it is safe for concurrent use by any
+// number of clients. The sessions created by clients are servers as well,
+// which are served on their own unix sockets.
+type Server struct {
+	*store
+	options     Options
+	sessionID   common.SessionID
+	dir         string
+	ipcListener net.Listener
+	rpcListener net.Listener
+	memory      *arena
+	// deferred is the number of requests that are waiting for changes.
+	deferred int
+
+	// root is the server of the root session, nil for the root session
+	// itself, which keeps the sessions.
+	root          *Server
+	sessions      map[common.SessionID]*Server
+	nextSessionID common.SessionID
+
+	conns  map[net.Conn]struct{}
+	done   chan struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// store is the state shared by the instances of a cluster, the blobs of all
+// instances are kept in it but are only served by the instance they live on.
+type store struct {
+	mu      sync.Mutex
+	blobs   map[common.ObjectID]*blob
+	objects map[common.ObjectID]map[string]interface{}
+	names   map[string]common.ObjectID
+	streams map[common.ObjectID]*stream
+	// refs are the connections that refer to the blobs, as the dependencies
+	// of vineyardd.
+	refs map[common.ObjectID]map[*connection]struct{}
+	// changed is closed and replaced whenever the objects, names or streams
+	// change, to wake up the requests that are waiting.
+	changed chan struct{}
+	// servers are the instances of the cluster.
+	servers []*Server
+}
+
+func newStore() *store {
+	st := &store{
+		blobs:   make(map[common.ObjectID]*blob),
+		objects: make(map[common.ObjectID]map[string]interface{}),
+		names:   make(map[string]common.ObjectID),
+		streams: make(map[common.ObjectID]*stream),
+		refs:    make(map[common.ObjectID]map[*connection]struct{}),
+		changed: make(chan struct{}),
+	}
+	st.blobs[common.EmptyBlobID()] = &blob{id: common.EmptyBlobID(), sealed: true}
+	return st
+}
+
+// NewServer starts a fake vineyard server listening on a unix socket in a
+// temporary directory and a tcp port on the loopback interface. Nil options
+// mean the defaults.
+func NewServer(options *Options) (*Server, error) {
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+	return startServer(newServer(opts, newStore()))
+}
+
+// NewCluster starts the given number of servers as a cluster, the instance ids
+// of the servers are the one in the options and the following ones.
+func NewCluster(instances int, options *Options) ([]*Server, error) {
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+	st := newStore()
+	servers := make([]*Server, 0, instances)
+	for index := 0; index < instances; index++ {
+		server, err := startServer(newServer(opts, st))
+		if err != nil {
+			for _, server := range servers {
+				server.Close()
+			}
+			return nil, err
+		}
+		servers = append(servers, server)
+		opts.InstanceID++
+	}
+	return servers, nil
+}
+
+// startServer starts listening on a unix socket in a temporary directory and
+// a tcp port on the loopback interface.
+func startServer(s *Server) (*Server, error) {
+	var err error
+	if s.memory, err = newArena(s.options.MemorySize); err != nil {
+		return nil, err
+	}
+	if s.dir, err = os.MkdirTemp("", "vineyardtest"); err != nil {
+		s.memory.close()
+		return nil, err
+	}
+	if s.ipcListener, err = net.Listen("unix", filepath.Join(s.dir, "vineyard.sock")); err != nil {
+		s.cleanup()
+		return nil, err
+	}
+	if s.rpcListener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		s.ipcListener.Close()
+		s.cleanup()
+		return nil, err
+	}
+	s.wg.Add(2)
+	go s.accept(s.ipcListener)
+	go s.accept(s.rpcListener)
+	return s, nil
+}
+
+// newServer initializes a server of the store that isn't listening yet.
+func newServer(options Options, st *store) *Server {
+	s := &Server{
+		store:    st,
+		options:  options,
+		sessions: make(map[common.SessionID]*Server),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+	if s.options.MemorySize <= 0 {
+		s.options.MemorySize = kDefaultMemorySize
+	}
+	if s.options.Version == "" {
+		s.options.Version = common.VINEYARD_VERSION
+	}
+	st.servers = append(st.servers, s)
+	return s
+}
+
+// IPCSocket is the path of the unix socket of the server.
+func (s *Server) IPCSocket() string {
+	return s.ipcListener.Addr().String()
+}
+
+// RPCEndpoint is the "host:port" of the tcp endpoint of the server, the
+// sessions share the endpoint of the root session.
+func (s *Server) RPCEndpoint() string {
+	if s.root != nil {
+		return s.root.RPCEndpoint()
+	}
+	return s.rpcListener.Addr().String()
+}
+
+// SessionID is the id of the session that the server serves.
+func (s *Server) SessionID() common.SessionID {
+	return s.sessionID
+}
+
+// InstanceID is the instance id of the server.
+func (s *Server) InstanceID() common.InstanceID {
+	return s.options.InstanceID
+}
+
+// Close stops the server, closes the connections and releases the shared
+// memory. The memory that has been mapped by the clients stays valid. The
+// sessions are closed along with the root session.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for conn := range s.conns {
+		conn.Close()
+	}
+	sessions := make([]*Server, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	var err error
+	for _, session := range sessions {
+		if closeErr := session.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	s.ipcListener.Close()
+	if s.rpcListener != nil {
+		s.rpcListener.Close()
+	}
+	s.wg.Wait()
+	if cleanupErr := s.cleanup(); err == nil {
+		err = cleanupErr
+	}
+	return err
+}
+
+// cleanup releases the shared memory, and removes the directory of the
+// sockets unless it's a session, whose socket is in the directory of the root
+// session.
+func (s *Server) cleanup() error {
+	err := s.memory.close()
+	if s.root != nil {
+		return err
+	}
+	if removeErr := os.RemoveAll(s.dir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+func (s *Server) accept(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(&connection{Conn: conn, server: s, fds: make(map[int]bool)})
+	}
+}
+
+func (s *Server) serve(c *connection) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c.Conn)
+		s.releaseAllLocked(c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		request, err := common.ReadMessage(c, 0)
+		if err != nil {
+			return
+		}
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(request, &header); err != nil {
+			return
+		}
+		if header.Type == common.EXIT_REQUEST {
+			return
+		}
+		if err := c.handle(header.Type, request); err != nil {
+			return
+		}
+	}
+}
+
+// connection is a client connection to the server, the store fds that have been sent
+// over the connection are tracked as the clients keep the received fds.
+type connection struct {
+	net.Conn
+	server *Server
+	fds    map[int]bool
+}
+
+// errServerClosed is returned to the requests that are waiting when the
+// server is closed, the connection is closed without a reply then.
+var errServerClosed = errors.New("the server has been closed")
+
+// statusError is an error replied to the client.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func newStatusError(code int, format string, args ...interface{}) error {
+	return &statusError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (c *connection) handle(requestType string, request []byte) error {
+	var err error
+	switch requestType {
+	case common.REGISTER_REQUEST:
+		err = c.register(request)
+	case common.CREAT_BUFFER_REQUEST:
+		err = c.createBuffer(request)
+	case common.SEAL_REQUEST:
+		err = c.seal(request)
+	case common.GET_BUFFERS_REQUEST:
+		err = c.getBuffers(request)
+	case common.DROP_BUFFER_REQUEST:
+		err = c.dropBuffer(request)
+	case common.INCREASE_REFERENCE_COUNT_REQUEST:
+		err = c.increaseReferenceCount(request)
+	case common.RELEASE_REQUEST:
+		err = c.release(request)
+	case common.INSTANCE_STATUS_REQUEST:
+		err = c.instanceStatus()
+	case common.NEW_SESSION_REQUEST:
+		err = c.newSession(request)
+	case common.DELETE_SESSION_REQUEST:
+		err = c.deleteSession()
+	case common.CREATE_REMOTE_BUFFER_REQUEST:
+		err = c.createRemoteBuffer(request)
+	case common.GET_REMOTE_BUFFERS_REQUEST:
+		err = c.getRemoteBuffers(request)
+	case common.CREAT_DATA_REQUEST:
+		err = c.createData(request)
+	case common.GET_DATA_REQUEST:
+		err = c.getData(request)
+	case common.LABEL_REQUEST:
+		err = c.label(request)
+	case common.EVICT_REQUEST:
+		err = c.evict(request)
+	case common.LOAD_REQUEST:
+		err = c.load(request)
+	case common.UNPIN_REQUEST:
+		err = c.unpin(request)
+	case common.IS_SPILLED_REQUEST:
+		err = c.isSpilled(request)
+	case common.IS_IN_USE_REQUEST:
+		err = c.isInUse(request)
+	case common.LIST_DATA_REQUEST:
+		err = c.listData(request)
+	case common.EXISTS_REQUEST:
+		err = c.exists(request)
+	case common.DEL_DATA_REQUEST:
+		err = c.delData(request)
+	case common.PERSIST_REQUEST:
+		err = c.persist(request)
+	case common.IF_PERSIST_REQUEST:
+		err = c.ifPersist(request)
+	case common.SHALLOW_COPY_REQUEST:
+		err = c.shallowCopy(request)
+	case common.CLEAR_REQUEST:
+		err = c.clear()
+	case common.PUT_NAME_REQUEST:
+		err = c.putName(request)
+	case common.GET_NAME_REQUEST:
+		err = c.getName(request)
+	case common.DROP_NAME_REQUEST:
+		err = c.dropName(request)
+	case common.LIST_NAME_REQUEST:
+		err = c.listName(request)
+	case common.CREATE_STREAM_REQUEST:
+		err = c.createStream(request)
+	case common.OPEN_STREAM_REQUEST:
+		err = c.openStream(request)
+	case common.GET_NEXT_STREAM_CHUNK_REQUEST:
+		err = c.getNextStreamChunk(request)
+	case common.PUSH_NEXT_STREAM_CHUNK_REQUEST:
+		err = c.pushNextStreamChunk(request)
+	case common.PULL_NEXT_STREAM_CHUNK_REQUEST:
+		err = c.pullNextStreamChunk(request)
+	case common.STOP_STREAM_REQUEST:
+		err = c.stopStream(request)
+	case common.DROP_STREAM_REQUEST:
+		err = c.dropStream(request)
+	default:
+		err = newStatusError(common.KNotImplemented, "unsupported command: %s", requestType)
+	}
+	return c.fail(err)
+}
+
+// fail replies the status error to the client, other errors are returned as
+// is and close the connection.
+func (c *connection) fail(err error) error {
+	var status *statusError
+	if errors.As(err, &status) {
+		// the error replies of vineyardd carry no type
+		return c.reply(map[string]interface{}{"code": status.code, "message": status.message})
+	}
+	return err
+}
+
+// register replies the socket of the requested session, the root session id
+// means the session of the server itself.
+func (c *connection) register(request []byte) error {
+	var req common.RegisterRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	if req.SessionID != common.RootSessionID() && req.SessionID != s.sessionID {
+		var err error
+		if s, err = c.server.session(req.SessionID); err != nil {
+			return err
+		}
+	}
+	return c.reply(common.RegisterReply{
+		Type:        common.REGISTER_REPLY,
+		InstanceID:  int(s.options.InstanceID),
+		IPCSocket:   s.IPCSocket(),
+		RPCEndpoint: s.RPCEndpoint(),
+		SessionID:   s.sessionID,
+		Version:     s.options.Version,
+	})
+}
+
+func (c *connection) instanceStatus() error {
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := common.InstanceStatus{
+		InstanceID:       s.options.InstanceID,
+		Deployment:       "local",
+		MemoryUsage:      uint64(s.memory.used()),
+		MemoryLimit:      uint64(s.memory.mapSize() - kMapSizeGap),
+		DeferredRequests: uint64(s.deferred),
+	}
+	for conn := range s.conns {
+		if _, ok := conn.(*net.UnixConn); ok {
+			status.IPCConnections++
+		} else {
+			status.RPCConnections++
+		}
+	}
+	return c.reply(common.InstanceStatusReply{Type: common.INSTANCE_STATUS_REPLY, Meta: status})
+}
+
+func (c *connection) reply(reply interface{}) error {
+	content, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	return common.WriteMessage(c, content, 0)
+}
+
+// decode decodes the request, the malformed request is replied as an error.
+func decode(request []byte, v interface{}) error {
+	if err := json.Unmarshal(request, v); err != nil {
+		return newStatusError(common.KInvalid, "malformed request: %v", err)
+	}
+	return nil
+}
+
+// notifyLocked wakes up the requests that are waiting for changes.
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// waitLocked waits until something is changed, the lock is released while
+// waiting.
+func (s *Server) waitLocked() error {
+	changed := s.changed
+	s.deferred++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.deferred--
+	}()
+	select {
+	case <-changed:
+		return nil
+	case <-s.done:
+		return errServerClosed
+	}
+}
+
+// newIDLocked generates a new object id, or a blob id if blob is true. The ids
+// are random as vineyardd generates them with rdtsc, regardless of the
+// instance and the address of the blob.
+func (s *Server) newIDLocked(blob bool) common.ObjectID {
+	for {
+		id := common.GenerateObjectID()
+		if blob {
+			id = common.GenerateBlobID()
+		}
+		_, isBlob := s.blobs[id]
+		_, isObject := s.objects[id]
+		_, isStream := s.streams[id]
+		if !isBlob && !isObject && !isStream {
+			return id
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"net"
+
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// rootServer returns the server of the root session, which keeps the
+// sessions.
+func (s *Server) rootServer() *Server {
+	if s.root != nil {
+		return s.root
+	}
+	return s
+}
+
+// session returns the server of the session.
+func (s *Server) session(id common.SessionID) (*Server, error) {
+	root := s.rootServer()
+	if id == root.sessionID {
+		return root, nil
+	}
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	session, ok := root.sessions[id]
+	if !ok {
+		return nil, newStatusError(common.KInvalid, "the session %s does not exist", common.SessionIDToString(id))
+	}
+	return session, nil
+}
+
+// newSessionLocked starts a session on the socket next to the one of the root
+// session, as vineyardd does, the session has its own shared memory.
+func (s *Server) newSessionLocked() (*Server, error) {
+	if s.closed {
+		return nil, errServerClosed
+	}
+	s.nextSessionID++
+	session := newServer(s.options, newStore())
+	session.sessionID = s.nextSessionID
+	session.root = s
+	session.dir = s.dir
+
+	var err error
+	if session.memory, err = newArena(session.options.MemorySize); err != nil {
+		return nil, newStatusError(common.KNotEnoughMemory, "failed to create the session: %v", err)
+	}
+	socket := s.IPCSocket() + "." + common.SessionIDToString(session.sessionID)
+	if session.ipcListener, err = net.Listen("unix", socket); err != nil {
+		session.cleanup()
+		return nil, newStatusError(common.KIOError, "failed to create the session: %v", err)
+	}
+	s.sessions[session.sessionID] = session
+	session.wg.Add(1)
+	go session.accept(session.ipcListener)
+	return session, nil
+}
+
+func (c *connection) newSession(request []byte) error {
+	var req common.NewSessionRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	if req.BulkStoreType != common.DEFAULT_STORE_TYPE {
+		return newStatusError(common.KInvalid, "unsupported bulk store type: %s", req.BulkStoreType)
+	}
+	root := c.server.rootServer()
+	root.mu.Lock()
+	session, err := root.newSessionLocked()
+	root.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.reply(common.NewSessionReply{Type: common.NEW_SESSION_REPLY, SocketPath: session.IPCSocket()})
+}
+
+// deleteSession closes the session after replying, which closes the
+// connections to the session as well.
+func (c *connection) deleteSession() error {
+	s := c.server
+	if s.root == nil {
+		return newStatusError(common.KInvalid, "the root session cannot be deleted")
+	}
+	s.root.mu.Lock()
+	delete(s.root.sessions, s.sessionID)
+	s.root.mu.Unlock()
+	if err := c.reply(common.DeleteSessionReply{Type: common.DELETE_SESSION_REPLY}); err != nil {
+		return err
+	}
+	// the connection is served by the session, thus it can't wait here
+	go s.Close()
+	return nil
+}
@@ -0,0 +1,163 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// localBlobsLocked collects the local blobs that the objects refer to, the
+// objects that don't exist are skipped as vineyardd does.
+func (s *Server) localBlobsLocked(ids []common.ObjectID) []*blob {
+	blobs := make([]*blob, 0)
+	visited := make(map[common.ObjectID]bool)
+	var traverse func(id common.ObjectID)
+	traverse = func(id common.ObjectID) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		if b, ok := s.blobs[id]; ok {
+			if b.size > 0 && b.sealed && s.localLocked(b) {
+				blobs = append(blobs, b)
+			}
+			return
+		}
+		for _, value := range s.objects[id] {
+			if member, ok := value.(link); ok {
+				traverse(common.ObjectID(member))
+			}
+		}
+	}
+	for _, id := range ids {
+		traverse(id)
+	}
+	return blobs
+}
+
+// inUseLocked tells whether the blob is in use, i.e., it is not a candidate to
+// be spilled. Like vineyardd, the blobs that are unknown are in use.
+func (s *Server) inUseLocked(id common.ObjectID) bool {
+	b, ok := s.blobs[id]
+	if !ok || b.size == 0 || !b.sealed || !s.localLocked(b) {
+		return true
+	}
+	return len(s.refs[id]) > 0
+}
+
+// spillLocked moves the content of the blob out of the shared memory. Unlike
+// vineyardd, the blobs in use are never spilled, as the clients of the fake
+// server keep reading the shared memory.
+func (s *Server) spillLocked(b *blob) {
+	if b.spilled != nil || b.pinned || s.inUseLocked(b.id) {
+		return
+	}
+	b.spilled = append([]byte(nil), s.data(b)...)
+	b.memory.release(b.offset, b.size)
+}
+
+// reloadLocked moves the content of the spilled blob back to the shared
+// memory.
+func (s *Server) reloadLocked(b *blob) error {
+	if b.spilled == nil {
+		return nil
+	}
+	offset, ok := b.memory.allocate(b.size)
+	if !ok {
+		return newStatusError(common.KNotEnoughMemory, "failed to reload the blob %s", common.ObjectIDToString(b.id))
+	}
+	b.offset = offset
+	copy(s.data(b), b.spilled)
+	b.spilled = nil
+	return nil
+}
+
+func (c *connection) evict(request []byte) error {
+	var req common.EvictRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	if !s.options.Spill {
+		return newStatusError(common.KInvalid, "Spill path is not set")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.localBlobsLocked(req.IDs) {
+		s.spillLocked(b)
+	}
+	return c.reply(common.EvictReply{Type: common.EVICT_REPLY})
+}
+
+func (c *connection) load(request []byte) error {
+	var req common.LoadRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	// loading is bypassed if spilling is not enabled
+	if !s.options.Spill {
+		return c.reply(common.LoadReply{Type: common.LOAD_REPLY})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.localBlobsLocked(req.IDs) {
+		if req.Pin {
+			b.pinned = true
+		}
+		if err := s.reloadLocked(b); err != nil {
+			return err
+		}
+	}
+	return c.reply(common.LoadReply{Type: common.LOAD_REPLY})
+}
+
+func (c *connection) unpin(request []byte) error {
+	var req common.UnpinRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.localBlobsLocked(req.IDs) {
+		b.pinned = false
+	}
+	return c.reply(common.UnpinReply{Type: common.UNPIN_REPLY})
+}
+
+func (c *connection) isSpilled(request []byte) error {
+	var req common.IsSpilledRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.blobs[req.ID]
+	return c.reply(common.IsSpilledReply{Type: common.IS_SPILLED_REPLY, IsSpilled: ok && b.spilled != nil})
+}
+
+func (c *connection) isInUse(request []byte) error {
+	var req common.IsInUseRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c.reply(common.IsInUseReply{Type: common.IS_IN_USE_REPLY, IsInUse: s.inUseLocked(req.ID)})
+}
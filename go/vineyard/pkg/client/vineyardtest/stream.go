@@ -0,0 +1,240 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// stream follows the stream store of vineyardd: the writer gets chunks from
+// the server or pushes the chunks it created, and the reader pulls the chunks
+// one by one, the chunk that has been read is deleted on the next pull.
+type stream struct {
+	openMark int64
+	ready    []common.ObjectID
+	writing  common.ObjectID
+	reading  common.ObjectID
+	drained  bool
+	failed   bool
+}
+
+func (st *stream) stopped() bool {
+	return st.drained || st.failed
+}
+
+// sealWritingLocked makes the chunk being written ready to read.
+func (s *Server) sealWritingLocked(st *stream) {
+	if st.writing == common.InvalidObjectID() {
+		return
+	}
+	if b, ok := s.blobs[st.writing]; ok {
+		b.sealed = true
+	}
+	st.ready = append(st.ready, st.writing)
+	st.writing = common.InvalidObjectID()
+}
+
+func (s *Server) deleteChunkLocked(chunk common.ObjectID) {
+	if common.IsBlob(chunk) {
+		s.deleteBlobLocked(chunk)
+	} else {
+		s.deleteLocked(chunk, false, true)
+	}
+}
+
+func (c *connection) createStream(request []byte) error {
+	var req common.CreateStreamRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.streams[req.ObjectID]; ok {
+		return newStatusError(common.KObjectExists, "the stream %s exists", common.ObjectIDToString(req.ObjectID))
+	}
+	s.streams[req.ObjectID] = &stream{writing: common.InvalidObjectID(), reading: common.InvalidObjectID()}
+	return c.reply(common.StreamReply{Type: common.CREATE_STREAM_REPLY})
+}
+
+func (c *connection) openStream(request []byte) error {
+	var req common.OpenStreamRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[req.ObjectID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "stream cannot be open: %s", common.ObjectIDToString(req.ObjectID))
+	}
+	if st.openMark&req.Mode != 0 {
+		return newStatusError(common.KStreamOpened, "the stream has been opened")
+	}
+	st.openMark |= req.Mode
+	return c.reply(common.StreamReply{Type: common.OPEN_STREAM_REPLY})
+}
+
+func (c *connection) getNextStreamChunk(request []byte) error {
+	var req common.GetNextStreamChunkRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	st, ok := s.streams[req.ID]
+	if !ok {
+		s.mu.Unlock()
+		return newStatusError(common.KObjectNotExists, "failed to allocate from stream")
+	}
+	if st.stopped() {
+		s.mu.Unlock()
+		return newStatusError(common.KInvalidStreamState, "the stream has been stopped")
+	}
+	s.sealWritingLocked(st)
+	s.notifyLocked()
+	b, err := s.createBlobLocked(req.Size)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	st.writing = b.id
+	payload := s.payload(b)
+	s.mu.Unlock()
+
+	fds := c.fdsToSend(payload)
+	fd := -1
+	if len(fds) > 0 {
+		fd = fds[0]
+	}
+	if err := c.reply(common.GetNextStreamChunkReply{
+		Type:   common.GET_NEXT_STREAM_CHUNK_REPLY,
+		Buffer: payload,
+		Fd:     fd,
+	}); err != nil {
+		return err
+	}
+	return c.sendFds(fds)
+}
+
+func (c *connection) pushNextStreamChunk(request []byte) error {
+	var req common.PushNextStreamChunkRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[req.ID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to push to stream")
+	}
+	if st.stopped() {
+		return newStatusError(common.KInvalidStreamState, "the stream has been stopped")
+	}
+	st.ready = append(st.ready, req.Chunk)
+	s.notifyLocked()
+	return c.reply(common.StreamReply{Type: common.PUSH_NEXT_STREAM_CHUNK_REPLY})
+}
+
+// pullNextStreamChunk waits until a chunk is ready or the stream is stopped.
+func (c *connection) pullNextStreamChunk(request []byte) error {
+	var req common.PullNextStreamChunkRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[req.ID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to pull from stream")
+	}
+	if st.reading != common.InvalidObjectID() {
+		s.deleteChunkLocked(st.reading)
+		st.reading = common.InvalidObjectID()
+	}
+	for len(st.ready) == 0 {
+		if st.drained {
+			return newStatusError(common.KStreamDrained, "the stream has been drained")
+		}
+		if st.failed {
+			return newStatusError(common.KStreamFailed, "the stream has failed")
+		}
+		if err := s.waitLocked(); err != nil {
+			return err
+		}
+		// the stream has been dropped while waiting
+		if st, ok = s.streams[req.ID]; !ok {
+			return newStatusError(common.KStreamFailed, "the stream has been dropped")
+		}
+	}
+	st.reading = st.ready[0]
+	st.ready = st.ready[1:]
+	return c.reply(common.PullNextStreamChunkReply{Type: common.PULL_NEXT_STREAM_CHUNK_REPLY, Chunk: st.reading})
+}
+
+func (c *connection) stopStream(request []byte) error {
+	var req common.StopStreamRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[req.ID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to stop stream: %s", common.ObjectIDToString(req.ID))
+	}
+	if st.stopped() {
+		return newStatusError(common.KInvalidStreamState, "Stream already stopped")
+	}
+	s.sealWritingLocked(st)
+	if req.Failed {
+		st.failed = true
+	} else {
+		st.drained = true
+	}
+	s.notifyLocked()
+	return c.reply(common.StreamReply{Type: common.STOP_STREAM_REPLY})
+}
+
+// dropStream fails the stream and drops the chunks that haven't been read, the
+// chunk being read is kept for the reader.
+func (c *connection) dropStream(request []byte) error {
+	var req common.DropStreamRequest
+	if err := decode(request, &req); err != nil {
+		return err
+	}
+	s := c.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[req.ID]
+	if !ok {
+		return newStatusError(common.KObjectNotExists, "failed to drop stream: %s", common.ObjectIDToString(req.ID))
+	}
+	if !st.stopped() {
+		st.failed = true
+	}
+	for _, chunk := range st.ready {
+		s.deleteChunkLocked(chunk)
+	}
+	st.ready = nil
+	delete(s.streams, req.ID)
+	s.notifyLocked()
+	return c.reply(common.StreamReply{Type: common.DROP_STREAM_REPLY})
+}
@@ -0,0 +1,67 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vineyardtest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// kTestTimeout is the time limit of the requests of a test, see Context.
+const kTestTimeout = 10 * time.Second
+
+// Start starts a fake server for the test, the server is closed when the test
+// and its subtests complete. Nil options mean the defaults.
+func Start(t testing.TB, options *Options) *Server {
+	t.Helper()
+	server, err := NewServer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := server.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return server
+}
+
+// StartCluster starts a cluster of fake servers for the test, the servers are
+// closed when the test and its subtests complete.
+func StartCluster(t testing.TB, instances int, options *Options) []*Server {
+	t.Helper()
+	servers, err := NewCluster(instances, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, server := range servers {
+			if err := server.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	return servers
+}
+
+// Context returns the context for the requests of the test, which times out
+// after 10 seconds and is canceled when the test completes.
+func Context(t testing.TB) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), kTestTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
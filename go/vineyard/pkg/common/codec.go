@@ -0,0 +1,128 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	// MESSAGE_HEADER_SIZE is the size of the header of messages, i.e., the
+	// length of the message as a 64-bit little endian integer on every
+	// platform, as vineyardd expects.
+	MESSAGE_HEADER_SIZE = 8
+
+	// DEFAULT_MAX_MESSAGE_SIZE is the default limit of the size of messages,
+	// a header beyond the limit is most likely garbage on the connection.
+	DEFAULT_MAX_MESSAGE_SIZE = 256 << 20
+
+	// kCodecBufferSize is the size of the read buffer of the codec.
+	kCodecBufferSize = 64 << 10
+)
+
+// ErrMessageTooLarge is returned when the size of a message exceeds the limit.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// WriteMessage writes the header and the message in a single write.
+func WriteMessage(w io.Writer, message []byte, maxSize int) error {
+	if maxSize > 0 && len(message) > maxSize {
+		return fmt.Errorf("%w: the size of the message is %d bytes, while the limit is %d bytes",
+			ErrMessageTooLarge, len(message), maxSize)
+	}
+	buffer := make([]byte, MESSAGE_HEADER_SIZE+len(message))
+	binary.LittleEndian.PutUint64(buffer, uint64(len(message)))
+	copy(buffer[MESSAGE_HEADER_SIZE:], message)
+	_, err := w.Write(buffer)
+	return err
+}
+
+// ReadMessage reads a message, the message is not read if its size exceeds
+// the limit, which leaves the stream in the middle of the message.
+func ReadMessage(r io.Reader, maxSize int) ([]byte, error) {
+	var header [MESSAGE_HEADER_SIZE]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint64(header[:])
+	if maxSize > 0 && size > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: the size of the message is %d bytes, while the limit is %d bytes",
+			ErrMessageTooLarge, size, maxSize)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// Codec frames the messages on a connection to vineyard. The reads are
+// buffered, except on unix sockets where the fds are sent along with the
+// replies, as reading ahead would consume the byte that carries the fds.
+//
+// The codec is also the reader of the raw content that follows a reply, e.g.,
+// the payloads of remote blobs, which may have been buffered already.
+type Codec struct {
+	conn    net.Conn
+	reader  io.Reader
+	maxSize int
+}
+
+// NewCodec creates the codec of the connection, a non-positive max size means
+// DEFAULT_MAX_MESSAGE_SIZE.
+func NewCodec(conn net.Conn, maxSize int) *Codec {
+	if maxSize <= 0 {
+		maxSize = DEFAULT_MAX_MESSAGE_SIZE
+	}
+	codec := &Codec{conn: conn, reader: conn, maxSize: maxSize}
+	if _, ok := conn.(*net.UnixConn); !ok {
+		codec.reader = bufio.NewReaderSize(conn, kCodecBufferSize)
+	}
+	return codec
+}
+
+// MaxMessageSize returns the limit of the size of messages.
+func (c *Codec) MaxMessageSize() int {
+	return c.maxSize
+}
+
+// Read reads the raw content from the connection.
+func (c *Codec) Read(data []byte) (int, error) {
+	return c.reader.Read(data)
+}
+
+// Write writes the raw content to the connection.
+func (c *Codec) Write(data []byte) (int, error) {
+	return c.conn.Write(data)
+}
+
+// WriteMessage writes a message to the connection, nothing is written if the
+// message is too large.
+func (c *Codec) WriteMessage(message []byte) error {
+	return WriteMessage(c.conn, message, c.maxSize)
+}
+
+// ReadMessage reads a message from the connection.
+func (c *Codec) ReadMessage() ([]byte, error) {
+	return ReadMessage(c.reader, c.maxSize)
+}
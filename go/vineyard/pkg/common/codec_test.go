@@ -0,0 +1,104 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestWriteMessage(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteMessage(&buffer, []byte("hello"), 0); err != nil {
+		t.Fatal("write message failed", err)
+	}
+	expected := []byte{5, 0, 0, 0, 0, 0, 0, 0, 'h', 'e', 'l', 'l', 'o'}
+	if !bytes.Equal(buffer.Bytes(), expected) {
+		t.Error("the header should be 8 bytes in little endian", buffer.Bytes())
+	}
+
+	buffer.Reset()
+	if err := WriteMessage(&buffer, []byte("hello"), 4); !errors.Is(err, ErrMessageTooLarge) {
+		t.Error("expect the message to be too large", err)
+	}
+	if buffer.Len() != 0 {
+		t.Error("nothing should be written for a message that is too large")
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	var buffer bytes.Buffer
+	for _, message := range []string{"hello", "", "world"} {
+		if err := WriteMessage(&buffer, []byte(message), 0); err != nil {
+			t.Fatal("write message failed", err)
+		}
+	}
+	for _, expected := range []string{"hello", "", "world"} {
+		message, err := ReadMessage(&buffer, 16)
+		if err != nil || string(message) != expected {
+			t.Errorf("expect %q, got %q: %v", expected, message, err)
+		}
+	}
+	if _, err := ReadMessage(&buffer, 16); err != io.EOF {
+		t.Error("expect the end of stream", err)
+	}
+
+	_ = WriteMessage(&buffer, []byte("a message that is too large"), 0)
+	if _, err := ReadMessage(&buffer, 16); !errors.Is(err, ErrMessageTooLarge) {
+		t.Error("expect the message to be too large", err)
+	}
+
+	truncated := bytes.NewReader([]byte{5, 0, 0, 0, 0, 0, 0, 0, 'h', 'e'})
+	if _, err := ReadMessage(truncated, 0); err != io.ErrUnexpectedEOF {
+		t.Error("expect the truncated message to be an unexpected eof", err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	codec := NewCodec(local, 0)
+	if codec.MaxMessageSize() != DEFAULT_MAX_MESSAGE_SIZE {
+		t.Error("unexpected max message size", codec.MaxMessageSize())
+	}
+
+	// the raw content that follows the message is read through the codec
+	go func() {
+		var buffer bytes.Buffer
+		_ = WriteMessage(&buffer, []byte("reply"), 0)
+		buffer.WriteString("payload")
+		_, _ = remote.Write(buffer.Bytes())
+	}()
+	message, err := codec.ReadMessage()
+	if err != nil || string(message) != "reply" {
+		t.Fatalf("unexpected message %q: %v", message, err)
+	}
+	payload := make([]byte, len("payload"))
+	if _, err := io.ReadFull(codec, payload); err != nil || string(payload) != "payload" {
+		t.Errorf("unexpected payload %q: %v", payload, err)
+	}
+
+	go func() {
+		_ = codec.WriteMessage([]byte("request"))
+	}()
+	if message, err := ReadMessage(remote, 0); err != nil || string(message) != "request" {
+		t.Errorf("unexpected request %q: %v", message, err)
+	}
+}
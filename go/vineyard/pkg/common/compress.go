@@ -0,0 +1,131 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// kCompressChunkSize bounds the compressed chunks that are sent to the
+// server, which reads each chunk into a buffer of ZSTD_CStreamOutSize().
+const kCompressChunkSize = 128 * 1024
+
+// The compressed content of remote buffers is a single zstd stream shared by
+// all buffers in a request, framed as chunks of
+//
+//	[size_t chunk_size][chunk_size bytes of compressed data]
+//
+// the stream is flushed at the end of each buffer but never ended, so the
+// receiver stops reading once it has decompressed the expected bytes.
+
+// chunkWriter frames the compressed data into chunks.
+type chunkWriter struct {
+	w io.Writer
+}
+
+func (w *chunkWriter) Write(data []byte) (int, error) {
+	written := 0
+	header := make([]byte, 8)
+	for written < len(data) {
+		size := len(data) - written
+		if size > kCompressChunkSize {
+			size = kCompressChunkSize
+		}
+		binary.LittleEndian.PutUint64(header, uint64(size))
+		if _, err := w.w.Write(header); err != nil {
+			return written, err
+		}
+		if _, err := w.w.Write(data[written : written+size]); err != nil {
+			return written, err
+		}
+		written += size
+	}
+	return written, nil
+}
+
+// chunkReader reads the compressed data from the chunks, it never reads
+// beyond the chunk that the decompressor is asking for.
+type chunkReader struct {
+	r         io.Reader
+	remaining int
+}
+
+func (r *chunkReader) Read(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	for r.remaining == 0 {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r.r, header); err != nil {
+			return 0, err
+		}
+		r.remaining = int(binary.LittleEndian.Uint64(header))
+	}
+	size := len(data)
+	if size > r.remaining {
+		size = r.remaining
+	}
+	if _, err := io.ReadFull(r.r, data[:size]); err != nil {
+		return 0, err
+	}
+	r.remaining -= size
+	return size, nil
+}
+
+// SendCompressed compresses the buffers into the connection, as the content
+// of remote buffers.
+func SendCompressed(w io.Writer, buffers ...[]byte) error {
+	// the encoder is never closed, as closing ends the zstd frame
+	encoder, err := zstd.NewWriter(&chunkWriter{w: w}, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	for _, buffer := range buffers {
+		if len(buffer) == 0 {
+			continue
+		}
+		if _, err := encoder.Write(buffer); err != nil {
+			return err
+		}
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecvCompressed fills the buffers with the decompressed content of remote
+// buffers from the connection. The decoder must be synchronous, as a decoder
+// reading ahead would consume the messages that follow the buffers.
+func RecvCompressed(r io.Reader, buffers ...[]byte) error {
+	decoder, err := zstd.NewReader(&chunkReader{r: r}, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+	for _, buffer := range buffers {
+		if len(buffer) == 0 {
+			continue
+		}
+		if _, err := io.ReadFull(decoder, buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
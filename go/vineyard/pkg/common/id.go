@@ -16,8 +16,12 @@ limitations under the License.
 package common
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,8 +31,22 @@ func ObjectIDToString(id ObjectID) string {
 	return fmt.Sprintf("o%016x", id)
 }
 
+// ObjectIDFromString parses the id in the form of ObjectIDToString, i.e., "o"
+// followed by the id in hex.
 func ObjectIDFromString(id string) (ObjectID, error) {
-	return strconv.ParseUint(id[1:], 16, 64)
+	return parseID(id, 'o', "object id")
+}
+
+// parseID parses the id in hex after the prefix.
+func parseID(id string, prefix byte, kind string) (uint64, error) {
+	if len(id) < 2 || id[0] != prefix {
+		return 0, fmt.Errorf("invalid %s %q: expect '%c' followed by hex digits", kind, id, prefix)
+	}
+	value, err := strconv.ParseUint(id[1:], 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", kind, id, err)
+	}
+	return value, nil
 }
 
 func IsBlob(id ObjectID) bool {
@@ -39,6 +57,19 @@ func InvalidObjectID() ObjectID {
 	return 0xffffffffffffffff
 }
 
+// EmptyBlobID is the id of the blob with no payload, which exists on every
+// vineyard instance.
+func EmptyBlobID() ObjectID {
+	return 0x8000000000000000
+}
+
+// PlaceholderBlobID is the id that stands for a blob which is not created
+// yet. As in vineyard, it shares the bits with InvalidObjectID and is never
+// generated for a real blob.
+func PlaceholderBlobID() ObjectID {
+	return 0xffffffffffffffff
+}
+
 type Signature = uint64
 
 func SignatureToString(sig Signature) string {
@@ -46,7 +77,7 @@ func SignatureToString(sig Signature) string {
 }
 
 func SignatureFromString(sig string) (Signature, error) {
-	return strconv.ParseUint(sig[1:], 16, 64)
+	return parseID(sig, 's', "signature")
 }
 
 func InvalidSignature() Signature {
@@ -55,11 +86,93 @@ func InvalidSignature() Signature {
 
 type InstanceID = uint64
 
+// SessionID is the id of a session of vineyard, the objects and names in a
+// session are isolated from other sessions.
+type SessionID = int64
+
+func SessionIDToString(id SessionID) string {
+	return fmt.Sprintf("S%016x", uint64(id))
+}
+
+// RootSessionID is the id of the default session, which vineyard starts with.
+func RootSessionID() SessionID {
+	return 0
+}
+
 func UnspecifiedInstanceID() InstanceID {
 	return 0xffffffffffffffff
 }
 
+// ObjectIDGenerator generates the ids of objects as vineyard does with rdtsc,
+// the ids take the full 63 bits below the blob bit. The counter is the
+// nanoseconds of the monotonic clock shifted by a random offset of the
+// generator, which is strictly increasing across the calls, and keeps the
+// generators of different processes from colliding.
+//
+// The ids carry no bits of the instance, as the ids of vineyardd don't (see
+// GenerateObjectID in src/common/util/uuid.h). Instance bits in the ids of
+// the client wouldn't keep them from colliding with the ids that vineyardd
+// generates, and would take bits from the counter.
+type ObjectIDGenerator struct {
+	// last is the last value of the counter, it is the first field to be
+	// aligned for the atomic operations on 32-bit platforms.
+	last   uint64
+	offset uint64
+}
+
+// kCounterBase pins the counter to the monotonic clock, the wall clock may
+// step backwards.
+var kCounterBase = time.Now()
+
+// NewObjectIDGenerator creates a generator with a random offset.
+func NewObjectIDGenerator() *ObjectIDGenerator {
+	offset := randomOffset()
+	return &ObjectIDGenerator{last: offset, offset: offset}
+}
+
+// randomOffset returns a random number, or one from the time and the pid if
+// the system has no randomness to offer.
+func randomOffset() uint64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return uint64(time.Now().UnixNano()) ^ uint64(os.Getpid())<<32
+	}
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// Generate returns a new id, it is safe for concurrent use.
+func (g *ObjectIDGenerator) Generate() ObjectID {
+	now := g.offset + uint64(time.Since(kCounterBase))
+	for {
+		last := atomic.LoadUint64(&g.last)
+		next := now
+		// the counter is compared in the order of wrapping around at 2^64,
+		// which keeps the low 63 bits unique as well
+		if next-last-1 >= 1<<63 {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&g.last, last, next) {
+			return next &^ EmptyBlobID()
+		}
+	}
+}
+
+var defaultObjectIDGenerator = NewObjectIDGenerator()
+
+// GenerateObjectID generates the id of a non-blob object, see also
+// ObjectIDGenerator.
 func GenerateObjectID() ObjectID {
-	// TODO: check c++ version's rdtsc instead of time.Now() in golang
-	return ObjectID(0x7FFFFFFFFFFFFFFF & time.Now().Unix())
+	return defaultObjectIDGenerator.Generate()
+}
+
+// GenerateBlobID generates the id of a blob as vineyardd does, which is
+// unrelated to the address of the blob and never EmptyBlobID or
+// PlaceholderBlobID.
+func GenerateBlobID() ObjectID {
+	for {
+		id := defaultObjectIDGenerator.Generate() | EmptyBlobID()
+		if id != EmptyBlobID() && id != PlaceholderBlobID() {
+			return id
+		}
+	}
 }
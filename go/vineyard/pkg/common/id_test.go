@@ -16,6 +16,7 @@ limitations under the License.
 package common
 
 import (
+	"sync"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -26,6 +27,66 @@ func TestObjectID(t *testing.T) {
 	var o, _ = ObjectIDFromString(s)
 	assert.Equal(t, s, "o00000000000004d2")
 	assert.Equal(t, o, uint64(1234))
+
+	for _, invalid := range []string{"", "o", "00000000000004d2", "s00000000000004d2", "o0000000000004dx", "o100000000000004d2"} {
+		_, err := ObjectIDFromString(invalid)
+		assert.Assert(t, err != nil, "expect %q to be invalid", invalid)
+	}
+}
+
+func TestBlobID(t *testing.T) {
+	assert.Assert(t, IsBlob(EmptyBlobID()))
+	assert.Assert(t, IsBlob(PlaceholderBlobID()))
+	assert.Assert(t, !IsBlob(GenerateObjectID()))
+	assert.Equal(t, ObjectIDToString(EmptyBlobID()), "o8000000000000000")
+	first, second := GenerateBlobID(), GenerateBlobID()
+	assert.Assert(t, IsBlob(first) && IsBlob(second) && first != second)
+	assert.Assert(t, first != EmptyBlobID() && first != PlaceholderBlobID())
+}
+
+func TestGenerateObjectID(t *testing.T) {
+	const goroutines, count = 8, 1000
+	ids := make(chan ObjectID, goroutines*count)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				ids <- GenerateObjectID()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[ObjectID]bool, goroutines*count)
+	for id := range ids {
+		assert.Assert(t, !seen[id], "duplicated id %s", ObjectIDToString(id))
+		assert.Assert(t, !IsBlob(id))
+		seen[id] = true
+	}
+
+	// the generators of different processes start from random offsets
+	first, second := NewObjectIDGenerator(), NewObjectIDGenerator()
+	a, b := first.Generate(), second.Generate()
+	assert.Assert(t, a != b)
+	assert.Assert(t, !IsBlob(a) && !IsBlob(b))
+	assert.Assert(t, first.Generate() != a)
+
+	// the ids stay unique when the counter wraps around
+	var generator ObjectIDGenerator
+	generator.last = 1<<64 - 2
+	generator.offset = 1<<64 - 1<<62
+	ids = make(chan ObjectID, 4)
+	for i := 0; i < cap(ids); i++ {
+		ids <- generator.Generate()
+	}
+	close(ids)
+	seen = make(map[ObjectID]bool)
+	for id := range ids {
+		assert.Assert(t, !seen[id] && !IsBlob(id), "duplicated id %s", ObjectIDToString(id))
+		seen[id] = true
+	}
 }
 
 func TestSignature(t *testing.T) {
@@ -33,4 +94,7 @@ func TestSignature(t *testing.T) {
 	var o, _ = SignatureFromString(s)
 	assert.Equal(t, s, "s00000000000004d2")
 	assert.Equal(t, o, uint64(1234))
+
+	_, err := SignatureFromString(ObjectIDToString(1234))
+	assert.Assert(t, err != nil)
 }
@@ -0,0 +1,93 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// Logger is the logger of the vineyard client, it could be replaced by
+// SetLogger to route the logs to the logger of the application.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// stdLogger writes the logs to a standard logger.
+type stdLogger struct {
+	logger *log.Logger
+	debug  bool
+}
+
+// NewStdLogger returns the logger that writes to the standard logger, the
+// debug logs are dropped unless debug is set.
+func NewStdLogger(logger *log.Logger, debug bool) Logger {
+	return &stdLogger{logger: logger, debug: debug}
+}
+
+func (l *stdLogger) Debugf(format string, args ...interface{}) {
+	if l.debug {
+		l.logger.Printf("DEBUG "+format, args...)
+	}
+}
+
+func (l *stdLogger) Infof(format string, args ...interface{}) {
+	l.logger.Printf("INFO "+format, args...)
+}
+
+func (l *stdLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Printf("WARN "+format, args...)
+}
+
+func (l *stdLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Printf("ERROR "+format, args...)
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Debugf(format string, args ...interface{}) {}
+func (discardLogger) Infof(format string, args ...interface{})  {}
+func (discardLogger) Warnf(format string, args ...interface{})  {}
+func (discardLogger) Errorf(format string, args ...interface{}) {}
+
+// loggerHolder keeps the loggers of different types in the atomic value.
+type loggerHolder struct {
+	Logger
+}
+
+var logger atomic.Value
+
+func init() {
+	SetLogger(NewStdLogger(log.New(os.Stderr, "vineyard: ", log.LstdFlags), false))
+}
+
+// SetLogger replaces the logger of the vineyard client, a nil logger discards
+// all logs.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discardLogger{}
+	}
+	logger.Store(loggerHolder{l})
+}
+
+// GetLogger returns the logger of the vineyard client.
+func GetLogger() Logger {
+	return logger.Load().(loggerHolder).Logger
+}
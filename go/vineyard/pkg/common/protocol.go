@@ -17,7 +17,8 @@ package common
 
 import (
 	"encoding/json"
-	"fmt"
+	"sort"
+	"strconv"
 )
 
 const (
@@ -25,6 +26,7 @@ const (
 	REGISTER_REPLY         = "register_reply"
 	EXIT_REQUEST           = "exit_request"
 	PERSIST_REQUEST        = "persist_request"
+	PERSIST_REPLY          = "persist_reply"
 	PUT_NAME_REQUEST       = "put_name_request"
 	PUT_NAME_REPLY         = "put_name_reply"
 	GET_NAME_REQUEST       = "get_name_request"
@@ -32,21 +34,107 @@ const (
 	DROP_NAME_REQUEST      = "drop_name_request"
 	DROP_NAME_REPLY        = "drop_name_reply"
 	CREAT_BUFFER_REQUEST   = "create_buffer_request"
+	CREAT_BUFFER_REPLY     = "create_buffer_reply"
+	SEAL_REQUEST           = "seal_request"
+	SEAL_REPLY             = "seal_reply"
+	DROP_BUFFER_REQUEST    = "drop_buffer_request"
+	DROP_BUFFER_REPLY      = "drop_buffer_reply"
+	GET_BUFFERS_REQUEST    = "get_buffers_request"
+	GET_BUFFERS_REPLY      = "get_buffers_reply"
+	GET_DATA_REQUEST       = "get_data_request"
+	GET_DATA_REPLY         = "get_data_reply"
 	CREAT_DATA_REQUEST     = "create_data_request"
+	CREAT_DATA_REPLY       = "create_data_reply"
+	LIST_DATA_REQUEST      = "list_data_request"
+	EXISTS_REQUEST         = "exists_request"
+	EXISTS_REPLY           = "exists_reply"
+	DEL_DATA_REQUEST       = "del_data_request"
+	DEL_DATA_REPLY         = "del_data_reply"
+	IF_PERSIST_REQUEST     = "if_persist_request"
+	IF_PERSIST_REPLY       = "if_persist_reply"
+	SHALLOW_COPY_REQUEST   = "shallow_copy_request"
+	SHALLOW_COPY_REPLY     = "shallow_copy_reply"
+	LIST_NAME_REQUEST      = "list_name_request"
+	LIST_NAME_REPLY        = "list_name_reply"
+	CLEAR_REQUEST          = "clear_request"
+	CLEAR_REPLY            = "clear_reply"
+	LABEL_REQUEST          = "label_request"
+	LABEL_REPLY            = "label_reply"
+	EVICT_REQUEST          = "evict_request"
+	EVICT_REPLY            = "evict_reply"
+	LOAD_REQUEST           = "load_request"
+	LOAD_REPLY             = "load_reply"
+	UNPIN_REQUEST          = "unpin_request"
+	UNPIN_REPLY            = "unpin_reply"
+	IS_SPILLED_REQUEST     = "is_spilled_request"
+	IS_SPILLED_REPLY       = "is_spilled_reply"
+	IS_IN_USE_REQUEST      = "is_in_use_request"
+	IS_IN_USE_REPLY        = "is_in_use_reply"
 	DEFAULT_SERVER_VERSION = "0.0.0"
+
+	// stream
+	CREATE_STREAM_REQUEST          = "create_stream_request"
+	CREATE_STREAM_REPLY            = "create_stream_reply"
+	OPEN_STREAM_REQUEST            = "open_stream_request"
+	OPEN_STREAM_REPLY              = "open_stream_reply"
+	GET_NEXT_STREAM_CHUNK_REQUEST  = "get_next_stream_chunk_request"
+	GET_NEXT_STREAM_CHUNK_REPLY    = "get_next_stream_chunk_reply"
+	PUSH_NEXT_STREAM_CHUNK_REQUEST = "push_next_stream_chunk_request"
+	PUSH_NEXT_STREAM_CHUNK_REPLY   = "push_next_stream_chunk_reply"
+	PULL_NEXT_STREAM_CHUNK_REQUEST = "pull_next_stream_chunk_request"
+	PULL_NEXT_STREAM_CHUNK_REPLY   = "pull_next_stream_chunk_reply"
+	STOP_STREAM_REQUEST            = "stop_stream_request"
+	STOP_STREAM_REPLY              = "stop_stream_reply"
+	DROP_STREAM_REQUEST            = "drop_stream_request"
+	DROP_STREAM_REPLY              = "drop_stream_reply"
+
+	// remote buffers
+	CREATE_REMOTE_BUFFER_REQUEST = "create_remote_buffer_request"
+	GET_REMOTE_BUFFERS_REQUEST   = "get_remote_buffers_request"
+)
+
+// reference count
+const (
+	INCREASE_REFERENCE_COUNT_REQUEST = "increase_reference_count_request"
+	INCREASE_REFERENCE_COUNT_REPLY   = "increase_reference_count_reply"
+	RELEASE_REQUEST                  = "release_request"
+	RELEASE_REPLY                    = "release_reply"
+)
+
+// introspection
+const (
+	INSTANCE_STATUS_REQUEST = "instance_status_request"
+	INSTANCE_STATUS_REPLY   = "instance_status_reply"
+)
+
+// session
+const (
+	NEW_SESSION_REQUEST    = "new_session_request"
+	NEW_SESSION_REPLY      = "new_session_reply"
+	DELETE_SESSION_REQUEST = "delete_session_request"
+	DELETE_SESSION_REPLY   = "delete_session_reply"
+
+	// DEFAULT_STORE_TYPE is the type of the bulk store of a session that
+	// keeps blobs in the shared memory.
+	DEFAULT_STORE_TYPE = "Normal"
 )
 
 type RegisterRequest struct {
-	Type    string `json:"type"`
-	Version string `json:"version"`
+	Type      string    `json:"type"`
+	Version   string    `json:"version"`
+	StoreType string    `json:"store_type"`
+	SessionID SessionID `json:"session_id"`
 }
 
 type RegisterReply struct {
-	InstanceID  int    `json:"instance_id"`
-	IPCSocket   string `json:"ipc_socket"`
-	RPCEndpoint string `json:"rpc_endpoint"`
-	Type        string `json:"type"`
-	Version     string `json:"version,omitempty"`
+	InstanceID  int       `json:"instance_id"`
+	IPCSocket   string    `json:"ipc_socket"`
+	RPCEndpoint string    `json:"rpc_endpoint"`
+	SessionID   SessionID `json:"session_id"`
+	Type        string    `json:"type"`
+	Code        int       `json:"code"`
+	Message     string    `json:"message"`
+	Version     string    `json:"version,omitempty"`
 }
 
 type ExitRequest struct {
@@ -59,8 +147,9 @@ type PersistRequest struct {
 }
 
 type PersisReply struct {
-	Type string `json:"type"`
-	Code int    `json:"code"`
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type PutNameRequest struct {
@@ -76,13 +165,15 @@ type GetNameRequest struct {
 }
 
 type PutNameReply struct {
-	Type string `json:"type"`
-	Code int    `json:"code"`
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type GetNameReply struct {
 	Type        string   `json:"type"`
 	Code        int      `json:"code"`
+	Message     string   `json:"message"`
 	RepObjectID ObjectID `json:"object_id"`
 }
 
@@ -92,8 +183,9 @@ type DropNameRequest struct {
 }
 
 type DropNameReply struct {
-	Type string `json:"type"`
-	Code int    `json:"code"`
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type CreateBufferRequest struct {
@@ -103,6 +195,8 @@ type CreateBufferRequest struct {
 
 type CreateBufferReply struct {
 	Type    string        `json:"type"`
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
 	ID      ObjectID      `json:"id"`
 	Created CreatedBuffer `json:"created"`
 }
@@ -113,18 +207,66 @@ type CreatedBuffer struct {
 	MapSize    int      `json:"map_size"`
 	ID         ObjectID `json:"object_id"`
 	StoreFd    int      `json:"store_fd"`
+	Pointer    uint64   `json:"pointer"`
+	IsSealed   bool     `json:"is_sealed"`
+	IsOwner    bool     `json:"is_owner"`
+}
+
+type SealRequest struct {
+	Type        string   `json:"type"`
+	ReqObjectID ObjectID `json:"object_id"`
+}
+
+type SealReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type DropBufferRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type DropBufferReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type GetBuffersRequest struct {
+	Type   string     `json:"type"`
+	IDs    []ObjectID `json:"ids"`
+	Num    int        `json:"num"`
+	Unsafe bool       `json:"unsafe"`
+}
+
+// GetBuffersReply carries the payloads of the requested blobs, and the store
+// fds that will be sent after the reply, which the client hasn't received yet.
+type GetBuffersReply struct {
+	Type     string          `json:"type"`
+	Code     int             `json:"code"`
+	Message  string          `json:"message"`
+	Payloads []CreatedBuffer `json:"payloads"`
+	Fds      []int           `json:"fds"`
+	Num      int             `json:"num"`
+	Compress bool            `json:"compress"`
 }
 
 type GetDataRequest struct {
-	Type       int      `json:"type"`
-	ID         ObjectID `json:"id"`
-	SyncRemote bool     `json:"sync_remote"`
-	Wait       bool     `json:"wait"`
+	Type       string     `json:"type"`
+	ID         []ObjectID `json:"id"`
+	SyncRemote bool       `json:"sync_remote"`
+	Wait       bool       `json:"wait"`
 }
 
+// GetDataReply keeps the metadata trees undecoded, keyed by the object id
+// string, as the trees may contain integers that don't fit into a float64.
 type GetDataReply struct {
-	Type    string      `json:"type"`
-	Content interface{} `json:"content"`
+	Type    string                     `json:"type"`
+	Code    int                        `json:"code"`
+	Message string                     `json:"message"`
+	Content map[string]json.RawMessage `json:"content"`
 }
 
 type CreateDataRequest struct {
@@ -133,10 +275,321 @@ type CreateDataRequest struct {
 }
 
 type CreateDataReply struct {
-	Type       string   `json:"type"`
-	ID         ObjectID `json:"id"`
-	Signature  `json:"signature"`
-	InstanceID `json:"instance_id"`
+	Type       string     `json:"type"`
+	Code       int        `json:"code"`
+	Message    string     `json:"message"`
+	ID         ObjectID   `json:"id"`
+	Signature  Signature  `json:"signature"`
+	InstanceID InstanceID `json:"instance_id"`
+}
+
+// ListDataRequest lists the objects whose typename matches the pattern, the
+// reply is a GetDataReply.
+type ListDataRequest struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex"`
+	Limit   int    `json:"limit"`
+}
+
+type ExistsRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type ExistsReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Exists  bool   `json:"exists"`
+}
+
+type DelDataRequest struct {
+	Type     string     `json:"type"`
+	ID       []ObjectID `json:"id"`
+	Force    bool       `json:"force"`
+	Deep     bool       `json:"deep"`
+	Fastpath bool       `json:"fastpath"`
+}
+
+type DelDataReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type IfPersistRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type IfPersistReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Persist bool   `json:"persist"`
+}
+
+type ShallowCopyRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type ShallowCopyReply struct {
+	Type     string   `json:"type"`
+	Code     int      `json:"code"`
+	Message  string   `json:"message"`
+	TargetID ObjectID `json:"target_id"`
+}
+
+type ListNameRequest struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex"`
+	Limit   int    `json:"limit"`
+}
+
+type ListNameReply struct {
+	Type    string              `json:"type"`
+	Code    int                 `json:"code"`
+	Message string              `json:"message"`
+	Size    int                 `json:"size"`
+	Names   map[string]ObjectID `json:"names"`
+}
+
+type ClearRequest struct {
+	Type string `json:"type"`
+}
+
+type ClearReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LabelRequest attaches the labels to the object, i.e., the values at the same
+// positions of the keys, the existing labels of the keys are overwritten.
+type LabelRequest struct {
+	Type   string   `json:"type"`
+	ID     ObjectID `json:"id"`
+	Keys   []string `json:"keys"`
+	Values []string `json:"values"`
+}
+
+type LabelReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// EvictRequest spills the local blobs of the objects to the disk, except the
+// pinned ones.
+type EvictRequest struct {
+	Type string     `json:"type"`
+	IDs  []ObjectID `json:"ids"`
+}
+
+type EvictReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LoadRequest reloads the spilled blobs of the objects into the memory, and
+// pins them to not be spilled again if pin is set.
+type LoadRequest struct {
+	Type string     `json:"type"`
+	IDs  []ObjectID `json:"ids"`
+	Pin  bool       `json:"pin"`
+}
+
+type LoadReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type UnpinRequest struct {
+	Type string     `json:"type"`
+	IDs  []ObjectID `json:"ids"`
+}
+
+type UnpinReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type IsSpilledRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type IsSpilledReply struct {
+	Type      string `json:"type"`
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	IsSpilled bool   `json:"is_spilled"`
+}
+
+type IsInUseRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type IsInUseReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	IsInUse bool   `json:"is_in_use"`
+}
+
+type CreateStreamRequest struct {
+	Type     string   `json:"type"`
+	ObjectID ObjectID `json:"object_id"`
+}
+
+type OpenStreamRequest struct {
+	Type     string   `json:"type"`
+	ObjectID ObjectID `json:"object_id"`
+	Mode     int64    `json:"mode"`
+}
+
+// StreamReply is the reply of the stream requests that carry no result.
+type StreamReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type GetNextStreamChunkRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+	Size int      `json:"size"`
+}
+
+// GetNextStreamChunkReply carries the payload of the chunk allocated by the
+// server, the store fd is sent after the reply if the fd is not -1.
+type GetNextStreamChunkReply struct {
+	Type    string        `json:"type"`
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Buffer  CreatedBuffer `json:"buffer"`
+	Fd      int           `json:"fd"`
+}
+
+type PushNextStreamChunkRequest struct {
+	Type  string   `json:"type"`
+	ID    ObjectID `json:"id"`
+	Chunk ObjectID `json:"chunk"`
+}
+
+type PullNextStreamChunkRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+type PullNextStreamChunkReply struct {
+	Type    string   `json:"type"`
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Chunk   ObjectID `json:"chunk"`
+}
+
+type StopStreamRequest struct {
+	Type   string   `json:"type"`
+	ID     ObjectID `json:"id"`
+	Failed bool     `json:"failed"`
+}
+
+type DropStreamRequest struct {
+	Type string   `json:"type"`
+	ID   ObjectID `json:"id"`
+}
+
+// CreateRemoteBufferRequest is followed by the content of the buffer, and
+// the server replies a create_buffer_reply after the content is received.
+type CreateRemoteBufferRequest struct {
+	Type     string `json:"type"`
+	Size     int    `json:"size"`
+	Compress bool   `json:"compress"`
+}
+
+// IncreaseReferenceCountRequest adds the blobs to the ones that are in use by
+// the connection.
+type IncreaseReferenceCountRequest struct {
+	Type string     `json:"type"`
+	IDs  []ObjectID `json:"ids"`
+}
+
+type IncreaseReferenceCountReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ReleaseRequest tells the server that the blob is no longer in use by the
+// connection.
+type ReleaseRequest struct {
+	Type     string   `json:"type"`
+	ObjectID ObjectID `json:"object_id"`
+}
+
+type ReleaseReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type InstanceStatusRequest struct {
+	Type string `json:"type"`
+}
+
+// InstanceStatus is the status of a vineyard instance.
+type InstanceStatus struct {
+	InstanceID InstanceID `json:"instance_id"`
+	Deployment string     `json:"deployment"`
+	// MemoryUsage and MemoryLimit are the bytes of the shared memory that
+	// are in use and in total.
+	MemoryUsage uint64 `json:"memory_usage"`
+	MemoryLimit uint64 `json:"memory_limit"`
+	// DeferredRequests is the number of requests that are waiting, e.g.,
+	// for an object that doesn't exist yet.
+	DeferredRequests uint64 `json:"deferred_requests"`
+	IPCConnections   int    `json:"ipc_connections"`
+	RPCConnections   int    `json:"rpc_connections"`
+}
+
+type InstanceStatusReply struct {
+	Type    string         `json:"type"`
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+	Meta    InstanceStatus `json:"meta"`
+}
+
+// NewSessionRequest creates a new session of vineyard, which has its own
+// objects, names and blobs, and is served on its own ipc socket.
+type NewSessionRequest struct {
+	Type          string `json:"type"`
+	BulkStoreType string `json:"bulk_store_type"`
+}
+
+type NewSessionReply struct {
+	Type       string `json:"type"`
+	SocketPath string `json:"socket_path"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+}
+
+// DeleteSessionRequest deletes the session that the connection belongs to.
+type DeleteSessionRequest struct {
+	Type string `json:"type"`
+}
+
+type DeleteSessionReply struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 func encodeMsg(data interface{}, msg *string) error {
@@ -148,13 +601,15 @@ func encodeMsg(data interface{}, msg *string) error {
 	return nil
 }
 
-func WriteRegisterRequest(msg *string) {
+func WriteRegisterRequest(sessionID SessionID, msg *string) {
 	var register RegisterRequest
 	register.Type = REGISTER_REQUEST
-	register.Version = "0.2.4"
+	register.Version = VINEYARD_VERSION
+	register.StoreType = DEFAULT_STORE_TYPE
+	register.SessionID = sessionID
 
 	if err := encodeMsg(register, msg); err != nil {
-		fmt.Println("WriteRegisterRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteRegisterRequest failed: %v", err)
 	}
 }
 
@@ -163,7 +618,7 @@ func WriteExitRequest(msg *string) {
 	exit.Type = EXIT_REQUEST
 
 	if err := encodeMsg(exit, msg); err != nil {
-		fmt.Println("WriteExitRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteExitRequest failed: %v", err)
 	}
 }
 
@@ -173,7 +628,7 @@ func WritePersistRequest(id ObjectID, msg *string) {
 	persist.ID = id
 
 	if err := encodeMsg(persist, msg); err != nil {
-		fmt.Println("WritePersistRequest failed: ", err.Error())
+		GetLogger().Errorf("WritePersistRequest failed: %v", err)
 	}
 }
 
@@ -184,7 +639,7 @@ func WritePutNameRequest(id ObjectID, name string, msg *string) {
 	putNameReq.Name = name
 
 	if err := encodeMsg(putNameReq, msg); err != nil {
-		fmt.Println("WritePutNameRequest failed: ", err.Error())
+		GetLogger().Errorf("WritePutNameRequest failed: %v", err)
 	}
 }
 
@@ -195,7 +650,7 @@ func WriteGetNameRequest(name string, wait bool, msg *string) {
 	getNameReq.Wait = wait
 
 	if err := encodeMsg(getNameReq, msg); err != nil {
-		fmt.Println("WriteGetNameRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteGetNameRequest failed: %v", err)
 	}
 }
 
@@ -205,7 +660,7 @@ func WriteDropNameRequest(name string, msg *string) {
 	dropNameReq.Name = name
 
 	if err := encodeMsg(dropNameReq, msg); err != nil {
-		fmt.Println("WriteDropNameRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteDropNameRequest failed: %v", err)
 	}
 }
 
@@ -215,18 +670,51 @@ func WriteCreateBufferRequest(size int, msg *string) {
 	createBufferReq.Size = size
 
 	if err := encodeMsg(createBufferReq, msg); err != nil {
-		fmt.Println("WriteCreateBufferRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteCreateBufferRequest failed: %v", err)
+	}
+}
+
+func WriteSealRequest(id ObjectID, msg *string) {
+	var sealReq SealRequest
+	sealReq.Type = SEAL_REQUEST
+	sealReq.ReqObjectID = id
+
+	if err := encodeMsg(sealReq, msg); err != nil {
+		GetLogger().Errorf("WriteSealRequest failed: %v", err)
+	}
+}
+
+func WriteDropBufferRequest(id ObjectID, msg *string) {
+	var dropBufferReq DropBufferRequest
+	dropBufferReq.Type = DROP_BUFFER_REQUEST
+	dropBufferReq.ID = id
+
+	if err := encodeMsg(dropBufferReq, msg); err != nil {
+		GetLogger().Errorf("WriteDropBufferRequest failed: %v", err)
+	}
+}
+
+func WriteGetBuffersRequest(ids []ObjectID, unsafe bool, msg *string) {
+	var getBuffersReq GetBuffersRequest
+	getBuffersReq.Type = GET_BUFFERS_REQUEST
+	getBuffersReq.IDs = ids
+	getBuffersReq.Num = len(ids)
+	getBuffersReq.Unsafe = unsafe
+
+	if err := encodeMsg(getBuffersReq, msg); err != nil {
+		GetLogger().Errorf("WriteGetBuffersRequest failed: %v", err)
 	}
 }
 
 func WriteGetDataRequest(id ObjectID, syncRemote bool, wait bool, msg *string) {
 	var getDataReq GetDataRequest
-	getDataReq.ID = id
+	getDataReq.Type = GET_DATA_REQUEST
+	getDataReq.ID = []ObjectID{id}
 	getDataReq.SyncRemote = syncRemote
 	getDataReq.Wait = wait
 
 	if err := encodeMsg(getDataReq, msg); err != nil {
-		fmt.Println("WriteGetDataRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteGetDataRequest failed: %v", err)
 	}
 }
 
@@ -236,6 +724,301 @@ func WriteCreateDataRequest(content interface{}, msg *string) {
 	createDataReq.Content = content
 
 	if err := encodeMsg(createDataReq, msg); err != nil {
-		fmt.Println("WriteCreateDataRequest failed: ", err.Error())
+		GetLogger().Errorf("WriteCreateDataRequest failed: %v", err)
+	}
+}
+
+func WriteListDataRequest(pattern string, regex bool, limit int, msg *string) {
+	var listDataReq ListDataRequest
+	listDataReq.Type = LIST_DATA_REQUEST
+	listDataReq.Pattern = pattern
+	listDataReq.Regex = regex
+	listDataReq.Limit = limit
+
+	if err := encodeMsg(listDataReq, msg); err != nil {
+		GetLogger().Errorf("WriteListDataRequest failed: %v", err)
+	}
+}
+
+func WriteExistsRequest(id ObjectID, msg *string) {
+	var existsReq ExistsRequest
+	existsReq.Type = EXISTS_REQUEST
+	existsReq.ID = id
+
+	if err := encodeMsg(existsReq, msg); err != nil {
+		GetLogger().Errorf("WriteExistsRequest failed: %v", err)
+	}
+}
+
+func WriteDelDataRequest(ids []ObjectID, force bool, deep bool, msg *string) {
+	var delDataReq DelDataRequest
+	delDataReq.Type = DEL_DATA_REQUEST
+	delDataReq.ID = ids
+	delDataReq.Force = force
+	delDataReq.Deep = deep
+
+	if err := encodeMsg(delDataReq, msg); err != nil {
+		GetLogger().Errorf("WriteDelDataRequest failed: %v", err)
+	}
+}
+
+func WriteIfPersistRequest(id ObjectID, msg *string) {
+	var ifPersistReq IfPersistRequest
+	ifPersistReq.Type = IF_PERSIST_REQUEST
+	ifPersistReq.ID = id
+
+	if err := encodeMsg(ifPersistReq, msg); err != nil {
+		GetLogger().Errorf("WriteIfPersistRequest failed: %v", err)
+	}
+}
+
+func WriteShallowCopyRequest(id ObjectID, msg *string) {
+	var shallowCopyReq ShallowCopyRequest
+	shallowCopyReq.Type = SHALLOW_COPY_REQUEST
+	shallowCopyReq.ID = id
+
+	if err := encodeMsg(shallowCopyReq, msg); err != nil {
+		GetLogger().Errorf("WriteShallowCopyRequest failed: %v", err)
+	}
+}
+
+func WriteListNameRequest(pattern string, regex bool, limit int, msg *string) {
+	var listNameReq ListNameRequest
+	listNameReq.Type = LIST_NAME_REQUEST
+	listNameReq.Pattern = pattern
+	listNameReq.Regex = regex
+	listNameReq.Limit = limit
+
+	if err := encodeMsg(listNameReq, msg); err != nil {
+		GetLogger().Errorf("WriteListNameRequest failed: %v", err)
+	}
+}
+
+func WriteClearRequest(msg *string) {
+	var clearReq ClearRequest
+	clearReq.Type = CLEAR_REQUEST
+
+	if err := encodeMsg(clearReq, msg); err != nil {
+		GetLogger().Errorf("WriteClearRequest failed: %v", err)
+	}
+}
+
+func WriteLabelRequest(id ObjectID, labels map[string]string, msg *string) {
+	var labelReq LabelRequest
+	labelReq.Type = LABEL_REQUEST
+	labelReq.ID = id
+	labelReq.Keys = make([]string, 0, len(labels))
+	for key := range labels {
+		labelReq.Keys = append(labelReq.Keys, key)
+	}
+	sort.Strings(labelReq.Keys)
+	labelReq.Values = make([]string, 0, len(labels))
+	for _, key := range labelReq.Keys {
+		labelReq.Values = append(labelReq.Values, labels[key])
+	}
+
+	if err := encodeMsg(labelReq, msg); err != nil {
+		GetLogger().Errorf("WriteLabelRequest failed: %v", err)
+	}
+}
+
+func WriteEvictRequest(ids []ObjectID, msg *string) {
+	var evictReq EvictRequest
+	evictReq.Type = EVICT_REQUEST
+	evictReq.IDs = ids
+
+	if err := encodeMsg(evictReq, msg); err != nil {
+		GetLogger().Errorf("WriteEvictRequest failed: %v", err)
+	}
+}
+
+func WriteLoadRequest(ids []ObjectID, pin bool, msg *string) {
+	var loadReq LoadRequest
+	loadReq.Type = LOAD_REQUEST
+	loadReq.IDs = ids
+	loadReq.Pin = pin
+
+	if err := encodeMsg(loadReq, msg); err != nil {
+		GetLogger().Errorf("WriteLoadRequest failed: %v", err)
+	}
+}
+
+func WriteUnpinRequest(ids []ObjectID, msg *string) {
+	var unpinReq UnpinRequest
+	unpinReq.Type = UNPIN_REQUEST
+	unpinReq.IDs = ids
+
+	if err := encodeMsg(unpinReq, msg); err != nil {
+		GetLogger().Errorf("WriteUnpinRequest failed: %v", err)
+	}
+}
+
+func WriteIsSpilledRequest(id ObjectID, msg *string) {
+	var isSpilledReq IsSpilledRequest
+	isSpilledReq.Type = IS_SPILLED_REQUEST
+	isSpilledReq.ID = id
+
+	if err := encodeMsg(isSpilledReq, msg); err != nil {
+		GetLogger().Errorf("WriteIsSpilledRequest failed: %v", err)
+	}
+}
+
+func WriteIsInUseRequest(id ObjectID, msg *string) {
+	var isInUseReq IsInUseRequest
+	isInUseReq.Type = IS_IN_USE_REQUEST
+	isInUseReq.ID = id
+
+	if err := encodeMsg(isInUseReq, msg); err != nil {
+		GetLogger().Errorf("WriteIsInUseRequest failed: %v", err)
+	}
+}
+
+func WriteCreateStreamRequest(id ObjectID, msg *string) {
+	var createStreamReq CreateStreamRequest
+	createStreamReq.Type = CREATE_STREAM_REQUEST
+	createStreamReq.ObjectID = id
+
+	if err := encodeMsg(createStreamReq, msg); err != nil {
+		GetLogger().Errorf("WriteCreateStreamRequest failed: %v", err)
+	}
+}
+
+func WriteOpenStreamRequest(id ObjectID, mode int64, msg *string) {
+	var openStreamReq OpenStreamRequest
+	openStreamReq.Type = OPEN_STREAM_REQUEST
+	openStreamReq.ObjectID = id
+	openStreamReq.Mode = mode
+
+	if err := encodeMsg(openStreamReq, msg); err != nil {
+		GetLogger().Errorf("WriteOpenStreamRequest failed: %v", err)
+	}
+}
+
+func WriteGetNextStreamChunkRequest(id ObjectID, size int, msg *string) {
+	var getNextReq GetNextStreamChunkRequest
+	getNextReq.Type = GET_NEXT_STREAM_CHUNK_REQUEST
+	getNextReq.ID = id
+	getNextReq.Size = size
+
+	if err := encodeMsg(getNextReq, msg); err != nil {
+		GetLogger().Errorf("WriteGetNextStreamChunkRequest failed: %v", err)
+	}
+}
+
+func WritePushNextStreamChunkRequest(id ObjectID, chunk ObjectID, msg *string) {
+	var pushNextReq PushNextStreamChunkRequest
+	pushNextReq.Type = PUSH_NEXT_STREAM_CHUNK_REQUEST
+	pushNextReq.ID = id
+	pushNextReq.Chunk = chunk
+
+	if err := encodeMsg(pushNextReq, msg); err != nil {
+		GetLogger().Errorf("WritePushNextStreamChunkRequest failed: %v", err)
+	}
+}
+
+func WritePullNextStreamChunkRequest(id ObjectID, msg *string) {
+	var pullNextReq PullNextStreamChunkRequest
+	pullNextReq.Type = PULL_NEXT_STREAM_CHUNK_REQUEST
+	pullNextReq.ID = id
+
+	if err := encodeMsg(pullNextReq, msg); err != nil {
+		GetLogger().Errorf("WritePullNextStreamChunkRequest failed: %v", err)
+	}
+}
+
+func WriteStopStreamRequest(id ObjectID, failed bool, msg *string) {
+	var stopStreamReq StopStreamRequest
+	stopStreamReq.Type = STOP_STREAM_REQUEST
+	stopStreamReq.ID = id
+	stopStreamReq.Failed = failed
+
+	if err := encodeMsg(stopStreamReq, msg); err != nil {
+		GetLogger().Errorf("WriteStopStreamRequest failed: %v", err)
+	}
+}
+
+func WriteDropStreamRequest(id ObjectID, msg *string) {
+	var dropStreamReq DropStreamRequest
+	dropStreamReq.Type = DROP_STREAM_REQUEST
+	dropStreamReq.ID = id
+
+	if err := encodeMsg(dropStreamReq, msg); err != nil {
+		GetLogger().Errorf("WriteDropStreamRequest failed: %v", err)
+	}
+}
+
+func WriteCreateRemoteBufferRequest(size int, compress bool, msg *string) {
+	var createRemoteBufferReq CreateRemoteBufferRequest
+	createRemoteBufferReq.Type = CREATE_REMOTE_BUFFER_REQUEST
+	createRemoteBufferReq.Size = size
+	createRemoteBufferReq.Compress = compress
+
+	if err := encodeMsg(createRemoteBufferReq, msg); err != nil {
+		GetLogger().Errorf("WriteCreateRemoteBufferRequest failed: %v", err)
+	}
+}
+
+// WriteGetRemoteBuffersRequest encodes the ids as "0", "1", ..., as the
+// server expects, rather than as a list.
+func WriteGetRemoteBuffersRequest(ids []ObjectID, unsafe bool, compress bool, msg *string) {
+	getRemoteBuffersReq := make(map[string]interface{})
+	getRemoteBuffersReq["type"] = GET_REMOTE_BUFFERS_REQUEST
+	for index, id := range ids {
+		getRemoteBuffersReq[strconv.Itoa(index)] = id
+	}
+	getRemoteBuffersReq["num"] = len(ids)
+	getRemoteBuffersReq["unsafe"] = unsafe
+	getRemoteBuffersReq["compress"] = compress
+
+	if err := encodeMsg(getRemoteBuffersReq, msg); err != nil {
+		GetLogger().Errorf("WriteGetRemoteBuffersRequest failed: %v", err)
+	}
+}
+
+func WriteIncreaseReferenceCountRequest(ids []ObjectID, msg *string) {
+	var increaseReq IncreaseReferenceCountRequest
+	increaseReq.Type = INCREASE_REFERENCE_COUNT_REQUEST
+	increaseReq.IDs = ids
+
+	if err := encodeMsg(increaseReq, msg); err != nil {
+		GetLogger().Errorf("WriteIncreaseReferenceCountRequest failed: %v", err)
+	}
+}
+
+func WriteReleaseRequest(id ObjectID, msg *string) {
+	var releaseReq ReleaseRequest
+	releaseReq.Type = RELEASE_REQUEST
+	releaseReq.ObjectID = id
+
+	if err := encodeMsg(releaseReq, msg); err != nil {
+		GetLogger().Errorf("WriteReleaseRequest failed: %v", err)
+	}
+}
+
+func WriteInstanceStatusRequest(msg *string) {
+	var instanceStatus InstanceStatusRequest
+	instanceStatus.Type = INSTANCE_STATUS_REQUEST
+
+	if err := encodeMsg(instanceStatus, msg); err != nil {
+		GetLogger().Errorf("WriteInstanceStatusRequest failed: %v", err)
+	}
+}
+
+func WriteNewSessionRequest(msg *string) {
+	var newSession NewSessionRequest
+	newSession.Type = NEW_SESSION_REQUEST
+	newSession.BulkStoreType = DEFAULT_STORE_TYPE
+
+	if err := encodeMsg(newSession, msg); err != nil {
+		GetLogger().Errorf("WriteNewSessionRequest failed: %v", err)
+	}
+}
+
+func WriteDeleteSessionRequest(msg *string) {
+	var deleteSession DeleteSessionRequest
+	deleteSession.Type = DELETE_SESSION_REQUEST
+
+	if err := encodeMsg(deleteSession, msg); err != nil {
+		GetLogger().Errorf("WriteDeleteSessionRequest failed: %v", err)
 	}
 }
@@ -15,7 +15,10 @@ limitations under the License.
 
 package common
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
 	KOK              = 0
@@ -59,12 +62,180 @@ const (
 	KUnKnownError = 255
 )
 
+var codeNames = map[int]string{
+	KOK:              "OK",
+	KInvalid:         "Invalid",
+	KKeyError:        "Key error",
+	KTypeError:       "Type error",
+	KIOError:         "IOError",
+	KEndOfFile:       "End of file",
+	KNotImplemented:  "Not implemented",
+	KAssertionFailed: "Assertion failed",
+	KUserInputError:  "User input error",
+
+	KObjectExists:    "Object exists",
+	KObjectNotExists: "Object not exists",
+	KObjectSealed:    "Object sealed",
+	KObjectNotSealed: "Object not sealed",
+	KObjectIsBlob:    "Object is blob",
+
+	KMetaTreeInvalid:          "Metatree invalid",
+	KMetaTreeTypeInvalid:      "Metatree type invalid",
+	KMetaTreeTypeNotExists:    "Metatree type not exists",
+	KMetaTreeNameInvalid:      "Metatree name invalid",
+	KMetaTreeNameNotExists:    "Metatree name not exists",
+	KMetaTreeLinKInvalid:      "Metatree link invalid",
+	KMetaTreeSubtreeNotExists: "Metatree subtree not exists",
+
+	KVineyardServerNotReady: "Vineyard server not ready",
+	KArrowError:             "Arrow error",
+	KConnectionFailed:       "Connection failed",
+	KConnectionError:        "Connection error",
+	KEtcdError:              "Etcd error",
+
+	KNotEnoughMemory:    "Not enough memory",
+	KStreamDrained:      "Stream drain",
+	KStreamFailed:       "Stream failed",
+	KInvalidStreamState: "Invalid stream state",
+	KStreamOpened:       "Stream opened",
+
+	KGlobalObjectInvalid: "Global object invalid",
+
+	KUnKnownError: "Unknown error",
+}
+
+// CodeName returns the name of the status code, as the C++ client does.
+func CodeName(code int) string {
+	if name, ok := codeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown error(%d)", code)
+}
+
+// Status is the status returned by the vineyard server.
+//
+// The errors returned by the client can be checked against the sentinel
+// statuses by errors.Is, which compares the codes only, e.g.,
+//
+//	if errors.Is(err, common.ErrObjectNotExists) { ... }
+//
+// or be unwrapped to the status by errors.As to inspect the message.
+type Status struct {
+	Code    int
+	Message string
+}
+
+// NewStatus returns the status of the code, a nil status stands for OK.
+func NewStatus(code int, message string) *Status {
+	if code == KOK {
+		return nil
+	}
+	return &Status{Code: code, Message: message}
+}
+
+func (s *Status) OK() bool {
+	return s == nil || s.Code == KOK
+}
+
+func (s *Status) Error() string {
+	if s.Message == "" {
+		return CodeName(s.Code)
+	}
+	return CodeName(s.Code) + ": " + s.Message
+}
+
+// Is reports whether the target is a status of the same code.
+func (s *Status) Is(target error) bool {
+	t, ok := target.(*Status)
+	return ok && t != nil && s.Code == t.Code
+}
+
+var (
+	ErrInvalid         = &Status{Code: KInvalid}
+	ErrKeyError        = &Status{Code: KKeyError}
+	ErrTypeError       = &Status{Code: KTypeError}
+	ErrIOError         = &Status{Code: KIOError}
+	ErrEndOfFile       = &Status{Code: KEndOfFile}
+	ErrNotImplemented  = &Status{Code: KNotImplemented}
+	ErrAssertionFailed = &Status{Code: KAssertionFailed}
+	ErrUserInputError  = &Status{Code: KUserInputError}
+
+	ErrObjectExists    = &Status{Code: KObjectExists}
+	ErrObjectNotExists = &Status{Code: KObjectNotExists}
+	ErrObjectSealed    = &Status{Code: KObjectSealed}
+	ErrObjectNotSealed = &Status{Code: KObjectNotSealed}
+	ErrObjectIsBlob    = &Status{Code: KObjectIsBlob}
+
+	ErrMetaTreeInvalid          = &Status{Code: KMetaTreeInvalid}
+	ErrMetaTreeTypeInvalid      = &Status{Code: KMetaTreeTypeInvalid}
+	ErrMetaTreeTypeNotExists    = &Status{Code: KMetaTreeTypeNotExists}
+	ErrMetaTreeNameInvalid      = &Status{Code: KMetaTreeNameInvalid}
+	ErrMetaTreeNameNotExists    = &Status{Code: KMetaTreeNameNotExists}
+	ErrMetaTreeLinkInvalid      = &Status{Code: KMetaTreeLinKInvalid}
+	ErrMetaTreeSubtreeNotExists = &Status{Code: KMetaTreeSubtreeNotExists}
+
+	ErrVineyardServerNotReady = &Status{Code: KVineyardServerNotReady}
+	ErrArrowError             = &Status{Code: KArrowError}
+	ErrConnectionFailed       = &Status{Code: KConnectionFailed}
+	ErrConnectionError        = &Status{Code: KConnectionError}
+	ErrEtcdError              = &Status{Code: KEtcdError}
+
+	ErrNotEnoughMemory    = &Status{Code: KNotEnoughMemory}
+	ErrStreamDrained      = &Status{Code: KStreamDrained}
+	ErrStreamFailed       = &Status{Code: KStreamFailed}
+	ErrInvalidStreamState = &Status{Code: KInvalidStreamState}
+	ErrStreamOpened       = &Status{Code: KStreamOpened}
+
+	ErrGlobalObjectInvalid = &Status{Code: KGlobalObjectInvalid}
+
+	ErrUnknown = &Status{Code: KUnKnownError}
+)
+
+// ReplyError is the error of a request, the code is KOK when the reply is
+// not the expected type.
 type ReplyError struct {
 	Code int
 	Type string
 	Err  error
 }
 
+// NewReplyError returns the error of the reply with the message of vineyard.
+func NewReplyError(code int, replyType string, message string) *ReplyError {
+	return &ReplyError{Code: code, Type: replyType, Err: errors.New(message)}
+}
+
 func (r *ReplyError) Error() string {
-	return "code:" + fmt.Sprintf("%v", r.Code) + " type:" + r.Type + " :" + r.Err.Error()
+	message := "code:" + fmt.Sprintf("%v", r.Code) + " type:" + r.Type
+	if r.Err != nil {
+		message += " :" + r.Err.Error()
+	}
+	return message
+}
+
+func (r *ReplyError) Unwrap() error {
+	return r.Err
+}
+
+// Status returns the status of the reply.
+func (r *ReplyError) Status() *Status {
+	message := ""
+	if r.Err != nil {
+		message = r.Err.Error()
+	}
+	return &Status{Code: r.Code, Message: message}
+}
+
+// Is reports whether the target is a status of the same code.
+func (r *ReplyError) Is(target error) bool {
+	t, ok := target.(*Status)
+	return ok && t != nil && r.Code != KOK && r.Code == t.Code
+}
+
+// As unwraps the reply error to its status.
+func (r *ReplyError) As(target interface{}) bool {
+	if status, ok := target.(**Status); ok && r.Code != KOK {
+		*status = r.Status()
+		return true
+	}
+	return false
 }
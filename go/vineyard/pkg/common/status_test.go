@@ -0,0 +1,66 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestReplyError_Is(t *testing.T) {
+	var err error = NewReplyError(KObjectNotExists, GET_DATA_REPLY, "object not found")
+	wrapped := fmt.Errorf("get object: %w", err)
+	if !errors.Is(wrapped, ErrObjectNotExists) {
+		t.Error("the reply error should match its code")
+	}
+	if errors.Is(wrapped, ErrNotEnoughMemory) {
+		t.Error("the reply error shouldn't match other codes")
+	}
+
+	var status *Status
+	if !errors.As(wrapped, &status) {
+		t.Fatal("the reply error should be unwrapped to its status")
+	}
+	if status.Code != KObjectNotExists || status.Message != "object not found" {
+		t.Error("unexpected status", status)
+	}
+	if status.Error() != "Object not exists: object not found" {
+		t.Error("unexpected message", status.Error())
+	}
+
+	// a reply of the unexpected type carries no status
+	var unexpected error = &ReplyError{Type: GET_NAME_REPLY}
+	if unexpected.Error() != "code:0 type:get_name_reply" {
+		t.Error("unexpected message", unexpected.Error())
+	}
+	if errors.As(unexpected, &status) {
+		t.Error("the ok reply shouldn't be unwrapped to a status")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	if !NewStatus(KOK, "").OK() {
+		t.Error("the status should be ok")
+	}
+	status := NewStatus(KStreamDrained, "")
+	if status.OK() || !errors.Is(status, ErrStreamDrained) {
+		t.Error("the status should be drained", status)
+	}
+	if CodeName(100) != "Unknown error(100)" {
+		t.Error("unexpected name", CodeName(100))
+	}
+}
@@ -0,0 +1,92 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VINEYARD_VERSION is the version of vineyard that the client speaks, which is
+// sent to vineyardd on registering.
+const VINEYARD_VERSION = "0.14.0"
+
+// ErrIncompatibleServer is returned when the version of vineyardd is not
+// compatible with the client.
+var ErrIncompatibleServer = errors.New("incompatible vineyard server")
+
+// Version is a semantic version "major.minor.patch", the pre-release and the
+// build metadata are ignored.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses the version, the leading "v" is optional.
+func ParseVersion(version string) (Version, error) {
+	s := strings.TrimPrefix(version, "v")
+	if index := strings.IndexAny(s, "-+"); index >= 0 {
+		s = s[:index]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: expect major.minor.patch", version)
+	}
+	var numbers [3]int
+	for index, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", version, err)
+		}
+		numbers[index] = int(number)
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// CompatibleServer checks whether the client can talk to the server of the
+// given version, i.e., the major versions are the same and the server is not
+// older than the client in the minor version, as the vineyard client does.
+func (v Version) CompatibleServer(server Version) bool {
+	return v.Major == server.Major && v.Minor <= server.Minor
+}
+
+// CheckServerVersion checks the version that vineyardd replies on registering,
+// a server that replies no version is taken as DEFAULT_SERVER_VERSION.
+func CheckServerVersion(serverVersion string) error {
+	if serverVersion == "" {
+		serverVersion = DEFAULT_SERVER_VERSION
+	}
+	client, err := ParseVersion(VINEYARD_VERSION)
+	if err != nil {
+		return err
+	}
+	server, err := ParseVersion(serverVersion)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIncompatibleServer, err)
+	}
+	if !client.CompatibleServer(server) {
+		return fmt.Errorf("%w: the version of vineyardd is %s, while the client requires %d.%d.x or a newer minor version",
+			ErrIncompatibleServer, server, client.Major, client.Minor)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := map[string]Version{
+		"0.14.0":        {0, 14, 0},
+		"v1.2.3":        {1, 2, 3},
+		"0.14.1-rc1":    {0, 14, 1},
+		"0.14.1+abcdef": {0, 14, 1},
+	}
+	for version, expected := range cases {
+		parsed, err := ParseVersion(version)
+		if err != nil || parsed != expected {
+			t.Errorf("unexpected version of %s: %v, %v", version, parsed, err)
+		}
+	}
+	for _, version := range []string{"", "0.14", "0.14.x", "0.-1.0", "1.2.3.4"} {
+		if _, err := ParseVersion(version); err == nil {
+			t.Errorf("expect the version %q to be invalid", version)
+		}
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	client, err := ParseVersion(VINEYARD_VERSION)
+	if err != nil {
+		t.Fatal("the version of the client is invalid", err)
+	}
+	compatible := []Version{
+		client,
+		{client.Major, client.Minor, client.Patch + 1},
+		{client.Major, client.Minor + 1, 0},
+	}
+	for _, server := range compatible {
+		if err := CheckServerVersion(server.String()); err != nil {
+			t.Errorf("expect the server %s to be compatible: %v", server, err)
+		}
+	}
+	incompatible := []string{"", "0.0.0", "invalid", Version{client.Major + 1, 0, 0}.String()}
+	if client.Minor > 0 {
+		incompatible = append(incompatible, Version{client.Major, client.Minor - 1, 0}.String())
+	}
+	for _, server := range incompatible {
+		if err := CheckServerVersion(server); !errors.Is(err, ErrIncompatibleServer) {
+			t.Errorf("expect the server %q to be incompatible: %v", server, err)
+		}
+	}
+}
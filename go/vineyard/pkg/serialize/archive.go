@@ -0,0 +1,240 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serialize
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveWriter stores the files of serialized objects, the names are slash
+// separated paths relative to the root of the archive.
+type ArchiveWriter interface {
+	WriteFile(name string, data []byte) error
+}
+
+// ArchiveReader loads the files of serialized objects, the names are slash
+// separated paths relative to the root of the archive, and "" is the root.
+type ArchiveReader interface {
+	// ReadFile returns the content of the file, or an error that wraps
+	// fs.ErrNotExist if there is no such file.
+	ReadFile(name string) ([]byte, error)
+	// ReadDir returns the names of the directories in the directory, in
+	// sorted order.
+	ReadDir(name string) ([]string, error)
+}
+
+// DirArchive is an archive in the directory of the local filesystem, which
+// has the same layout as the archives that vineyard.io.serialize writes.
+type DirArchive struct {
+	root string
+}
+
+var _ ArchiveWriter = &DirArchive{}
+var _ ArchiveReader = &DirArchive{}
+
+// NewDirArchive returns the archive in the directory, which is created when
+// the first file is written.
+func NewDirArchive(root string) *DirArchive {
+	return &DirArchive{root: root}
+}
+
+func (d *DirArchive) WriteFile(name string, data []byte) error {
+	filename := filepath.Join(d.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+func (d *DirArchive) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+func (d *DirArchive) ReadDir(name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(d.root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// TarArchiveWriter writes the archive as a tar stream, which is extracted to
+// the same layout as DirArchive. The writer must be closed to complete the
+// stream.
+type TarArchiveWriter struct {
+	writer *tar.Writer
+	dirs   map[string]bool
+}
+
+var _ ArchiveWriter = &TarArchiveWriter{}
+
+func NewTarArchiveWriter(w io.Writer) *TarArchiveWriter {
+	return &TarArchiveWriter{writer: tar.NewWriter(w), dirs: make(map[string]bool)}
+}
+
+func (t *TarArchiveWriter) WriteFile(name string, data []byte) error {
+	name, err := cleanArchivePath(name)
+	if err != nil {
+		return err
+	}
+	if err := t.writeDir(path.Dir(name)); err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := t.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = t.writer.Write(data)
+	return err
+}
+
+// writeDir writes the entries of the directory and its parents, if they
+// haven't been written yet.
+func (t *TarArchiveWriter) writeDir(dir string) error {
+	if dir == "." || t.dirs[dir] {
+		return nil
+	}
+	if err := t.writeDir(path.Dir(dir)); err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0o755,
+		ModTime:  time.Now(),
+	}
+	if err := t.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	t.dirs[dir] = true
+	return nil
+}
+
+// Close completes the tar stream, the underlying writer is not closed.
+func (t *TarArchiveWriter) Close() error {
+	return t.writer.Close()
+}
+
+// TarArchiveReader is the archive that is loaded from a tar stream, the
+// files are kept in memory.
+type TarArchiveReader struct {
+	files map[string][]byte
+	dirs  map[string]map[string]bool
+}
+
+var _ ArchiveReader = &TarArchiveReader{}
+
+// ReadTarArchive loads the regular files and the directories of the tar
+// stream, the other kinds of entries are ignored.
+func ReadTarArchive(r io.Reader) (*TarArchiveReader, error) {
+	t := &TarArchiveReader{
+		files: make(map[string][]byte),
+		dirs:  map[string]map[string]bool{".": {}},
+	}
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeDir && path.Clean(header.Name) == "." {
+			continue
+		}
+		name, err := cleanArchivePath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			t.addDir(name)
+		case tar.TypeReg, tar.TypeRegA:
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+			t.addDir(path.Dir(name))
+			t.files[name] = data
+		}
+	}
+}
+
+func (t *TarArchiveReader) addDir(dir string) {
+	if _, ok := t.dirs[dir]; ok {
+		return
+	}
+	t.dirs[dir] = make(map[string]bool)
+	if dir != "." {
+		t.addDir(path.Dir(dir))
+		t.dirs[path.Dir(dir)][path.Base(dir)] = true
+	}
+}
+
+func (t *TarArchiveReader) ReadFile(name string) ([]byte, error) {
+	data, ok := t.files[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (t *TarArchiveReader) ReadDir(name string) ([]string, error) {
+	if name == "" {
+		name = "."
+	}
+	children, ok := t.dirs[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	dirs := make([]string, 0, len(children))
+	for child := range children {
+		dirs = append(dirs, child)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// cleanArchivePath rejects the paths that escape the root of the archive.
+func cleanArchivePath(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if cleaned == "." || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid path in archive: %q", name)
+	}
+	return cleaned, nil
+}
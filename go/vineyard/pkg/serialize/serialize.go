@@ -0,0 +1,450 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package serialize dumps vineyard objects to archives and restores them, in
+// the format of vineyard.io.serialize and vineyard.io.deserialize.
+//
+// An archive of a single partition is laid out as
+//
+//	1-0/metadata.json              the metadata of the object
+//	1-0/<member>/metadata.json     the metadata of the member
+//	1-0/<member>/<member>/blob     the payload of the blob
+//	1-0/<member>/<member>/blob.meta.json
+//
+// where the metadata of an object is stored as the metadata of a stream
+// collection, whose "__typename" is the typename of the object, and a blob
+// object is stored as the blob file only.
+package serialize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+const (
+	// CompressionNone stores the payloads of blobs as is.
+	CompressionNone = ""
+	// CompressionZstd compresses the payload of each blob as a zstd frame.
+	CompressionZstd = "zstd"
+)
+
+const (
+	kPartition            = "1-0"
+	kMetadataFile         = "metadata.json"
+	kBlobFile             = "blob"
+	kBlobMetadataFile     = "blob.meta.json"
+	kStreamCollectionType = "vineyard::StreamCollection"
+	kKeyOfTypename        = "__typename"
+	kKeyOfGlobal          = "__global"
+	kKeyOfPath            = "__path"
+	kKeyOfOptions         = "__options"
+	kKeyOfLength          = "length"
+	kKeyOfCompression     = "compression_method"
+)
+
+// kRestoreSkippedKeys are the keys of the archived metadata that are assigned
+// by vineyard or describe the archive, rather than the object.
+var kRestoreSkippedKeys = map[string]bool{
+	"typename":    true,
+	"id":          true,
+	"signature":   true,
+	"instance_id": true,
+	"transient":   true,
+	"global":      true,
+	kKeyOfGlobal:  true,
+	kKeyOfPath:    true,
+	"__streams":   true,
+}
+
+var partitionPattern = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// Option configures how Serialize writes the archive.
+type Option func(*options)
+
+type options struct {
+	compression string
+}
+
+// WithCompression sets the compression method of the payloads of blobs, which
+// is CompressionZstd by default, as vineyard.io.serialize does.
+func WithCompression(method string) Option {
+	return func(options *options) {
+		options.compression = method
+	}
+}
+
+// Serialize writes the metadata and the payloads of the blobs of the object to
+// the archive. The members that live on other instances are skipped, as
+// vineyard.io.serialize does, thus an object is serialized by the client of
+// each instance it spans, into the archives of different partitions.
+func Serialize(ctx context.Context, client vineyard.Client, id common.ObjectID, archive ArchiveWriter, opts ...Option) error {
+	options := options{compression: CompressionZstd}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.compression != CompressionNone && options.compression != CompressionZstd {
+		return fmt.Errorf("unsupported compression method: %q", options.compression)
+	}
+	var meta ds.ObjectMeta
+	if err := client.GetMetaData(ctx, id, &meta, true); err != nil {
+		return err
+	}
+	s := serializer{archive: archive, compression: options.compression}
+	err := s.serialize(&meta, "")
+	if s.encoder != nil {
+		s.encoder.Close()
+	}
+	// the blobs are in use since the metadata is fetched
+	if id != common.EmptyBlobID() {
+		if releaseErr := client.Release(ctx, id); err == nil {
+			err = releaseErr
+		}
+	}
+	return err
+}
+
+type serializer struct {
+	archive     ArchiveWriter
+	compression string
+	encoder     *zstd.Encoder
+}
+
+// serialize writes the object at the path, which is relative to the root of
+// the partition.
+func (s *serializer) serialize(meta *ds.ObjectMeta, p string) error {
+	id, err := meta.GetId()
+	if err != nil {
+		return err
+	}
+	if common.IsBlob(id) {
+		return s.serializeBlob(meta, id, p)
+	}
+	metadata := make(map[string]interface{})
+	for key, value := range meta.MetaData() {
+		if _, ok := value.(map[string]interface{}); !ok && key != "global" {
+			metadata[key] = value
+		}
+	}
+	metadata["typename"] = kStreamCollectionType
+	metadata[kKeyOfTypename] = meta.Typename()
+	metadata[kKeyOfGlobal] = meta.IsGlobal()
+	metadata[kKeyOfPath] = p
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := s.archive.WriteFile(path.Join(kPartition, p, kMetadataFile), content); err != nil {
+		return err
+	}
+	for _, name := range meta.ListMembers() {
+		member, err := meta.GetMember(name)
+		if err != nil {
+			return err
+		}
+		if !member.IsLocal() {
+			continue
+		}
+		if err := s.serialize(member, path.Join(p, name)); err != nil {
+			return fmt.Errorf("failed to serialize member '%s' of %s: %w", name, common.ObjectIDToString(id), err)
+		}
+	}
+	return nil
+}
+
+func (s *serializer) serializeBlob(meta *ds.ObjectMeta, id common.ObjectID, p string) error {
+	var data []byte
+	if id != common.EmptyBlobID() {
+		blob, err := meta.GetBuffer(id)
+		if err != nil {
+			return err
+		}
+		if data, err = blob.Data(); err != nil {
+			return err
+		}
+	}
+	serializationOptions := make(map[string]interface{})
+	content := data
+	if s.compression == CompressionZstd {
+		serializationOptions[kKeyOfCompression] = CompressionZstd
+		// the empty blobs are stored as is, as vineyard.io.serialize does
+		if len(data) > 0 {
+			if s.encoder == nil {
+				encoder, err := zstd.NewWriter(nil)
+				if err != nil {
+					return err
+				}
+				s.encoder = encoder
+			}
+			content = s.encoder.EncodeAll(data, make([]byte, 0, len(data)/2))
+		}
+	}
+	serializedOptions, err := json.Marshal(serializationOptions)
+	if err != nil {
+		return err
+	}
+	name := path.Join(p, kBlobFile)
+	params, err := json.Marshal(map[string]interface{}{
+		kKeyOfPath:    name,
+		kKeyOfLength:  len(data),
+		kKeyOfOptions: string(serializedOptions),
+		"id":          common.ObjectIDToString(id),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.archive.WriteFile(path.Join(kPartition, name), content); err != nil {
+		return err
+	}
+	return s.archive.WriteFile(path.Join(kPartition, p, kBlobMetadataFile), params)
+}
+
+// Deserialize restores the object in the archive, which may be written by
+// Serialize or by vineyard.io.serialize, and persists it. The id of the
+// restored object is returned, along with the mapping from the ids of the
+// archived objects to the ids of the restored ones.
+//
+// The archives written by vineyard.io.serialize record the ids of the stream
+// collections rather than the ids of the objects, thus the ids of blobs and
+// objects are missing from, or are not meaningful in, the mapping.
+func Deserialize(ctx context.Context, client vineyard.Client, archive ArchiveReader) (common.ObjectID, map[common.ObjectID]common.ObjectID, error) {
+	root, err := findPartition(archive)
+	if err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	d := deserializer{client: client, archive: archive, mapping: make(map[common.ObjectID]common.ObjectID)}
+	id, err := d.deserialize(ctx, root)
+	if d.decoder != nil {
+		d.decoder.Close()
+	}
+	if err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	if err := client.Persist(ctx, id); err != nil {
+		return common.InvalidObjectID(), nil, err
+	}
+	return id, d.mapping, nil
+}
+
+// findPartition returns the root of the only partition of the archive, the
+// archive itself may be the partition as well.
+func findPartition(archive ArchiveReader) (string, error) {
+	for _, name := range []string{kMetadataFile, kBlobFile} {
+		if _, err := archive.ReadFile(name); err == nil {
+			return "", nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	dirs, err := archive.ReadDir("")
+	if err != nil {
+		return "", err
+	}
+	partitions := make([]string, 0, 1)
+	for _, dir := range dirs {
+		if partitionPattern.MatchString(dir) {
+			partitions = append(partitions, dir)
+		}
+	}
+	if len(partitions) != 1 {
+		return "", fmt.Errorf("expect a single partition in the archive, but found %d: %v", len(partitions), partitions)
+	}
+	return partitions[0], nil
+}
+
+type deserializer struct {
+	client  vineyard.Client
+	archive ArchiveReader
+	decoder *zstd.Decoder
+	mapping map[common.ObjectID]common.ObjectID
+}
+
+// deserialize restores the object in the directory of the archive, which is
+// a blob unless there is the metadata.
+func (d *deserializer) deserialize(ctx context.Context, dir string) (common.ObjectID, error) {
+	content, err := d.archive.ReadFile(path.Join(dir, kMetadataFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return d.deserializeBlob(ctx, dir)
+	}
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	metadata, err := ds.ParseMetaData(content)
+	if err != nil {
+		return common.InvalidObjectID(), fmt.Errorf("invalid metadata at '%s': %w", dir, err)
+	}
+	typename, ok := metadata[kKeyOfTypename].(string)
+	if !ok || typename == "" {
+		return common.InvalidObjectID(), fmt.Errorf("invalid metadata at '%s': the typename is missing", dir)
+	}
+	global, _ := metadata[kKeyOfGlobal].(bool)
+
+	var meta ds.ObjectMeta
+	meta.Init()
+	for key, value := range metadata {
+		if !kRestoreSkippedKeys[key] && key != kKeyOfTypename {
+			meta.AddKeyValue(key, value)
+		}
+	}
+	meta.SetTypename(typename)
+	if global {
+		meta.SetGlobal(true)
+	}
+	members, err := d.archive.ReadDir(dir)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	for _, name := range members {
+		memberID, err := d.deserialize(ctx, path.Join(dir, name))
+		if err != nil {
+			return common.InvalidObjectID(), err
+		}
+		if global {
+			if err := d.client.Persist(ctx, memberID); err != nil {
+				return common.InvalidObjectID(), err
+			}
+		}
+		if err := meta.AddMemberID(name, memberID); err != nil {
+			return common.InvalidObjectID(), err
+		}
+	}
+	id, err := d.client.CreateMetaData(ctx, &meta)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	d.record(metadata["id"], id)
+	return id, nil
+}
+
+func (d *deserializer) deserializeBlob(ctx context.Context, dir string) (common.ObjectID, error) {
+	name := path.Join(dir, kBlobFile)
+	content, err := d.archive.ReadFile(name)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	params := map[string]interface{}{}
+	if data, err := d.archive.ReadFile(path.Join(dir, kBlobMetadataFile)); err == nil {
+		if params, err = ds.ParseMetaData(data); err != nil {
+			return common.InvalidObjectID(), fmt.Errorf("invalid metadata of blob '%s': %w", name, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return common.InvalidObjectID(), err
+	}
+	length := len(content)
+	if value, ok := params[kKeyOfLength]; ok {
+		if length, err = toInt(value); err != nil || length < 0 {
+			return common.InvalidObjectID(), fmt.Errorf("invalid length of blob '%s': %v", name, value)
+		}
+	}
+	compression, err := compressionOf(params)
+	if err != nil {
+		return common.InvalidObjectID(), fmt.Errorf("invalid options of blob '%s': %w", name, err)
+	}
+
+	var writer ds.BlobWriter
+	if err := d.client.CreateBlob(ctx, length, &writer); err != nil {
+		return common.InvalidObjectID(), err
+	}
+	buffer := writer.Bytes()
+	size := len(content)
+	if compression == CompressionZstd && len(content) > 0 {
+		// decompress in place, the output outgrows the blob otherwise
+		if d.decoder == nil {
+			if d.decoder, err = zstd.NewReader(nil); err != nil {
+				_ = writer.Abort(ctx)
+				return common.InvalidObjectID(), err
+			}
+		}
+		decompressed, err := d.decoder.DecodeAll(content, buffer[:0:len(buffer)])
+		if err != nil {
+			_ = writer.Abort(ctx)
+			return common.InvalidObjectID(), fmt.Errorf("failed to decompress blob '%s': %w", name, err)
+		}
+		size = len(decompressed)
+	} else if size <= len(buffer) {
+		copy(buffer, content)
+	}
+	if size > len(buffer) {
+		_ = writer.Abort(ctx)
+		return common.InvalidObjectID(), fmt.Errorf("the content of blob '%s' exceeds its length: %d vs. %d", name, size, len(buffer))
+	}
+	for index := size; index < len(buffer); index++ {
+		buffer[index] = 0
+	}
+	blob, err := writer.Seal(ctx)
+	if err != nil {
+		return common.InvalidObjectID(), err
+	}
+	if blob.Size() > 0 {
+		if err := d.client.Release(ctx, blob.ID()); err != nil {
+			return common.InvalidObjectID(), err
+		}
+	}
+	d.record(params["id"], blob.ID())
+	return blob.ID(), nil
+}
+
+// record maps the archived id to the restored one, the invalid ids are
+// ignored.
+func (d *deserializer) record(archived interface{}, id common.ObjectID) {
+	if value, ok := archived.(string); ok {
+		if archivedID, err := common.ObjectIDFromString(value); err == nil {
+			d.mapping[archivedID] = id
+		}
+	}
+}
+
+// compressionOf returns the compression method in the options of the blob,
+// which are encoded as a JSON string.
+func compressionOf(params map[string]interface{}) (string, error) {
+	value, ok := params[kKeyOfOptions]
+	if !ok {
+		return CompressionNone, nil
+	}
+	encoded, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("the options should be a JSON string, got %v", value)
+	}
+	var serializationOptions map[string]interface{}
+	if err := json.Unmarshal([]byte(encoded), &serializationOptions); err != nil {
+		return "", err
+	}
+	method, _ := serializationOptions[kKeyOfCompression].(string)
+	if method != CompressionNone && method != CompressionZstd {
+		return "", fmt.Errorf("unsupported compression method: %q", method)
+	}
+	return method, nil
+}
+
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return strconv.Atoi(v.String())
+	case float64:
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("not an integer: %v", value)
+	}
+}
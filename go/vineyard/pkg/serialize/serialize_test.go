@@ -0,0 +1,311 @@
+/** Copyright 2020-2023 Alibaba Group Holding Limited.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serialize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/klauspost/compress/zstd"
+	vineyard "github.com/v6d-io/v6d/go/vineyard/pkg/client"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/ds"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/client/vineyardtest"
+	"github.com/v6d-io/v6d/go/vineyard/pkg/common"
+)
+
+// connect connects to the endpoint, the client is disconnected when the test
+// completes.
+func connect(t *testing.T, endpoint string) vineyard.Client {
+	t.Helper()
+	client, err := vineyard.Connect(vineyardtest.Context(t), endpoint)
+	if err != nil {
+		t.Fatal("connect to vineyard failed", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Disconnect(context.Background())
+	})
+	return client
+}
+
+// createTensor creates a tensor and a pair that refers to the tensor and an
+// empty blob, the ids of the pair, the tensor and the buffer are returned.
+func createTensor(ctx context.Context, t *testing.T, client vineyard.Client) []common.ObjectID {
+	t.Helper()
+	var writer ds.BlobWriter
+	if err := client.CreateBlob(ctx, 6*8, &writer); err != nil {
+		t.Fatal("create blob failed", err)
+	}
+	copy(writer.Bytes(), arrow.Float64Traits.CastToBytes([]float64{1, 2, 3, 4, 5, 6}))
+	if _, err := writer.Seal(ctx); err != nil {
+		t.Fatal("seal blob failed", err)
+	}
+	var meta ds.ObjectMeta
+	meta.Init()
+	meta.SetTypename("vineyard::Tensor<double>")
+	meta.AddKeyValue("value_type_", "float64")
+	meta.AddKeyValue("shape_", "[2, 3]")
+	meta.AddKeyValue("partition_index_", "[]")
+	meta.SetNBytes(6 * 8)
+	if err := meta.AddMemberID("buffer_", writer.ID); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	tensor, err := client.CreateMetaData(ctx, &meta)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+
+	var pair ds.ObjectMeta
+	pair.Init()
+	pair.SetTypename("vineyard::Pair")
+	pair.AddKeyValue("name", "tensor")
+	if err := pair.AddMemberID("first_", tensor); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	if err := pair.AddMemberID("second_", common.EmptyBlobID()); err != nil {
+		t.Fatal("add member failed", err)
+	}
+	id, err := client.CreateMetaData(ctx, &pair)
+	if err != nil {
+		t.Fatal("create metadata failed", err)
+	}
+	return []common.ObjectID{id, tensor, writer.ID}
+}
+
+// checkTensor checks the tensor restored from the archive.
+func checkTensor(ctx context.Context, t *testing.T, client vineyard.Client, id common.ObjectID) {
+	t.Helper()
+	object, err := client.GetObject(ctx, id)
+	if err != nil {
+		t.Fatal("get restored tensor failed", err)
+	}
+	tensor, ok := object.(*ds.Tensor)
+	if !ok {
+		t.Fatalf("unexpected object: %T", object)
+	}
+	values := arrow.Float64Traits.CastFromBytes(tensor.Data())
+	if len(values) != 6 || values[0] != 1 || values[5] != 6 {
+		t.Error("unexpected content of the restored tensor", values)
+	}
+}
+
+func TestSerialize_RoundTrip(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client := connect(t, server.IPCSocket())
+	ids := createTensor(ctx, t, client)
+
+	dir := NewDirArchive(t.TempDir())
+	if err := Serialize(ctx, client, ids[0], dir); err != nil {
+		t.Fatal("serialize to directory failed", err)
+	}
+	var tarball bytes.Buffer
+	tarWriter := NewTarArchiveWriter(&tarball)
+	if err := Serialize(ctx, client, ids[0], tarWriter, WithCompression(CompressionNone)); err != nil {
+		t.Fatal("serialize to tar failed", err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal("close tar failed", err)
+	}
+	tarReader, err := ReadTarArchive(&tarball)
+	if err != nil {
+		t.Fatal("read tar failed", err)
+	}
+
+	var metadata map[string]interface{}
+	content, err := dir.ReadFile("1-0/metadata.json")
+	if err != nil || json.Unmarshal(content, &metadata) != nil {
+		t.Fatal("read metadata failed", err)
+	}
+	if metadata["typename"] != "vineyard::StreamCollection" || metadata["__typename"] != "vineyard::Pair" ||
+		metadata["__path"] != "" || metadata["__global"] != false || metadata["name"] != "tensor" {
+		t.Error("unexpected metadata in the archive", metadata)
+	}
+	if members, err := dir.ReadDir("1-0/first_"); err != nil || len(members) != 1 || members[0] != "buffer_" {
+		t.Error("unexpected members in the archive", members, err)
+	}
+	var params map[string]interface{}
+	content, err = dir.ReadFile("1-0/first_/buffer_/blob.meta.json")
+	if err != nil || json.Unmarshal(content, &params) != nil {
+		t.Fatal("read metadata of blob failed", err)
+	}
+	if params["__path"] != "first_/buffer_/blob" || params["length"] != float64(48) ||
+		params["__options"] != `{"compression_method":"zstd"}` {
+		t.Error("unexpected metadata of blob in the archive", params)
+	}
+	if raw, err := tarReader.ReadFile("1-0/first_/buffer_/blob"); err != nil || len(raw) != 48 {
+		t.Error("the blob should be stored as is without compression", len(raw), err)
+	}
+
+	for _, endpoint := range []string{server.IPCSocket(), server.RPCEndpoint()} {
+		for _, archive := range []ArchiveReader{dir, tarReader} {
+			target := connect(t, endpoint)
+			id, mapping, err := Deserialize(ctx, target, archive)
+			if err != nil {
+				t.Fatal("deserialize failed", err)
+			}
+			if id == ids[0] || mapping[ids[0]] != id {
+				t.Error("unexpected id of the restored object", id, mapping)
+			}
+			for _, archived := range ids[1:] {
+				if restored, ok := mapping[archived]; !ok || restored == archived {
+					t.Error("unexpected mapping of the restored member", common.ObjectIDToString(archived), mapping)
+				}
+			}
+			if persisted, err := target.IfPersist(ctx, id); err != nil || !persisted {
+				t.Error("the restored object should be persisted", persisted, err)
+			}
+			var meta ds.ObjectMeta
+			if err := target.GetMetaData(ctx, id, &meta, false); err != nil {
+				t.Fatal("get metadata failed", err)
+			}
+			var name string
+			if err := meta.GetKeyValue("name", &name); err != nil || name != "tensor" || meta.Typename() != "vineyard::Pair" {
+				t.Error("unexpected restored object", meta.MetaData())
+			}
+			if second, err := meta.GetMember("second_"); err != nil || second.Typename() != "vineyard::Blob" {
+				t.Error("the empty blob should be restored", err)
+			}
+			if err := target.Release(ctx, id); err != nil {
+				t.Error("release failed", err)
+			}
+			checkTensor(ctx, t, target, mapping[ids[1]])
+		}
+	}
+}
+
+// TestDeserialize_PythonArchive restores the archive of a tensor as laid out
+// by vineyard.io.serialize.
+func TestDeserialize_PythonArchive(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client := connect(t, server.IPCSocket())
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal("create zstd encoder failed", err)
+	}
+	payload := encoder.EncodeAll(arrow.Float64Traits.CastToBytes([]float64{1, 2, 3, 4, 5, 6}), nil)
+	encoder.Close()
+	files := map[string]string{
+		"1-0/metadata.json": `{"__global": false, "__path": "", "__streams": "[7000000000000000001]",
+			"__typename": "vineyard::Tensor<double>", "id": "o6c6f8f3d1c4e2a80", "instance_id": 0,
+			"nbytes": 48, "partition_index_": "[]", "shape_": "[2, 3]", "signature": 7000000000000000002,
+			"transient": true, "typename": "vineyard::StreamCollection", "value_type_": "float64"}`,
+		"1-0/buffer_/blob":           string(payload),
+		"1-0/buffer_/blob.meta.json": `{"__path": "buffer_/blob", "length": 48, "__options": "{\"compression_method\": \"zstd\"}"}`,
+	}
+	dir := NewDirArchive(t.TempDir())
+	for name, content := range files {
+		if err := dir.WriteFile(name, []byte(content)); err != nil {
+			t.Fatal("write archive failed", err)
+		}
+	}
+	id, mapping, err := Deserialize(ctx, client, dir)
+	if err != nil {
+		t.Fatal("deserialize failed", err)
+	}
+	if len(mapping) != 1 {
+		t.Error("only the id of the stream collection is recorded", mapping)
+	}
+	var meta ds.ObjectMeta
+	if err := client.GetMetaData(ctx, id, &meta, false); err != nil {
+		t.Fatal("get metadata failed", err)
+	}
+	for _, key := range []string{"__streams", "__path", "__global", "__typename"} {
+		if meta.HasKey(key) {
+			t.Error("the keys of the stream collection shouldn't be restored", key)
+		}
+	}
+	if err := client.Release(ctx, id); err != nil {
+		t.Error("release failed", err)
+	}
+	checkTensor(ctx, t, client, id)
+
+	// the partition itself can be restored as well
+	var serialized bytes.Buffer
+	tarWriter := NewTarArchiveWriter(&serialized)
+	if err := Serialize(ctx, client, id, tarWriter); err != nil {
+		t.Fatal("serialize failed", err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal("close tar failed", err)
+	}
+	tarReader, err := ReadTarArchive(&serialized)
+	if err != nil {
+		t.Fatal("read tar failed", err)
+	}
+	restored := NewDirArchive(t.TempDir())
+	for _, name := range []string{"metadata.json", "buffer_/blob", "buffer_/blob.meta.json"} {
+		content, err := tarReader.ReadFile("1-0/" + name)
+		if err != nil {
+			t.Fatal("read tar failed", err)
+		}
+		if err := restored.WriteFile(name, content); err != nil {
+			t.Fatal("write archive failed", err)
+		}
+	}
+	if id, _, err = Deserialize(ctx, client, restored); err != nil {
+		t.Fatal("deserialize the partition failed", err)
+	}
+	checkTensor(ctx, t, client, id)
+}
+
+func TestDeserialize_Invalid(t *testing.T) {
+	ctx := vineyardtest.Context(t)
+	server := vineyardtest.Start(t, nil)
+	client := connect(t, server.IPCSocket())
+
+	cases := map[string]map[string]string{
+		"partitions": {
+			"2-0/blob": "vineyard",
+			"2-1/blob": "vineyard",
+		},
+		"typename": {
+			"1-0/metadata.json": `{"__global": false}`,
+		},
+		"length": {
+			"1-0/blob":           "vineyard",
+			"1-0/blob.meta.json": `{"length": 4}`,
+		},
+		"compression": {
+			"1-0/blob":           "vineyard",
+			"1-0/blob.meta.json": `{"length": 8, "__options": "{\"compression_method\": \"gzip\"}"}`,
+		},
+	}
+	for name, files := range cases {
+		dir := NewDirArchive(t.TempDir())
+		for filename, content := range files {
+			if err := dir.WriteFile(filename, []byte(content)); err != nil {
+				t.Fatal("write archive failed", err)
+			}
+		}
+		if _, _, err := Deserialize(ctx, client, dir); err == nil {
+			t.Error("deserializing an invalid archive should fail", name)
+		}
+	}
+
+	var tarball bytes.Buffer
+	tarWriter := NewTarArchiveWriter(&tarball)
+	if err := tarWriter.WriteFile("../blob", nil); err == nil {
+		t.Error("writing a file out of the archive should fail")
+	}
+	if err := Serialize(ctx, client, common.EmptyBlobID(), tarWriter, WithCompression("gzip")); err == nil {
+		t.Error("serializing with an unknown compression method should fail")
+	}
+}